@@ -2,6 +2,7 @@ package cloudnative
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 
 	"github.com/BurntSushi/toml"
@@ -15,14 +16,29 @@ type Buildpack struct {
 }
 
 type BuildpackInfo struct {
-	ID      string `toml:"id"`
-	Name    string `toml:"name"`
-	Version string `toml:"version"`
+	ID       string             `toml:"id"`
+	Name     string             `toml:"name"`
+	Version  string             `toml:"version"`
+	Licenses []BuildpackLicense `toml:"licenses,omitempty"`
+}
+
+type BuildpackLicense struct {
+	Type string `toml:"type"`
+	URI  string `toml:"uri,omitempty"`
 }
 
 type BuildpackMetadata struct {
 	IncludeFiles []string                      `toml:"include_files"`
 	Dependencies []BuildpackMetadataDependency `toml:"dependencies"`
+	PlatformEnv  *BuildpackPlatformEnv         `toml:"platform_env,omitempty"`
+}
+
+// BuildpackPlatformEnv is the [metadata.platform_env] table, which is
+// packaged as it is for the shims to read.
+type BuildpackPlatformEnv struct {
+	Allow   []string          `toml:"allow,omitempty"`
+	Deny    []string          `toml:"deny,omitempty"`
+	Actions map[string]string `toml:"actions,omitempty"`
 }
 
 type BuildpackOrder struct {
@@ -39,12 +55,33 @@ func ParseBuildpack(path string) (Buildpack, error) {
 	var buildpack Buildpack
 	_, err := toml.DecodeFile(path, &buildpack)
 	if err != nil {
-		return Buildpack{}, fmt.Errorf("failed to parse %s: %s", path, err)
+		return Buildpack{}, NewError(ParseError, err, "failed to parse %s", path)
 	}
 
 	return buildpack, nil
 }
 
+// Stacks returns the short names of every Cloud Foundry stack supported by
+// the buildpack's dependencies, in the order they first appear.
+func (b Buildpack) Stacks() []string {
+	var stacks []string
+	seen := map[string]bool{}
+	for _, dependency := range b.Metadata.Dependencies {
+		for _, stack := range dependency.Stacks {
+			if !strings.HasPrefix(stack, cloudFoundryStackPrefix) {
+				continue
+			}
+
+			stack = strings.TrimPrefix(stack, cloudFoundryStackPrefix)
+			if !seen[stack] {
+				seen[stack] = true
+				stacks = append(stacks, stack)
+			}
+		}
+	}
+	return stacks
+}
+
 type BuildpackMetadataDependency struct {
 	ID      string `toml:"id"`
 	Version string `toml:"version"`
@@ -55,7 +92,44 @@ type BuildpackMetadataDependency struct {
 	Source       string `toml:"source"`
 	SourceSHA256 string `toml:"source_sha256"`
 
-	Stacks []string `toml:"stacks"`
+	Stacks   []string           `toml:"stacks"`
+	Licenses DependencyLicenses `toml:"licenses,omitempty"`
+}
+
+// DependencyLicenses are the license types of a dependency. They may be
+// declared as strings or, as many CNBs do, as tables with a type and uri.
+type DependencyLicenses []string
+
+func (l *DependencyLicenses) UnmarshalTOML(data interface{}) error {
+	var values []interface{}
+	switch data := data.(type) {
+	case []interface{}:
+		values = data
+	case []map[string]interface{}:
+		// an array of tables, as [[metadata.dependencies.licenses]] declares
+		for _, table := range data {
+			values = append(values, table)
+		}
+	default:
+		return fmt.Errorf("licenses must be an array, found %T", data)
+	}
+
+	licenses := DependencyLicenses{}
+	for _, value := range values {
+		switch license := value.(type) {
+		case string:
+			licenses = append(licenses, license)
+		case map[string]interface{}:
+			if licenseType, ok := license["type"].(string); ok && licenseType != "" {
+				licenses = append(licenses, licenseType)
+			}
+		default:
+			return fmt.Errorf("license must be a string or a table, found %T", value)
+		}
+	}
+
+	*l = licenses
+	return nil
 }
 
 func (bpDep BuildpackMetadataDependency) MatchesStack(stackName string) bool {
@@ -66,3 +140,59 @@ func (bpDep BuildpackMetadataDependency) MatchesStack(stackName string) bool {
 	}
 	return false
 }
+
+// ResolveFileURI resolves a relative file:// or oci:// uri against dir,
+// keeping any trailing slash that marks a directory source. Other uris are
+// returned unchanged.
+func ResolveFileURI(uri, dir string) string {
+	var scheme string
+	for _, s := range []string{"file://", ociScheme} {
+		if strings.HasPrefix(uri, s) {
+			scheme = s
+		}
+	}
+
+	if scheme == "" {
+		return uri
+	}
+
+	path := strings.TrimPrefix(uri, scheme)
+	if filepath.IsAbs(path) {
+		return uri
+	}
+
+	resolved := filepath.Join(dir, path)
+	if strings.HasSuffix(path, "/") {
+		resolved += "/"
+	}
+
+	return scheme + resolved
+}
+
+// RelativeFileURI undoes ResolveFileURI for uris inside dir, so that they
+// can be recorded independently of where dir is.
+func RelativeFileURI(uri, dir string) string {
+	for _, scheme := range []string{"file://", ociScheme} {
+		if !strings.HasPrefix(uri, scheme) {
+			continue
+		}
+
+		path := strings.TrimPrefix(uri, scheme)
+		if !filepath.IsAbs(path) {
+			return uri
+		}
+
+		relative, err := filepath.Rel(dir, path)
+		if err != nil || strings.HasPrefix(relative, "..") {
+			return uri
+		}
+
+		if strings.HasSuffix(path, "/") {
+			relative += "/"
+		}
+
+		return scheme + relative
+	}
+
+	return uri
+}
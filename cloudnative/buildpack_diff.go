@@ -0,0 +1,257 @@
+package cloudnative
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// BuildpackDiff describes how one shimmed buildpack differs from another.
+type BuildpackDiff struct {
+	ID            string
+	FromVersion   string
+	ToVersion     string
+	FromLifecycle string
+	ToLifecycle   string
+	AddedStacks   []string
+	RemovedStacks []string
+	Added         []DependencyVersions
+	Removed       []DependencyVersions
+	Changed       []DependencyChange
+	Orders        []OrderChange
+}
+
+// DependencyVersions lists the versions of a dependency and the stacks
+// they are packaged for.
+type DependencyVersions struct {
+	ID       string
+	Versions []string
+	Stacks   []string
+}
+
+// DependencyChange records a dependency whose versions or stacks differ
+// between the buildpacks.
+type DependencyChange struct {
+	ID            string
+	From          []string
+	To            []string
+	AddedStacks   []string
+	RemovedStacks []string
+}
+
+// OrderChange records an order whose groups differ between the buildpacks.
+// Groups are written as id@version, with no groups for an added or removed
+// order. Index counts from zero.
+type OrderChange struct {
+	Index int
+	From  []string
+	To    []string
+}
+
+// Empty reports whether the buildpacks package the same lifecycle, stacks,
+// dependencies and orders.
+func (d BuildpackDiff) Empty() bool {
+	return d.FromLifecycle == d.ToLifecycle &&
+		len(d.AddedStacks) == 0 && len(d.RemovedStacks) == 0 &&
+		len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 &&
+		len(d.Orders) == 0
+}
+
+// LoadShimmedBuildpack reads the shimmed buildpack zip at path or, when path
+// is not a zip, describes the buildpack that the buildpack.toml at path
+// would be packaged as.
+func LoadShimmedBuildpack(path string) (ShimmedBuildpack, error) {
+	if strings.HasSuffix(path, ".zip") {
+		return ReadShimmedBuildpack(path)
+	}
+
+	buildpack, err := ParseBuildpack(path)
+	if err != nil {
+		return ShimmedBuildpack{}, err
+	}
+
+	return ShimmedBuildpack{
+		Version:   buildpack.Info.Version,
+		Buildpack: buildpack,
+		Manifest:  NewManifest(buildpack.Info.ID, buildpack.Metadata.Dependencies),
+	}, nil
+}
+
+// DiffBuildpacks compares the dependencies, stacks, lifecycle and order
+// groups of two shimmed buildpacks.
+func DiffBuildpacks(from, to ShimmedBuildpack) BuildpackDiff {
+	diff := BuildpackDiff{
+		ID:            to.Buildpack.Info.ID,
+		FromVersion:   from.Version,
+		ToVersion:     to.Version,
+		FromLifecycle: from.LifecycleVersion(),
+		ToLifecycle:   to.LifecycleVersion(),
+	}
+
+	fromStacks, toStacks := from.stacks(), to.stacks()
+	diff.AddedStacks = missing(toStacks, fromStacks)
+	diff.RemovedStacks = missing(fromStacks, toStacks)
+
+	fromDependencies, toDependencies := from.dependencyVersions(), to.dependencyVersions()
+	for _, dependency := range toDependencies {
+		previous, ok := findDependencyVersions(fromDependencies, dependency.ID)
+		if !ok {
+			diff.Added = append(diff.Added, dependency)
+			continue
+		}
+
+		change := DependencyChange{
+			ID:            dependency.ID,
+			From:          previous.Versions,
+			To:            dependency.Versions,
+			AddedStacks:   missing(dependency.Stacks, previous.Stacks),
+			RemovedStacks: missing(previous.Stacks, dependency.Stacks),
+		}
+		if !reflect.DeepEqual(change.From, change.To) || len(change.AddedStacks) > 0 || len(change.RemovedStacks) > 0 {
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+
+	for _, dependency := range fromDependencies {
+		if _, ok := findDependencyVersions(toDependencies, dependency.ID); !ok {
+			diff.Removed = append(diff.Removed, dependency)
+		}
+	}
+
+	fromOrders, toOrders := from.Buildpack.Orders, to.Buildpack.Orders
+	for i := 0; i < len(fromOrders) || i < len(toOrders); i++ {
+		var fromGroups, toGroups []string
+		if i < len(fromOrders) {
+			fromGroups = orderGroups(fromOrders[i])
+		}
+		if i < len(toOrders) {
+			toGroups = orderGroups(toOrders[i])
+		}
+
+		if !reflect.DeepEqual(fromGroups, toGroups) {
+			diff.Orders = append(diff.Orders, OrderChange{Index: i, From: fromGroups, To: toGroups})
+		}
+	}
+
+	return diff
+}
+
+// stacks returns the short names of the stacks that the buildpack supports.
+func (s ShimmedBuildpack) stacks() []string {
+	var stacks []string
+	if s.Manifest.Stack != "" {
+		stacks = append(stacks, s.Manifest.Stack)
+	}
+
+	for _, dependency := range s.Manifest.Dependencies {
+		stacks = append(stacks, dependency.Stacks...)
+	}
+
+	return sortedUnique(stacks)
+}
+
+// dependencyVersions groups the dependencies other than the lifecycle by
+// id, sorted by id.
+func (s ShimmedBuildpack) dependencyVersions() []DependencyVersions {
+	var dependencies []DependencyVersions
+	for _, dependency := range s.Manifest.Dependencies {
+		if dependency.ID == Lifecycle {
+			continue
+		}
+
+		stacks := dependency.Stacks
+		if len(stacks) == 0 && s.Manifest.Stack != "" {
+			stacks = []string{s.Manifest.Stack}
+		}
+
+		i := 0
+		for ; i < len(dependencies); i++ {
+			if dependencies[i].ID == dependency.ID {
+				break
+			}
+		}
+		if i == len(dependencies) {
+			dependencies = append(dependencies, DependencyVersions{ID: dependency.ID})
+		}
+
+		dependencies[i].Versions = SortVersions(sortedUnique(append(dependencies[i].Versions, dependency.Version)))
+		dependencies[i].Stacks = sortedUnique(append(dependencies[i].Stacks, stacks...))
+	}
+
+	sort.Slice(dependencies, func(i, j int) bool {
+		return dependencies[i].ID < dependencies[j].ID
+	})
+
+	return dependencies
+}
+
+func findDependencyVersions(dependencies []DependencyVersions, id string) (DependencyVersions, bool) {
+	for _, dependency := range dependencies {
+		if dependency.ID == id {
+			return dependency, true
+		}
+	}
+	return DependencyVersions{}, false
+}
+
+func orderGroups(order BuildpackOrder) []string {
+	var groups []string
+	for _, group := range order.Groups {
+		entry := fmt.Sprintf("%s@%s", group.ID, group.Version)
+		if group.Optional {
+			entry += " (optional)"
+		}
+		groups = append(groups, entry)
+	}
+	return groups
+}
+
+// SortVersions orders semantic versions by precedence, after any versions
+// that cannot be parsed.
+func SortVersions(versions []string) []string {
+	sort.SliceStable(versions, func(i, j int) bool {
+		a, aErr := semver.NewVersion(versions[i])
+		b, bErr := semver.NewVersion(versions[j])
+		if aErr != nil || bErr != nil {
+			return aErr != nil && bErr == nil
+		}
+		return a.LessThan(b)
+	})
+	return versions
+}
+
+func sortedUnique(values []string) []string {
+	var unique []string
+	seen := map[string]bool{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+
+	sort.Strings(unique)
+	return unique
+}
+
+// missing returns the values that are not in others.
+func missing(values, others []string) []string {
+	var result []string
+	for _, value := range values {
+		found := false
+		for _, other := range others {
+			if value == other {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			result = append(result, value)
+		}
+	}
+	return result
+}
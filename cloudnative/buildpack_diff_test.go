@@ -0,0 +1,143 @@
+package cloudnative_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testBuildpackDiff(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		from, to cloudnative.ShimmedBuildpack
+	)
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		from = cloudnative.ShimmedBuildpack{
+			Version: "1.0.0",
+			Buildpack: cloudnative.Buildpack{
+				Info: cloudnative.BuildpackInfo{ID: "org.cloudfoundry.nodejs"},
+				Orders: []cloudnative.BuildpackOrder{
+					{Groups: []cloudnative.BuildpackOrderGroup{{ID: "org.cloudfoundry.node-engine", Version: "0.0.99"}}},
+				},
+			},
+			Manifest: cloudnative.Manifest{Dependencies: []cloudnative.ManifestDependency{
+				{ID: "lifecycle", Version: "0.7.2", Stacks: []string{"cflinuxfs3"}},
+				{ID: "org.cloudfoundry.node-engine", Version: "0.0.99", Stacks: []string{"cflinuxfs3"}},
+				{ID: "org.cloudfoundry.yarn", Version: "0.1.0", Stacks: []string{"cflinuxfs3"}},
+			}},
+		}
+
+		to = cloudnative.ShimmedBuildpack{
+			Version: "1.1.0",
+			Buildpack: cloudnative.Buildpack{
+				Info: cloudnative.BuildpackInfo{ID: "org.cloudfoundry.nodejs"},
+				Orders: []cloudnative.BuildpackOrder{
+					{Groups: []cloudnative.BuildpackOrderGroup{{ID: "org.cloudfoundry.node-engine", Version: "0.0.100"}}},
+					{Groups: []cloudnative.BuildpackOrderGroup{{ID: "org.cloudfoundry.npm", Version: "0.1.4", Optional: true}}},
+				},
+			},
+			Manifest: cloudnative.Manifest{Dependencies: []cloudnative.ManifestDependency{
+				{ID: "lifecycle", Version: "0.7.5", Stacks: []string{"cflinuxfs3", "bionic"}},
+				{ID: "org.cloudfoundry.node-engine", Version: "0.0.100", Stacks: []string{"cflinuxfs3"}},
+				{ID: "org.cloudfoundry.node-engine", Version: "0.0.100", Stacks: []string{"bionic"}},
+				{ID: "org.cloudfoundry.npm", Version: "0.1.4", Stacks: []string{"cflinuxfs3", "bionic"}},
+			}},
+		}
+	})
+
+	when("DiffBuildpacks", func() {
+		it("lists what changed", func() {
+			diff := cloudnative.DiffBuildpacks(from, to)
+
+			Expect(diff).To(Equal(cloudnative.BuildpackDiff{
+				ID:            "org.cloudfoundry.nodejs",
+				FromVersion:   "1.0.0",
+				ToVersion:     "1.1.0",
+				FromLifecycle: "0.7.2",
+				ToLifecycle:   "0.7.5",
+				AddedStacks:   []string{"bionic"},
+				Added: []cloudnative.DependencyVersions{
+					{ID: "org.cloudfoundry.npm", Versions: []string{"0.1.4"}, Stacks: []string{"bionic", "cflinuxfs3"}},
+				},
+				Removed: []cloudnative.DependencyVersions{
+					{ID: "org.cloudfoundry.yarn", Versions: []string{"0.1.0"}, Stacks: []string{"cflinuxfs3"}},
+				},
+				Changed: []cloudnative.DependencyChange{
+					{ID: "org.cloudfoundry.node-engine", From: []string{"0.0.99"}, To: []string{"0.0.100"}, AddedStacks: []string{"bionic"}},
+				},
+				Orders: []cloudnative.OrderChange{
+					{Index: 0, From: []string{"org.cloudfoundry.node-engine@0.0.99"}, To: []string{"org.cloudfoundry.node-engine@0.0.100"}},
+					{Index: 1, To: []string{"org.cloudfoundry.npm@0.1.4 (optional)"}},
+				},
+			}))
+			Expect(diff.Empty()).To(BeFalse())
+		})
+
+		it("lists a dependency whose stacks changed", func() {
+			to = from
+			to.Manifest = cloudnative.Manifest{Dependencies: []cloudnative.ManifestDependency{
+				{ID: "lifecycle", Version: "0.7.2", Stacks: []string{"cflinuxfs3", "cflinuxfs4"}},
+				{ID: "org.cloudfoundry.node-engine", Version: "0.0.99", Stacks: []string{"cflinuxfs4"}},
+				{ID: "org.cloudfoundry.yarn", Version: "0.1.0", Stacks: []string{"cflinuxfs3"}},
+			}}
+
+			diff := cloudnative.DiffBuildpacks(from, to)
+			Expect(diff.Changed).To(Equal([]cloudnative.DependencyChange{
+				{
+					ID:            "org.cloudfoundry.node-engine",
+					From:          []string{"0.0.99"},
+					To:            []string{"0.0.99"},
+					AddedStacks:   []string{"cflinuxfs4"},
+					RemovedStacks: []string{"cflinuxfs3"},
+				},
+			}))
+			Expect(diff.Empty()).To(BeFalse())
+		})
+
+		it("treats a zip built for one stack as supporting that stack", func() {
+			single := from
+			single.Manifest = cloudnative.Manifest{Stack: "cflinuxfs3", Dependencies: []cloudnative.ManifestDependency{
+				{ID: "lifecycle", Version: "0.7.2"},
+				{ID: "org.cloudfoundry.node-engine", Version: "0.0.99"},
+				{ID: "org.cloudfoundry.yarn", Version: "0.1.0"},
+			}}
+
+			Expect(cloudnative.DiffBuildpacks(from, single).Empty()).To(BeTrue())
+		})
+	})
+
+	when("LoadShimmedBuildpack", func() {
+		it("describes a buildpack.toml as it would be packaged", func() {
+			tmpDir, err := ioutil.TempDir("", "buildpack-diff")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(tmpDir)
+
+			path := filepath.Join(tmpDir, "buildpack.toml")
+			Expect(ioutil.WriteFile(path, []byte(`[buildpack]
+  id = "org.cloudfoundry.nodejs"
+  version = "1.0.0"
+
+[[metadata.dependencies]]
+  id = "lifecycle"
+  version = "0.7.2"
+  stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]
+`), 0644)).To(Succeed())
+
+			shimmed, err := cloudnative.LoadShimmedBuildpack(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(shimmed.Version).To(Equal("1.0.0"))
+			Expect(shimmed.LifecycleVersion()).To(Equal("0.7.2"))
+			Expect(shimmed.Manifest.Dependencies[0].Stacks).To(Equal([]string{"cflinuxfs3"}))
+		})
+	})
+}
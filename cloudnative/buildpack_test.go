@@ -122,6 +122,27 @@ optional = true
 			}))
 		})
 
+		it("reads dependency licenses declared as strings or as tables", func() {
+			path := filepath.Join(tmpDir, "buildpack.toml")
+			Expect(ioutil.WriteFile(path, []byte(`
+[[metadata.dependencies]]
+id = "some-dependency"
+licenses = ["MIT", "Apache-2.0"]
+
+[[metadata.dependencies]]
+id = "jre"
+
+  [[metadata.dependencies.licenses]]
+  type = "GPL-2.0 WITH Classpath-exception-2.0"
+  uri = "https://openjdk.java.net/legal/gplv2+ce.html"
+`), 0644)).To(Succeed())
+
+			buildpack, err := cloudnative.ParseBuildpack(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buildpack.Metadata.Dependencies[0].Licenses).To(Equal(cloudnative.DependencyLicenses{"MIT", "Apache-2.0"}))
+			Expect(buildpack.Metadata.Dependencies[1].Licenses).To(Equal(cloudnative.DependencyLicenses{"GPL-2.0 WITH Classpath-exception-2.0"}))
+		})
+
 		when("failure cases", func() {
 			when("the file does not contain valid TOML", func() {
 				it("returns an error", func() {
@@ -137,6 +158,47 @@ optional = true
 		})
 	})
 
+	when("Stacks", func() {
+		it("returns the union of the Cloud Foundry stacks of the dependencies", func() {
+			buildpack := cloudnative.Buildpack{
+				Metadata: cloudnative.BuildpackMetadata{
+					Dependencies: []cloudnative.BuildpackMetadataDependency{
+						{ID: "lifecycle", Stacks: []string{"org.cloudfoundry.stacks.cflinuxfs3", "io.buildpacks.stacks.bionic"}},
+						{ID: "some-dependency", Stacks: []string{"org.cloudfoundry.stacks.cflinuxfs4", "org.cloudfoundry.stacks.cflinuxfs3"}},
+					},
+				},
+			}
+
+			Expect(buildpack.Stacks()).To(Equal([]string{"cflinuxfs3", "cflinuxfs4"}))
+		})
+	})
+
+	when("ResolveFileURI", func() {
+		it("resolves relative file uris against the directory", func() {
+			Expect(cloudnative.ResolveFileURI("file://some-cnb.tgz", "/some/dir")).To(Equal("file:///some/dir/some-cnb.tgz"))
+			Expect(cloudnative.ResolveFileURI("file://../some-cnb/", "/some/dir")).To(Equal("file:///some/some-cnb/"))
+			Expect(cloudnative.ResolveFileURI("oci://some-layout@sha256:abc", "/some/dir")).To(Equal("oci:///some/dir/some-layout@sha256:abc"))
+		})
+
+		it("leaves absolute file uris and remote uris unchanged", func() {
+			Expect(cloudnative.ResolveFileURI("file:///tmp/some-cnb.tgz", "/some/dir")).To(Equal("file:///tmp/some-cnb.tgz"))
+			Expect(cloudnative.ResolveFileURI("https://example.com/some-cnb.tgz", "/some/dir")).To(Equal("https://example.com/some-cnb.tgz"))
+		})
+	})
+
+	when("RelativeFileURI", func() {
+		it("makes file uris inside the directory relative to it", func() {
+			Expect(cloudnative.RelativeFileURI("file:///some/dir/some-cnb.tgz", "/some/dir")).To(Equal("file://some-cnb.tgz"))
+			Expect(cloudnative.RelativeFileURI("file:///some/dir/cnbs/some-cnb/", "/some/dir")).To(Equal("file://cnbs/some-cnb/"))
+			Expect(cloudnative.RelativeFileURI("oci:///some/dir/layout@sha256:abc", "/some/dir")).To(Equal("oci://layout@sha256:abc"))
+		})
+
+		it("leaves uris outside the directory and remote uris unchanged", func() {
+			Expect(cloudnative.RelativeFileURI("file:///tmp/some-cnb.tgz", "/some/dir")).To(Equal("file:///tmp/some-cnb.tgz"))
+			Expect(cloudnative.RelativeFileURI("https://example.com/some-cnb.tgz", "/some/dir")).To(Equal("https://example.com/some-cnb.tgz"))
+		})
+	})
+
 	when("BuildpackMetadataDependency", func() {
 		when("MatchesStack", func() {
 			var dependency cloudnative.BuildpackMetadataDependency
@@ -0,0 +1,174 @@
+package cloudnative
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+var gitHubHosts = []string{"github.com", "api.github.com"}
+
+// Credentials holds the Authorization header to send to each host that
+// dependencies are downloaded from. Hosts without an entry get no
+// credentials at all.
+type Credentials struct {
+	hosts map[string]string
+}
+
+type credentialsFile struct {
+	Credentials []struct {
+		Host     string `toml:"host"`
+		Token    string `toml:"token"`
+		Username string `toml:"username"`
+		Password string `toml:"password"`
+	} `toml:"credentials"`
+}
+
+func NewCredentials() Credentials {
+	return Credentials{
+		hosts: map[string]string{},
+	}
+}
+
+func (c Credentials) with(host, authorization string) Credentials {
+	hosts := map[string]string{}
+	for h, a := range c.hosts {
+		hosts[h] = a
+	}
+	hosts[strings.ToLower(host)] = authorization
+
+	return Credentials{hosts: hosts}
+}
+
+// WithBasicAuth returns credentials that send username and password to host.
+func (c Credentials) WithBasicAuth(host, username, password string) Credentials {
+	return c.with(host, "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+}
+
+// WithBearerToken returns credentials that send token to host.
+func (c Credentials) WithBearerToken(host, token string) Credentials {
+	return c.with(host, "Bearer "+token)
+}
+
+// WithGitHubToken returns credentials that send token to github.com and
+// api.github.com, and nowhere else. An empty token is ignored.
+func (c Credentials) WithGitHubToken(token string) Credentials {
+	if token == "" {
+		return c
+	}
+
+	for _, host := range gitHubHosts {
+		c = c.with(host, "token "+token)
+	}
+	return c
+}
+
+// WithNetrc returns credentials that also send the logins in the netrc file
+// at path as basic auth. The default entry is ignored, so that a login is
+// never sent to a host it was not written for.
+func (c Credentials) WithNetrc(path string) (Credentials, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return c, NewError(ParseError, err, "failed to read netrc file")
+	}
+	defer file.Close()
+
+	var (
+		machine, login, password string
+		inMachine, inMacro       bool
+	)
+
+	flush := func() {
+		if inMachine && login != "" {
+			c = c.WithBasicAuth(machine, login, password)
+		}
+		machine, login, password, inMachine = "", "", "", false
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacro {
+			// a macro definition runs until the next blank line
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			var value string
+			if i+1 < len(fields) {
+				value = fields[i+1]
+			}
+
+			switch fields[i] {
+			case "machine":
+				flush()
+				machine, inMachine = value, true
+				i++
+			case "default":
+				flush()
+			case "login":
+				login = value
+				i++
+			case "password":
+				password = value
+				i++
+			case "account":
+				i++
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+	flush()
+
+	if err := scanner.Err(); err != nil {
+		return c, NewError(ParseError, err, "failed to read netrc file")
+	}
+
+	return c, nil
+}
+
+// WithFile returns credentials that also include the entries in the TOML
+// credentials file at path. Each [[credentials]] entry names a host and
+// either a bearer token or a username and password.
+func (c Credentials) WithFile(path string) (Credentials, error) {
+	var file credentialsFile
+	if _, err := toml.DecodeFile(path, &file); err != nil {
+		return c, NewError(ParseError, err, "failed to parse credentials file %s", path)
+	}
+
+	for _, entry := range file.Credentials {
+		switch {
+		case entry.Host == "":
+			return c, NewError(ParseError, errors.New("missing host"), "invalid credentials in %s", path)
+		case entry.Token != "" && entry.Username != "":
+			return c, NewError(ParseError, errors.New("both token and username are set"), "invalid credentials for %s", entry.Host)
+		case entry.Token != "":
+			c = c.WithBearerToken(entry.Host, entry.Token)
+		case entry.Username != "":
+			c = c.WithBasicAuth(entry.Host, entry.Username, entry.Password)
+		default:
+			return c, NewError(ParseError, errors.New("token or username is required"), "invalid credentials for %s", entry.Host)
+		}
+	}
+
+	return c, nil
+}
+
+// Authorization returns the Authorization header for u, or an empty string
+// if there are no credentials for its host. An entry for host:port takes
+// precedence over one for the host alone.
+func (c Credentials) Authorization(u *url.URL) string {
+	if authorization, ok := c.hosts[strings.ToLower(u.Host)]; ok {
+		return authorization
+	}
+	return c.hosts[strings.ToLower(u.Hostname())]
+}
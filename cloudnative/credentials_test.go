@@ -0,0 +1,169 @@
+package cloudnative_test
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testCredentials(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		tmpDir string
+	)
+
+	authorization := func(credentials cloudnative.Credentials, uri string) string {
+		u, err := url.Parse(uri)
+		Expect(err).NotTo(HaveOccurred())
+		return credentials.Authorization(u)
+	}
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "credentials")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	when("WithGitHubToken", func() {
+		it("only sends the token to github", func() {
+			credentials := cloudnative.NewCredentials().WithGitHubToken("some-token")
+
+			Expect(authorization(credentials, "https://github.com/some/release.tgz")).To(Equal("token some-token"))
+			Expect(authorization(credentials, "https://api.github.com/repos/some/repo")).To(Equal("token some-token"))
+			Expect(authorization(credentials, "https://github.com.example.com/release.tgz")).To(BeEmpty())
+			Expect(authorization(credentials, "https://example.com/release.tgz")).To(BeEmpty())
+		})
+
+		it("ignores an empty token", func() {
+			credentials := cloudnative.NewCredentials().WithGitHubToken("")
+			Expect(authorization(credentials, "https://github.com/some/release.tgz")).To(BeEmpty())
+		})
+	})
+
+	when("WithBasicAuth", func() {
+		it("matches the host case insensitively", func() {
+			credentials := cloudnative.NewCredentials().WithBasicAuth("Artifacts.Example.com", "user", "pass")
+			Expect(authorization(credentials, "https://artifacts.example.com/dep.tgz")).To(Equal("Basic dXNlcjpwYXNz"))
+		})
+
+		it("prefers an entry for the host and port", func() {
+			credentials := cloudnative.NewCredentials().
+				WithBearerToken("example.com", "any-port").
+				WithBearerToken("example.com:8443", "this-port")
+
+			Expect(authorization(credentials, "https://example.com:8443/dep.tgz")).To(Equal("Bearer this-port"))
+			Expect(authorization(credentials, "https://example.com/dep.tgz")).To(Equal("Bearer any-port"))
+		})
+
+		it("does not change the credentials it was called on", func() {
+			credentials := cloudnative.NewCredentials()
+			credentials.WithBasicAuth("example.com", "user", "pass")
+			Expect(authorization(credentials, "https://example.com/dep.tgz")).To(BeEmpty())
+		})
+	})
+
+	when("WithNetrc", func() {
+		var path string
+
+		it.Before(func() {
+			path = filepath.Join(tmpDir, ".netrc")
+			Expect(ioutil.WriteFile(path, []byte(`machine artifacts.example.com
+  login user
+  password pass
+
+macdef init
+  machine macro.example.com login nobody password nothing
+
+machine mirror.example.com login other password secret account ignored
+default login anyone password anything
+`), 0600)).To(Succeed())
+		})
+
+		it("sends each login to its machine only", func() {
+			credentials, err := cloudnative.NewCredentials().WithNetrc(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(authorization(credentials, "https://artifacts.example.com/dep.tgz")).To(Equal("Basic dXNlcjpwYXNz"))
+			Expect(authorization(credentials, "https://mirror.example.com/dep.tgz")).To(Equal("Basic b3RoZXI6c2VjcmV0"))
+			Expect(authorization(credentials, "https://macro.example.com/dep.tgz")).To(BeEmpty())
+			Expect(authorization(credentials, "https://example.com/dep.tgz")).To(BeEmpty())
+		})
+
+		when("the file does not exist", func() {
+			it("returns a parse error", func() {
+				_, err := cloudnative.NewCredentials().WithNetrc(filepath.Join(tmpDir, "missing"))
+				Expect(err).To(MatchError(ContainSubstring("failed to read netrc file")))
+				Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.ParseError))
+			})
+		})
+	})
+
+	when("WithFile", func() {
+		var path string
+
+		it.Before(func() {
+			path = filepath.Join(tmpDir, "credentials.toml")
+		})
+
+		it("adds bearer tokens and basic auth", func() {
+			Expect(ioutil.WriteFile(path, []byte(`
+[[credentials]]
+host = "artifacts.example.com"
+token = "some-token"
+
+[[credentials]]
+host = "mirror.example.com"
+username = "user"
+password = "pass"
+`), 0600)).To(Succeed())
+
+			credentials, err := cloudnative.NewCredentials().WithGitHubToken("github-token").WithFile(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(authorization(credentials, "https://artifacts.example.com/dep.tgz")).To(Equal("Bearer some-token"))
+			Expect(authorization(credentials, "https://mirror.example.com/dep.tgz")).To(Equal("Basic dXNlcjpwYXNz"))
+			Expect(authorization(credentials, "https://github.com/dep.tgz")).To(Equal("token github-token"))
+		})
+
+		when("an entry has no host", func() {
+			it("returns a parse error", func() {
+				Expect(ioutil.WriteFile(path, []byte(`
+[[credentials]]
+token = "some-token"
+`), 0600)).To(Succeed())
+
+				_, err := cloudnative.NewCredentials().WithFile(path)
+				Expect(err).To(MatchError(ContainSubstring("missing host")))
+				Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.ParseError))
+			})
+		})
+
+		when("an entry has both a token and a username", func() {
+			it("returns a parse error", func() {
+				Expect(ioutil.WriteFile(path, []byte(`
+[[credentials]]
+host = "example.com"
+token = "some-token"
+username = "user"
+`), 0600)).To(Succeed())
+
+				_, err := cloudnative.NewCredentials().WithFile(path)
+				Expect(err).To(MatchError("invalid credentials for example.com: both token and username are set"))
+			})
+		})
+	})
+}
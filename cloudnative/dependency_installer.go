@@ -1,80 +1,246 @@
 package cloudnative
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/cloudfoundry/libbuildpack"
 )
 
-type DependencyInstaller struct{}
+const (
+	DefaultDownloadTimeout = 10 * time.Minute
+	DefaultDownloadRetries = 3
+	DefaultRetryBackoff    = time.Second
+)
+
+type DependencyInstaller struct {
+	cache       *DownloadCache
+	credentials Credentials
+	timeout     time.Duration
+	retries     int
+	backoff     time.Duration
+}
 
+// NewDependencyInstaller returns an installer that sends the GIT_TOKEN
+// environment variable, if set, to GitHub and no credentials anywhere else.
 func NewDependencyInstaller() DependencyInstaller {
-	return DependencyInstaller{}
+	return DependencyInstaller{
+		credentials: NewCredentials().WithGitHubToken(os.Getenv("GIT_TOKEN")),
+		timeout:     DefaultDownloadTimeout,
+		retries:     DefaultDownloadRetries,
+		backoff:     DefaultRetryBackoff,
+	}
+}
+
+// WithCredentials returns an installer that authenticates to each host with
+// credentials instead.
+func (di DependencyInstaller) WithCredentials(credentials Credentials) DependencyInstaller {
+	di.credentials = credentials
+	return di
+}
+
+// WithTimeout returns an installer that abandons a download attempt once it
+// has taken longer than timeout. A zero timeout means no limit.
+func (di DependencyInstaller) WithTimeout(timeout time.Duration) DependencyInstaller {
+	di.timeout = timeout
+	return di
+}
+
+// WithRetries returns an installer that retries a download up to retries
+// times after a server or connection error, waiting backoff before the
+// first retry and twice as long before each one after that.
+func (di DependencyInstaller) WithRetries(retries int, backoff time.Duration) DependencyInstaller {
+	di.retries = retries
+	di.backoff = backoff
+	return di
+}
+
+// WithCache returns an installer that looks remote dependencies up in the
+// download cache before fetching them, and adds them to it afterwards.
+func (di DependencyInstaller) WithCache(cache DownloadCache) DependencyInstaller {
+	di.cache = &cache
+	return di
 }
 
 func (di DependencyInstaller) Download(uri, checksum, destination string) error {
-	err := os.MkdirAll(filepath.Dir(destination), 0755)
+	u, err := url.Parse(uri)
 	if err != nil {
 		return err
 	}
 
-	output, err := os.Create(destination)
-	if err != nil {
+	useCache := di.cache != nil && u.Scheme != "file"
+	if useCache {
+		found, err := di.cache.Fetch(checksum, destination)
+		if err != nil {
+			return err
+		}
+
+		if found {
+			return nil
+		}
+	}
+
+	if err := di.download(u, uri, destination); err != nil {
+		return err
+	}
+
+	if err := libbuildpack.CheckSha256(destination, checksum); err != nil {
 		return err
 	}
-	defer output.Close()
 
+	if useCache {
+		return di.cache.Store(destination, checksum)
+	}
+
+	return nil
+}
+
+// Fetch downloads uri to destination without verifying it, for files such
+// as release indexes whose checksum is not known in advance.
+func (di DependencyInstaller) Fetch(uri, destination string) error {
 	u, err := url.Parse(uri)
 	if err != nil {
 		return err
 	}
 
-	var source io.ReadCloser
+	return di.download(u, uri, destination)
+}
+
+func (di DependencyInstaller) download(u *url.URL, uri, destination string) error {
+	err := os.MkdirAll(filepath.Dir(destination), 0755)
+	if err != nil {
+		return err
+	}
 
 	if u.Scheme == "file" {
-		source, err = os.Open(u.Path)
-		if err != nil {
-			return err
-		}
-		defer source.Close()
-	} else {
-		client := http.Client{}
-		req, err := http.NewRequest("GET", uri, nil)
-		if err != nil {
-			return err
-		}
-		gitToken := os.Getenv("GIT_TOKEN")
-		if gitToken != "" {
-			req.Header["Authorization"] = []string{"token " + gitToken}
+		return copyFile(u.Path, destination)
+	}
+
+	for attempt := 0; ; attempt++ {
+		// later attempts resume from whatever the earlier ones wrote
+		err = di.fetch(u, destination, attempt > 0)
+		if err == nil || !retryable(err) || attempt >= di.retries {
+			break
 		}
-		response, err := client.Do(req)
-		if err != nil {
-			return err
+
+		time.Sleep(di.backoff << uint(attempt))
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", uri, err)
+	}
+
+	return nil
+}
+
+func (di DependencyInstaller) fetch(u *url.URL, destination string, resume bool) error {
+	var offset int64
+	if resume {
+		if info, err := os.Stat(destination); err == nil {
+			offset = info.Size()
 		}
-		defer response.Body.Close()
-		source = response.Body
+	}
 
-		if response.StatusCode < 200 || response.StatusCode > 299 {
-			return fmt.Errorf("could not download: %d", response.StatusCode)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	if authorization := di.credentials.Authorization(u); authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	client := http.Client{Timeout: di.timeout}
+	response, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return statusError(response.StatusCode)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if offset > 0 && response.StatusCode == http.StatusPartialContent {
+		if !strings.HasPrefix(response.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			return fmt.Errorf("unexpected content range %q", response.Header.Get("Content-Range"))
 		}
+		flags = os.O_WRONLY | os.O_APPEND
 	}
 
-	_, err = io.Copy(output, source)
+	output, err := os.OpenFile(destination, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
 
+	_, err = io.Copy(output, response.Body)
+
+	return err
+}
+
+func copyFile(source, destination string) error {
+	input, err := os.Open(source)
 	if err != nil {
 		return err
 	}
+	defer input.Close()
 
-	if err := libbuildpack.CheckSha256(destination, checksum); err != nil {
+	output, err := os.Create(destination)
+	if err != nil {
 		return err
 	}
+	defer output.Close()
 
-	return nil
+	_, err = io.Copy(output, input)
+
+	return err
+}
+
+type statusError int
+
+func (s statusError) Error() string {
+	return fmt.Sprintf("could not download: %d", int(s))
+}
+
+// retryable reports whether a failed download attempt is worth repeating:
+// server errors, rate limiting, and connections that failed or dropped.
+func retryable(err error) bool {
+	var status statusError
+	if errors.As(err, &status) {
+		return status >= 500 || status == http.StatusTooManyRequests
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// DownloadImage exports the buildpack id@version from the OCI image that
+// reference names to a CNB tarball at destination. It returns the reference
+// pinned to the digest of the image, and the SHA256 of the tarball.
+func (di DependencyInstaller) DownloadImage(reference, id, version, destination string) (string, string, error) {
+	image, pinned, err := ResolveImage(reference)
+	if err != nil {
+		return "", "", err
+	}
+
+	checksum, err := ExportBuildpackImage(image, id, version, destination)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to export %s: %w", pinned, err)
+	}
+
+	return pinned, checksum, nil
 }
 
 func (di DependencyInstaller) Copy(source, destination string) error {
@@ -4,13 +4,16 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
-	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/cloudfoundry/libbuildpack"
 	"github.com/jarcoal/httpmock"
 	"github.com/sclevine/spec"
 
@@ -69,44 +72,100 @@ func testDependencyInstaller(t *testing.T, when spec.G, it spec.S) {
 		when("GIT_TOKEN env var is set", func() {
 			var prevAuthToken string
 			var tokenVal string
-			it.Before(func() {
-				// what should this actually be???
+			var authorization map[string][]string
 
+			it.Before(func() {
 				tokenVal = "some-auth-token"
 				prevAuthToken = os.Getenv("GIT_TOKEN")
 				Expect(os.Setenv("GIT_TOKEN", tokenVal)).To(Succeed())
 
-				httpmock.RegisterResponder("GET", "https://example.com/uri-dependency.tgz", func(request *http.Request) (response *http.Response, e error) {
-					contents := request.Header["Authorization"]
+				authorization = map[string][]string{}
+				responder := func(request *http.Request) (*http.Response, error) {
+					authorization[request.URL.Host] = request.Header["Authorization"]
 					res := new(http.Response)
-					expectedToken := []string{"token " +tokenVal}
-					if !reflect.DeepEqual(expectedToken, contents) {
-						return res, fmt.Errorf("unexpected header value '%s' vs '%s'", contents, expectedToken)
-					}
 					res.StatusCode = 200
 					res.Body = ioutil.NopCloser(strings.NewReader("dependency-contents"))
 					res.Request = request
 					return res, nil
-				})
+				}
+				httpmock.RegisterResponder("GET", "https://example.com/uri-dependency.tgz", responder)
+				httpmock.RegisterResponder("GET", "https://github.com/uri-dependency.tgz", responder)
+
+				installer = cloudnative.NewDependencyInstaller()
 			})
 
 			it.After(func() {
 				Expect(os.Setenv("GIT_TOKEN", prevAuthToken)).To(Succeed())
 			})
-			it("uses correct auth to grab dependency", func() {
-				err := installer.Download(uri, checksum, destination)
+
+			it("uses correct auth to grab dependency from github", func() {
+				err := installer.Download("https://github.com/uri-dependency.tgz", checksum, destination)
 				Expect(err).NotTo(HaveOccurred())
+				Expect(authorization["github.com"]).To(Equal([]string{"token " + tokenVal}))
 
 				contents, err := ioutil.ReadFile(destination)
 				Expect(err).NotTo(HaveOccurred())
 				Expect(string(contents)).To(Equal("dependency-contents"))
 			})
+
+			it("does not send the token to other hosts", func() {
+				err := installer.Download(uri, checksum, destination)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(authorization).To(HaveKey("example.com"))
+				Expect(authorization["example.com"]).To(BeEmpty())
+			})
+		})
+
+		when("credentials are configured for the host", func() {
+			var authorization []string
+
+			it.Before(func() {
+				httpmock.RegisterResponder("GET", "https://example.com/uri-dependency.tgz", func(request *http.Request) (*http.Response, error) {
+					authorization = request.Header["Authorization"]
+					return httpmock.NewStringResponse(200, "dependency-contents"), nil
+				})
+
+				installer = installer.WithCredentials(cloudnative.NewCredentials().WithBearerToken("example.com", "some-token"))
+			})
+
+			it("sends them with the request", func() {
+				Expect(installer.Download(uri, checksum, destination)).To(Succeed())
+				Expect(authorization).To(Equal([]string{"Bearer some-token"}))
+			})
+		})
+
+		when("a download cache is configured", func() {
+			var cacheDir string
+
+			it.Before(func() {
+				cacheDir = filepath.Join(tmpDir, "cache")
+				installer = installer.WithCache(cloudnative.NewDownloadCache(cacheDir))
+			})
+
+			it("only fetches the dependency from the network once", func() {
+				Expect(installer.Download(uri, checksum, destination)).To(Succeed())
+				Expect(filepath.Join(cacheDir, "sha256", checksum)).To(BeARegularFile())
+
+				otherDestination := filepath.Join(tmpDir, "other", "archive.tgz")
+				Expect(installer.Download(uri, checksum, otherDestination)).To(Succeed())
+				Expect(httpmock.GetTotalCallCount()).To(Equal(1))
+
+				contents, err := ioutil.ReadFile(otherDestination)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("dependency-contents"))
+			})
 		})
 
 		when("the dependency cannot be downloaded", func() {
-			it("returns an error", func() {
+			it.Before(func() {
+				installer = installer.WithRetries(2, time.Millisecond)
+			})
+
+			it("returns an error naming the uri", func() {
 				err := installer.Download("https://example.com/garbage-uri.tgz", checksum, destination)
 				Expect(err).To(MatchError(ContainSubstring("could not download")))
+				Expect(err).To(MatchError(ContainSubstring("https://example.com/garbage-uri.tgz")))
+				Expect(httpmock.GetTotalCallCount()).To(Equal(3))
 			})
 		})
 
@@ -118,6 +177,158 @@ func testDependencyInstaller(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("Download from an unreliable server", func() {
+		var (
+			server   *httptest.Server
+			handler  func(w http.ResponseWriter, attempt int)
+			mutex    sync.Mutex
+			ranges   []string
+			checksum string
+		)
+
+		// received returns the Range header of each request the server has seen
+		received := func() []string {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return append([]string{}, ranges...)
+		}
+
+		it.Before(func() {
+			ranges = nil
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				mutex.Lock()
+				ranges = append(ranges, req.Header.Get("Range"))
+				attempt := len(ranges)
+				mutex.Unlock()
+
+				handler(w, attempt)
+			}))
+
+			checksum = "f058c8bf6b65b829e200ef5c2d22fde0ee65b96c1fbd1b88869be133aafab64a"
+			destination = filepath.Join(tmpDir, "destination", "archive.tgz")
+			installer = installer.WithRetries(3, time.Millisecond)
+		})
+
+		it.After(func() {
+			server.Close()
+		})
+
+		when("the server fails and then recovers", func() {
+			it.Before(func() {
+				handler = func(w http.ResponseWriter, attempt int) {
+					if attempt < 3 {
+						w.WriteHeader(http.StatusServiceUnavailable)
+						return
+					}
+					fmt.Fprint(w, "dependency-contents")
+				}
+			})
+
+			it("retries until the download succeeds", func() {
+				Expect(installer.Download(server.URL+"/dependency.tgz", checksum, destination)).To(Succeed())
+				Expect(received()).To(HaveLen(3))
+
+				contents, err := ioutil.ReadFile(destination)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("dependency-contents"))
+			})
+		})
+
+		when("the server keeps failing", func() {
+			it.Before(func() {
+				handler = func(w http.ResponseWriter, attempt int) {
+					w.WriteHeader(http.StatusBadGateway)
+				}
+			})
+
+			it("gives up after the configured retries", func() {
+				err := installer.Download(server.URL+"/dependency.tgz", checksum, destination)
+				Expect(err).To(MatchError(fmt.Sprintf("failed to download %s/dependency.tgz: could not download: 502", server.URL)))
+				Expect(received()).To(HaveLen(4))
+			})
+		})
+
+		when("the dependency does not exist", func() {
+			it.Before(func() {
+				handler = func(w http.ResponseWriter, attempt int) {
+					w.WriteHeader(http.StatusNotFound)
+				}
+			})
+
+			it("does not retry", func() {
+				err := installer.Download(server.URL+"/dependency.tgz", checksum, destination)
+				Expect(err).To(MatchError(ContainSubstring("could not download: 404")))
+				Expect(received()).To(HaveLen(1))
+			})
+		})
+
+		when("the server is too slow", func() {
+			it.Before(func() {
+				installer = installer.WithTimeout(50*time.Millisecond).WithRetries(1, time.Millisecond)
+				handler = func(w http.ResponseWriter, attempt int) {
+					time.Sleep(200 * time.Millisecond)
+					fmt.Fprint(w, "dependency-contents")
+				}
+			})
+
+			it("times out each attempt", func() {
+				err := installer.Download(server.URL+"/dependency.tgz", checksum, destination)
+				Expect(err).To(MatchError(ContainSubstring("Client.Timeout exceeded")))
+				Expect(received()).To(HaveLen(2))
+			})
+		})
+
+		when("the connection drops part way through", func() {
+			it.Before(func() {
+				contents := "dependency-contents"
+				handler = func(w http.ResponseWriter, attempt int) {
+					if attempt == 1 {
+						w.Header().Set("Content-Length", fmt.Sprint(len(contents)))
+						fmt.Fprint(w, contents[:10])
+						w.(http.Flusher).Flush()
+						panic(http.ErrAbortHandler)
+					}
+
+					w.Header().Set("Content-Range", fmt.Sprintf("bytes 10-%d/%d", len(contents)-1, len(contents)))
+					w.WriteHeader(http.StatusPartialContent)
+					fmt.Fprint(w, contents[10:])
+				}
+			})
+
+			it("resumes from where it stopped", func() {
+				Expect(installer.Download(server.URL+"/dependency.tgz", checksum, destination)).To(Succeed())
+				Expect(received()).To(Equal([]string{"", "bytes=10-"}))
+
+				contents, err := ioutil.ReadFile(destination)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("dependency-contents"))
+			})
+		})
+	})
+
+	when("DownloadImage", func() {
+		it("exports the buildpack and pins the image reference", func() {
+			layoutPath, err := filepath.Abs(filepath.Join("testdata", "oci-layout"))
+			Expect(err).NotTo(HaveOccurred())
+
+			destination = filepath.Join(tmpDir, "destination", "node-engine.tgz")
+			pinned, checksum, err := installer.DownloadImage("oci://"+layoutPath, "org.cloudfoundry.node-engine", "1.2.3", destination)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pinned).To(Equal("oci://" + layoutPath + "@" + layoutDigest))
+			Expect(libbuildpack.CheckSha256(destination, checksum)).To(Succeed())
+		})
+
+		when("the image does not contain the buildpack", func() {
+			it("returns an error naming the image", func() {
+				layoutPath, err := filepath.Abs(filepath.Join("testdata", "oci-layout"))
+				Expect(err).NotTo(HaveOccurred())
+
+				_, _, err = installer.DownloadImage("oci://"+layoutPath, "org.cloudfoundry.go-compiler", "1.0.0", filepath.Join(tmpDir, "go-compiler.tgz"))
+				Expect(err).To(MatchError(ContainSubstring("failed to export oci://" + layoutPath + "@" + layoutDigest)))
+			})
+		})
+	})
+
 	when("Copy", func() {
 		var source, tmpFile string
 
@@ -0,0 +1,166 @@
+package cloudnative
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+// DownloadCache stores downloaded dependencies under the SHA256 of their
+// contents, so that a dependency with a known checksum is only fetched once.
+type DownloadCache struct {
+	dir string
+}
+
+type DownloadCacheEntry struct {
+	SHA256   string
+	Size     int64
+	LastUsed time.Time
+}
+
+func NewDownloadCache(dir string) DownloadCache {
+	return DownloadCache{
+		dir: filepath.Join(dir, "sha256"),
+	}
+}
+
+func (c DownloadCache) path(checksum string) string {
+	return filepath.Join(c.dir, checksum)
+}
+
+// Fetch copies the entry for checksum to destination. It reports false if
+// there is no entry, or if the entry no longer matches its checksum, in
+// which case the entry is removed.
+func (c DownloadCache) Fetch(checksum, destination string) (bool, error) {
+	if !sha256Pattern.MatchString(checksum) {
+		return false, nil
+	}
+
+	entry := c.path(checksum)
+	if _, err := os.Stat(entry); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if err := libbuildpack.CheckSha256(entry, checksum); err != nil {
+		return false, os.Remove(entry)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return false, err
+	}
+
+	if err := libbuildpack.CopyFile(entry, destination); err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(entry, now, now); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Store adds the file at path to the cache once it has been verified against
+// checksum. The entry is written to a temporary file and renamed into place
+// so that a partially written entry is never visible.
+func (c DownloadCache) Store(path, checksum string) error {
+	if !sha256Pattern.MatchString(checksum) {
+		return nil
+	}
+
+	if err := libbuildpack.CheckSha256(path, checksum); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile(c.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	if err := libbuildpack.CopyFile(path, tmpFile.Name()); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), c.path(checksum))
+}
+
+// List returns the cached entries, most recently used first.
+func (c DownloadCache) List() ([]DownloadCacheEntry, error) {
+	files, err := ioutil.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []DownloadCacheEntry
+	for _, file := range files {
+		if !sha256Pattern.MatchString(file.Name()) {
+			continue
+		}
+
+		entries = append(entries, DownloadCacheEntry{
+			SHA256:   file.Name(),
+			Size:     file.Size(),
+			LastUsed: file.ModTime(),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+
+	return entries, nil
+}
+
+// Prune removes the entries that have not been used since before, along
+// with any temporary files left behind by interrupted downloads. It returns
+// the removed entries.
+func (c DownloadCache) Prune(before time.Time) ([]DownloadCacheEntry, error) {
+	files, err := ioutil.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var removed []DownloadCacheEntry
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), ".tmp-") {
+			if err := os.Remove(filepath.Join(c.dir, file.Name())); err != nil {
+				return removed, err
+			}
+			continue
+		}
+
+		if !sha256Pattern.MatchString(file.Name()) || !file.ModTime().Before(before) {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(c.dir, file.Name())); err != nil {
+			return removed, err
+		}
+
+		removed = append(removed, DownloadCacheEntry{
+			SHA256:   file.Name(),
+			Size:     file.Size(),
+			LastUsed: file.ModTime(),
+		})
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,121 @@
+package cloudnative_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testDownloadCache(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		tmpDir   string
+		cacheDir string
+		source   string
+		checksum string
+		cache    cloudnative.DownloadCache
+	)
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "download-cache")
+		Expect(err).NotTo(HaveOccurred())
+
+		cacheDir = filepath.Join(tmpDir, "cache")
+		source = filepath.Join(tmpDir, "dependency.tgz")
+		Expect(ioutil.WriteFile(source, []byte("dependency-contents"), 0644)).To(Succeed())
+		checksum = "f058c8bf6b65b829e200ef5c2d22fde0ee65b96c1fbd1b88869be133aafab64a"
+
+		cache = cloudnative.NewDownloadCache(cacheDir)
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	when("Store and Fetch", func() {
+		it("stores a verified file under its checksum and copies it back out", func() {
+			Expect(cache.Store(source, checksum)).To(Succeed())
+			Expect(filepath.Join(cacheDir, "sha256", checksum)).To(BeARegularFile())
+
+			destination := filepath.Join(tmpDir, "out", "dependency.tgz")
+			found, err := cache.Fetch(checksum, destination)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+
+			contents, err := ioutil.ReadFile(destination)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("dependency-contents"))
+		})
+
+		it("does not store a file that does not match its checksum", func() {
+			err := cache.Store(source, "0000000000000000000000000000000000000000000000000000000000000000")
+			Expect(err).To(MatchError(ContainSubstring("dependency sha256 mismatch")))
+
+			entries, err := cache.List()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(BeEmpty())
+		})
+
+		it("reports a miss for an unknown checksum", func() {
+			found, err := cache.Fetch(checksum, filepath.Join(tmpDir, "out"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+
+		it("discards a corrupted entry", func() {
+			Expect(os.MkdirAll(filepath.Join(cacheDir, "sha256"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(cacheDir, "sha256", checksum), []byte("corrupted"), 0644)).To(Succeed())
+
+			found, err := cache.Fetch(checksum, filepath.Join(tmpDir, "out"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+			Expect(filepath.Join(cacheDir, "sha256", checksum)).NotTo(BeAnExistingFile())
+		})
+	})
+
+	when("List and Prune", func() {
+		var oldChecksum string
+
+		it.Before(func() {
+			Expect(cache.Store(source, checksum)).To(Succeed())
+
+			oldChecksum = "a6a8f1b1b3b1e6d1ae0e2ab0a8b5a3d2cfa6ebf25f7b1b6fa60daf6b7e9f4b55"
+			Expect(ioutil.WriteFile(filepath.Join(cacheDir, "sha256", oldChecksum), []byte("old"), 0644)).To(Succeed())
+
+			lastWeek := time.Now().Add(-7 * 24 * time.Hour)
+			Expect(os.Chtimes(filepath.Join(cacheDir, "sha256", oldChecksum), lastWeek, lastWeek)).To(Succeed())
+
+			Expect(ioutil.WriteFile(filepath.Join(cacheDir, "sha256", ".tmp-123"), []byte("partial"), 0644)).To(Succeed())
+		})
+
+		it("lists entries most recently used first", func() {
+			entries, err := cache.List()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(2))
+			Expect(entries[0].SHA256).To(Equal(checksum))
+			Expect(entries[0].Size).To(Equal(int64(len("dependency-contents"))))
+			Expect(entries[1].SHA256).To(Equal(oldChecksum))
+		})
+
+		it("prunes entries unused since the given time and leftover temporary files", func() {
+			removed, err := cache.Prune(time.Now().Add(-24 * time.Hour))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(removed).To(HaveLen(1))
+			Expect(removed[0].SHA256).To(Equal(oldChecksum))
+
+			Expect(filepath.Join(cacheDir, "sha256", checksum)).To(BeARegularFile())
+			Expect(filepath.Join(cacheDir, "sha256", ".tmp-123")).NotTo(BeAnExistingFile())
+		})
+	})
+}
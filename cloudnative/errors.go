@@ -0,0 +1,93 @@
+package cloudnative
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrorKind classifies a packaging failure so that callers can react to
+// the kind of failure rather than to its message.
+type ErrorKind int
+
+const (
+	UnknownError ErrorKind = iota
+	ParseError
+	DownloadError
+	BuildError
+	ArchiveError
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ParseError:
+		return "parse error"
+	case DownloadError:
+		return "download error"
+	case BuildError:
+		return "build error"
+	case ArchiveError:
+		return "archive error"
+	default:
+		return "error"
+	}
+}
+
+type Error struct {
+	Kind    ErrorKind
+	Message string
+	Err     error
+}
+
+func NewError(kind ErrorKind, err error, format string, args ...interface{}) error {
+	return Error{
+		Kind:    kind,
+		Message: fmt.Sprintf(format, args...),
+		Err:     err,
+	}
+}
+
+func (e Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Message, e.Err)
+}
+
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+// Errors collects several independent failures, such as dependencies that
+// failed to package concurrently.
+type Errors []error
+
+func (e Errors) Error() string {
+	var messages []string
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("%d failures:\n%s", len(e), strings.Join(messages, "\n"))
+}
+
+// KindOf returns the kind of the outermost Error in err's chain. Validation
+// problems are parse errors, several failures take the kind of the first,
+// and anything else is an UnknownError.
+func KindOf(err error) ErrorKind {
+	var failures Errors
+	if errors.As(err, &failures) && len(failures) > 0 {
+		return KindOf(failures[0])
+	}
+
+	var e Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+
+	var problems ValidationErrors
+	if errors.As(err, &problems) {
+		return ParseError
+	}
+
+	return UnknownError
+}
@@ -0,0 +1,55 @@
+package cloudnative_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testErrors(t *testing.T, when spec.G, it spec.S) {
+	var Expect func(interface{}, ...interface{}) Assertion
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+	})
+
+	when("NewError", func() {
+		it("formats the message and wraps the cause", func() {
+			cause := errors.New("connection refused")
+			err := cloudnative.NewError(cloudnative.DownloadError, cause, "failed to download %s", "some-id")
+
+			Expect(err).To(MatchError("failed to download some-id: connection refused"))
+			Expect(errors.Is(err, cause)).To(BeTrue())
+		})
+	})
+
+	when("KindOf", func() {
+		it("returns the kind of a wrapped error", func() {
+			err := cloudnative.NewError(cloudnative.BuildError, errors.New("jam failed"), "failed to build")
+			Expect(cloudnative.KindOf(fmt.Errorf("outer: %w", err))).To(Equal(cloudnative.BuildError))
+		})
+
+		it("treats validation problems as parse errors", func() {
+			err := cloudnative.ValidationErrors{{Path: "buildpack.toml", Message: "no lifecycle"}}
+			Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.ParseError))
+		})
+
+		it("uses the kind of the first of several failures", func() {
+			err := cloudnative.Errors{
+				cloudnative.NewError(cloudnative.DownloadError, errors.New("404"), "failed to download a"),
+				cloudnative.NewError(cloudnative.BuildError, errors.New("exit 1"), "failed to build b"),
+			}
+			Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.DownloadError))
+			Expect(err).To(MatchError("2 failures:\nfailed to download a: 404\nfailed to build b: exit 1"))
+		})
+
+		it("returns UnknownError for other errors", func() {
+			Expect(cloudnative.KindOf(errors.New("some-error"))).To(Equal(cloudnative.UnknownError))
+		})
+	})
+}
@@ -0,0 +1,115 @@
+package cloudnative
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/paketo-buildpacks/packit/pexec"
+)
+
+const gitPrefix = "git+"
+
+var commitPattern = regexp.MustCompile(`^([a-f0-9]{40}|[a-f0-9]{64})$`)
+
+// IsGitSource reports whether uri names a git repository, as
+// git+https://<repository>#<ref> or git+file://<repository>#<ref>.
+func IsGitSource(uri string) bool {
+	return strings.HasPrefix(uri, gitPrefix)
+}
+
+// ParseGitSource splits a git source into the repository to clone and the
+// commit, branch or tag to check out.
+func ParseGitSource(uri string) (string, string, error) {
+	if !IsGitSource(uri) {
+		return "", "", NewError(ParseError, nil, "%s is not a git source", uri)
+	}
+
+	repository := strings.TrimPrefix(uri, gitPrefix)
+	i := strings.LastIndex(repository, "#")
+	if i < 0 || i == len(repository)-1 {
+		return "", "", NewError(ParseError, nil, "git source %s must name a commit or ref after #", uri)
+	}
+
+	return repository[:i], repository[i+1:], nil
+}
+
+// CheckoutGitSource checks the tree of a git source out into dir, without
+// its .git directory. When the source names a full commit SHA the checked
+// out commit is verified against it. It returns the source pinned to the
+// commit that was checked out.
+func CheckoutGitSource(uri, dir string) (string, error) {
+	repository, ref, err := ParseGitSource(uri)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	git := pexec.NewExecutable("git")
+	run := func(args ...string) (string, error) {
+		stdout, stderr := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+		err := git.Execute(pexec.Execution{
+			Args:   append([]string{"-C", dir}, args...),
+			Stdout: stdout,
+			Stderr: stderr,
+		})
+		if err != nil {
+			return "", fmt.Errorf("git %s failed: %s: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimSpace(stdout.String()), nil
+	}
+
+	if _, err := run("init", "--quiet"); err != nil {
+		return "", NewError(DownloadError, err, "failed to clone %s", repository)
+	}
+
+	if _, err := run("remote", "add", "origin", repository); err != nil {
+		return "", NewError(DownloadError, err, "failed to clone %s", repository)
+	}
+
+	// a shallow fetch of the ref is enough when the server allows it,
+	// otherwise fetch every branch and tag and look the ref up among them
+	commit := "FETCH_HEAD"
+	if _, err := run("fetch", "--quiet", "--depth", "1", "origin", ref); err != nil {
+		if _, err := run("fetch", "--quiet", "--tags", "origin", "+refs/heads/*:refs/remotes/origin/*"); err != nil {
+			return "", NewError(DownloadError, err, "failed to clone %s", repository)
+		}
+
+		commit = ""
+		for _, candidate := range []string{ref, "origin/" + ref} {
+			if resolved, err := run("rev-parse", "--verify", "--quiet", candidate+"^{commit}"); err == nil {
+				commit = resolved
+				break
+			}
+		}
+
+		if commit == "" {
+			return "", NewError(DownloadError, nil, "%s has no commit or ref %q", repository, ref)
+		}
+	}
+
+	if _, err := run("checkout", "--quiet", "--detach", commit); err != nil {
+		return "", NewError(DownloadError, err, "failed to check out %s of %s", ref, repository)
+	}
+
+	head, err := run("rev-parse", "HEAD")
+	if err != nil {
+		return "", NewError(DownloadError, err, "failed to check out %s of %s", ref, repository)
+	}
+
+	if commitPattern.MatchString(ref) && head != ref {
+		return "", NewError(DownloadError, nil, "commit mismatch for %s: expected %s, got %s", repository, ref, head)
+	}
+
+	if err := os.RemoveAll(filepath.Join(dir, ".git")); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s%s#%s", gitPrefix, repository, head), nil
+}
@@ -0,0 +1,116 @@
+package cloudnative_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testGitSource(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		tmpDir     string
+		repository string
+		first      string
+		second     string
+	)
+
+	git := func(args ...string) string {
+		command := exec.Command("git", append([]string{"-C", repository, "-c", "user.name=cnb2cf", "-c", "user.email=cnb2cf@example.com"}, args...)...)
+		output, err := command.CombinedOutput()
+		Expect(err).NotTo(HaveOccurred(), string(output))
+		return strings.TrimSpace(string(output))
+	}
+
+	commit := func(contents string) string {
+		Expect(ioutil.WriteFile(filepath.Join(repository, "buildpack.toml"), []byte(contents), 0644)).To(Succeed())
+		git("add", "buildpack.toml")
+		git("commit", "--quiet", "-m", contents)
+		return git("rev-parse", "HEAD")
+	}
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "git-source")
+		Expect(err).NotTo(HaveOccurred())
+
+		repository = filepath.Join(tmpDir, "repository")
+		Expect(os.MkdirAll(repository, 0755)).To(Succeed())
+		git("init", "--quiet")
+		git("checkout", "--quiet", "-b", "main")
+
+		first = commit("first")
+		git("checkout", "--quiet", "-b", "feature")
+		second = commit("second")
+		git("checkout", "--quiet", "main")
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	when("ParseGitSource", func() {
+		it("splits the repository from the ref", func() {
+			repo, ref, err := cloudnative.ParseGitSource("git+https://github.com/some-org/some-cnb#some-branch")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(repo).To(Equal("https://github.com/some-org/some-cnb"))
+			Expect(ref).To(Equal("some-branch"))
+		})
+
+		when("there is no ref", func() {
+			it("returns a parse error", func() {
+				_, _, err := cloudnative.ParseGitSource("git+https://github.com/some-org/some-cnb")
+				Expect(err).To(MatchError("git source git+https://github.com/some-org/some-cnb must name a commit or ref after #"))
+				Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.ParseError))
+			})
+		})
+	})
+
+	when("CheckoutGitSource", func() {
+		var dir string
+
+		it.Before(func() {
+			dir = filepath.Join(tmpDir, "checkout")
+		})
+
+		it("checks out a pinned commit", func() {
+			pinned, err := cloudnative.CheckoutGitSource("git+file://"+repository+"#"+first, dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pinned).To(Equal("git+file://" + repository + "#" + first))
+
+			contents, err := ioutil.ReadFile(filepath.Join(dir, "buildpack.toml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("first"))
+			Expect(filepath.Join(dir, ".git")).NotTo(BeADirectory())
+		})
+
+		it("checks out a branch and pins it to its commit", func() {
+			pinned, err := cloudnative.CheckoutGitSource("git+file://"+repository+"#feature", dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pinned).To(Equal("git+file://" + repository + "#" + second))
+
+			contents, err := ioutil.ReadFile(filepath.Join(dir, "buildpack.toml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("second"))
+		})
+
+		when("the commit does not exist", func() {
+			it("returns a download error", func() {
+				_, err := cloudnative.CheckoutGitSource("git+file://"+repository+"#0000000000000000000000000000000000000000", dir)
+				Expect(err).To(MatchError(ContainSubstring(`has no commit or ref "0000000000000000000000000000000000000000"`)))
+				Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.DownloadError))
+			})
+		})
+	})
+}
@@ -0,0 +1,309 @@
+package cloudnative
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const (
+	dockerScheme = "docker://"
+	ociScheme    = "oci://"
+
+	buildpackLayersLabel = "io.buildpacks.buildpack.layers"
+)
+
+// ImageBuildpack is a buildpack found in the layers of a CNB image.
+type ImageBuildpack struct {
+	ID      string
+	Version string
+	Stacks  []string
+}
+
+type buildpackLayer struct {
+	LayerDiffID string `json:"layerDiffID"`
+	Stacks      []struct {
+		ID string `json:"id"`
+	} `json:"stacks"`
+}
+
+// IsImageReference reports whether uri names an OCI image, either in a
+// registry (docker://<reference>) or in an OCI layout directory on disk
+// (oci://<path>[@<digest>]).
+func IsImageReference(uri string) bool {
+	return strings.HasPrefix(uri, dockerScheme) || strings.HasPrefix(uri, ociScheme)
+}
+
+// IsBuildpackage reports whether uri names a .cnb buildpackage archive, as
+// written by pack buildpack package --format file.
+func IsBuildpackage(uri string) bool {
+	return strings.HasSuffix(uri, ".cnb")
+}
+
+// ExtractBuildpackage unpacks the OCI layout held in the .cnb buildpackage
+// archive at path into dir, so that it can be read as an oci:// image.
+func ExtractBuildpackage(path, dir string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return NewError(ArchiveError, err, "failed to read buildpackage %s", path)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// the layout only holds regular files, so cleaning the rooted name keeps them inside dir
+		destination := filepath.Join(dir, filepath.Clean("/"+header.Name))
+		if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+			return err
+		}
+
+		output, err := os.Create(destination)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(output, tr)
+		output.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err != nil {
+		return NewError(ArchiveError, err, "%s is not a buildpackage", path)
+	}
+
+	return nil
+}
+
+// ImageBuildpacks lists the buildpacks in image, ordered by id and version.
+func ImageBuildpacks(image v1.Image) ([]ImageBuildpack, error) {
+	layers, err := buildpackLayers(image)
+	if err != nil {
+		return nil, err
+	}
+
+	var buildpacks []ImageBuildpack
+	for id, versions := range layers {
+		for version, layer := range versions {
+			buildpack := ImageBuildpack{ID: id, Version: version}
+			for _, stack := range layer.Stacks {
+				buildpack.Stacks = append(buildpack.Stacks, stack.ID)
+			}
+			buildpacks = append(buildpacks, buildpack)
+		}
+	}
+
+	sort.Slice(buildpacks, func(i, j int) bool {
+		if buildpacks[i].ID != buildpacks[j].ID {
+			return buildpacks[i].ID < buildpacks[j].ID
+		}
+		return buildpacks[i].Version < buildpacks[j].Version
+	})
+
+	return buildpacks, nil
+}
+
+func buildpackLayers(image v1.Image) (map[string]map[string]buildpackLayer, error) {
+	config, err := image.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	var layers map[string]map[string]buildpackLayer
+	if err := json.Unmarshal([]byte(config.Config.Labels[buildpackLayersLabel]), &layers); err != nil {
+		return nil, fmt.Errorf("image has no valid %s label: %s", buildpackLayersLabel, err)
+	}
+
+	return layers, nil
+}
+
+// ResolveImage returns the image that reference names, along with the
+// reference pinned to the digest of the image.
+func ResolveImage(reference string) (v1.Image, string, error) {
+	switch {
+	case strings.HasPrefix(reference, dockerScheme):
+		ref, err := name.ParseReference(strings.TrimPrefix(reference, dockerScheme))
+		if err != nil {
+			return nil, "", NewError(ParseError, err, "invalid image reference %s", reference)
+		}
+
+		image, err := remote.Image(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+		if err != nil {
+			return nil, "", NewError(DownloadError, err, "failed to fetch image %s", reference)
+		}
+
+		digest, err := image.Digest()
+		if err != nil {
+			return nil, "", NewError(DownloadError, err, "failed to fetch image %s", reference)
+		}
+
+		return image, fmt.Sprintf("%s%s@%s", dockerScheme, ref.Context().Name(), digest), nil
+
+	case strings.HasPrefix(reference, ociScheme):
+		path := strings.TrimPrefix(reference, ociScheme)
+
+		var digest string
+		if i := strings.LastIndex(path, "@"); i >= 0 {
+			path, digest = path[:i], path[i+1:]
+		}
+
+		image, err := readLayoutImage(path, digest)
+		if err != nil {
+			return nil, "", NewError(ParseError, err, "failed to read image %s", reference)
+		}
+
+		imageDigest, err := image.Digest()
+		if err != nil {
+			return nil, "", NewError(ParseError, err, "failed to read image %s", reference)
+		}
+
+		return image, fmt.Sprintf("%s%s@%s", ociScheme, path, imageDigest), nil
+	}
+
+	return nil, "", NewError(ParseError, nil, "%s is not an image reference", reference)
+}
+
+// ExportBuildpackImage writes the layer that holds the buildpack id@version
+// in image to a CNB tarball at destination, with buildpack.toml at its root.
+// It returns the SHA256 of the tarball.
+func ExportBuildpackImage(image v1.Image, id, version, destination string) (string, error) {
+	layers, err := buildpackLayers(image)
+	if err != nil {
+		return "", err
+	}
+
+	layerInfo, ok := layers[id][version]
+	if !ok {
+		return "", fmt.Errorf("image does not contain buildpack %s@%s", id, version)
+	}
+
+	diffID, err := v1.NewHash(layerInfo.LayerDiffID)
+	if err != nil {
+		return "", err
+	}
+
+	layer, err := image.LayerByDiffID(diffID)
+	if err != nil {
+		return "", err
+	}
+
+	contents, err := layer.Uncompressed()
+	if err != nil {
+		return "", err
+	}
+	defer contents.Close()
+
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return "", err
+	}
+
+	output, err := os.Create(destination)
+	if err != nil {
+		return "", err
+	}
+	defer output.Close()
+
+	hash := sha256.New()
+	gw := gzip.NewWriter(io.MultiWriter(output, hash))
+	tw := tar.NewWriter(gw)
+
+	prefix := fmt.Sprintf("cnb/buildpacks/%s/%s/", strings.Replace(id, "/", "_", -1), version)
+	found := false
+
+	tr := tar.NewReader(contents)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+
+		path := strings.TrimPrefix(strings.TrimPrefix(header.Name, "/"), "./")
+		if !strings.HasPrefix(path, prefix) || path == prefix {
+			continue
+		}
+
+		header.Name = strings.TrimPrefix(path, prefix)
+		if err := tw.WriteHeader(header); err != nil {
+			return "", err
+		}
+
+		if _, err := io.Copy(tw, tr); err != nil {
+			return "", err
+		}
+
+		found = true
+	}
+
+	if !found {
+		return "", fmt.Errorf("layer %s does not contain buildpack %s@%s", diffID, id, version)
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+
+	if err := gw.Close(); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// readLayoutImage reads the image with digest from the OCI layout at path,
+// or its only image when no digest is given.
+func readLayoutImage(path, digest string) (v1.Image, error) {
+	index, err := layout.ImageIndexFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	var descriptors []v1.Descriptor
+	for _, descriptor := range manifest.Manifests {
+		if digest == "" || descriptor.Digest.String() == digest {
+			descriptors = append(descriptors, descriptor)
+		}
+	}
+
+	switch {
+	case len(descriptors) == 0 && digest != "":
+		return nil, fmt.Errorf("no image with digest %s", digest)
+	case len(descriptors) != 1:
+		return nil, errors.New("layout must contain exactly one image, or the image digest must be given")
+	}
+
+	return index.Image(descriptors[0].Digest)
+}
@@ -0,0 +1,222 @@
+package cloudnative_test
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+const layoutDigest = "sha256:555d6b34370ae46cd801311898a47b03d5464dda85f29d46135c7b841df40515"
+
+func testImage(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		tmpDir     string
+		layoutPath string
+	)
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "image")
+		Expect(err).NotTo(HaveOccurred())
+
+		layoutPath, err = filepath.Abs(filepath.Join("testdata", "oci-layout"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	// buildpackage tars up the layout fixture the way pack writes a .cnb file
+	buildpackage := func(layout string) string {
+		path := filepath.Join(tmpDir, "buildpackage.cnb")
+		file, err := os.Create(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close()
+
+		tw := tar.NewWriter(file)
+		defer tw.Close()
+
+		Expect(filepath.Walk(layout, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			name, err := filepath.Rel(layout, path)
+			if err != nil || name == "." {
+				return err
+			}
+
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			header.Name = filepath.ToSlash(name)
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+
+			contents, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer contents.Close()
+
+			_, err = io.Copy(tw, contents)
+			return err
+		})).To(Succeed())
+
+		return path
+	}
+
+	when("IsImageReference", func() {
+		it("recognises registry references and layout directories", func() {
+			Expect(cloudnative.IsImageReference("docker://gcr.io/paketo-buildpacks/node-engine:1.2.3")).To(BeTrue())
+			Expect(cloudnative.IsImageReference("oci:///some/layout")).To(BeTrue())
+			Expect(cloudnative.IsImageReference("https://example.com/node-engine.tgz")).To(BeFalse())
+			Expect(cloudnative.IsImageReference("file:///some/node-engine/")).To(BeFalse())
+		})
+	})
+
+	when("ResolveImage", func() {
+		it("pins a layout directory to the digest of its image", func() {
+			_, pinned, err := cloudnative.ResolveImage("oci://" + layoutPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pinned).To(Equal("oci://" + layoutPath + "@" + layoutDigest))
+		})
+
+		it("accepts a layout directory that is already pinned", func() {
+			_, pinned, err := cloudnative.ResolveImage("oci://" + layoutPath + "@" + layoutDigest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pinned).To(Equal("oci://" + layoutPath + "@" + layoutDigest))
+		})
+
+		when("the digest does not match the layout", func() {
+			it("returns a parse error", func() {
+				_, _, err := cloudnative.ResolveImage("oci://" + layoutPath + "@sha256:0000000000000000000000000000000000000000000000000000000000000000")
+				Expect(err).To(MatchError(ContainSubstring("no image with digest")))
+				Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.ParseError))
+			})
+		})
+
+		when("the layout does not exist", func() {
+			it("returns an error", func() {
+				_, _, err := cloudnative.ResolveImage("oci://" + filepath.Join(tmpDir, "missing"))
+				Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
+			})
+		})
+	})
+
+	when("IsBuildpackage", func() {
+		it("recognises .cnb archives", func() {
+			Expect(cloudnative.IsBuildpackage("https://example.com/node-engine-1.2.3.cnb")).To(BeTrue())
+			Expect(cloudnative.IsBuildpackage("file:///some/node-engine.tgz")).To(BeFalse())
+		})
+	})
+
+	when("ExtractBuildpackage", func() {
+		it("unpacks the layout so that it can be read as an image", func() {
+			layout := filepath.Join(tmpDir, "layout")
+			Expect(cloudnative.ExtractBuildpackage(buildpackage(layoutPath), layout)).To(Succeed())
+
+			_, pinned, err := cloudnative.ResolveImage("oci://" + layout)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pinned).To(Equal("oci://" + layout + "@" + layoutDigest))
+		})
+
+		when("the archive does not hold a layout", func() {
+			it("returns an archive error", func() {
+				extracted := filepath.Join(tmpDir, "extracted")
+				Expect(os.MkdirAll(extracted, 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(extracted, "buildpack.toml"), []byte(""), 0644)).To(Succeed())
+
+				err := cloudnative.ExtractBuildpackage(buildpackage(extracted), filepath.Join(tmpDir, "layout"))
+				Expect(err).To(MatchError(ContainSubstring("is not a buildpackage")))
+				Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.ArchiveError))
+			})
+		})
+	})
+
+	when("ImageBuildpacks", func() {
+		it("lists the buildpacks in the image", func() {
+			image, _, err := cloudnative.ResolveImage("oci://" + layoutPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			buildpacks, err := cloudnative.ImageBuildpacks(image)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buildpacks).To(Equal([]cloudnative.ImageBuildpack{
+				{ID: "org.cloudfoundry.node-engine", Version: "1.2.3", Stacks: []string{"org.cloudfoundry.stacks.cflinuxfs3"}},
+				{ID: "org.cloudfoundry.npm", Version: "0.4.5", Stacks: []string{"org.cloudfoundry.stacks.cflinuxfs3"}},
+			}))
+		})
+	})
+
+	when("ExportBuildpackImage", func() {
+		it("writes the buildpack layer as a CNB tarball", func() {
+			image, _, err := cloudnative.ResolveImage("oci://" + layoutPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			destination := filepath.Join(tmpDir, "node-engine.tgz")
+			checksum, err := cloudnative.ExportBuildpackImage(image, "org.cloudfoundry.node-engine", "1.2.3", destination)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(destination)
+			Expect(err).NotTo(HaveOccurred())
+			sum := sha256.Sum256(contents)
+			Expect(checksum).To(Equal(hex.EncodeToString(sum[:])))
+
+			extracted := filepath.Join(tmpDir, "extracted")
+			Expect(libbuildpack.ExtractTarGz(destination, extracted)).To(Succeed())
+			Expect(filepath.Join(extracted, "bin", "build")).To(BeARegularFile())
+
+			buildpack, err := cloudnative.ParseBuildpack(filepath.Join(extracted, "buildpack.toml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buildpack.Info.ID).To(Equal("org.cloudfoundry.node-engine"))
+		})
+
+		it("picks the layer for the requested buildpack", func() {
+			image, _, err := cloudnative.ResolveImage("oci://" + layoutPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			destination := filepath.Join(tmpDir, "npm.tgz")
+			_, err = cloudnative.ExportBuildpackImage(image, "org.cloudfoundry.npm", "0.4.5", destination)
+			Expect(err).NotTo(HaveOccurred())
+
+			extracted := filepath.Join(tmpDir, "extracted")
+			Expect(libbuildpack.ExtractTarGz(destination, extracted)).To(Succeed())
+
+			buildpack, err := cloudnative.ParseBuildpack(filepath.Join(extracted, "buildpack.toml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buildpack.Info.ID).To(Equal("org.cloudfoundry.npm"))
+		})
+
+		when("the image does not contain the buildpack", func() {
+			it("returns an error", func() {
+				image, _, err := cloudnative.ResolveImage("oci://" + layoutPath)
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = cloudnative.ExportBuildpackImage(image, "org.cloudfoundry.node-engine", "9.9.9", filepath.Join(tmpDir, "node-engine.tgz"))
+				Expect(err).To(MatchError("image does not contain buildpack org.cloudfoundry.node-engine@9.9.9"))
+			})
+		})
+	})
+}
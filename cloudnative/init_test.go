@@ -16,6 +16,21 @@ func TestUnitCloudNative(t *testing.T) {
 	suite("LifecycleHooks", testLifecycleHooks)
 	suite("Filesystem", testFilesystem)
 	suite("Environment", testEnvironment)
+	suite("ShimmedBuildpack", testShimmedBuildpack)
+	suite("Validation", testValidation)
+	suite("Errors", testErrors)
+	suite("DownloadCache", testDownloadCache)
+	suite("Credentials", testCredentials)
+	suite("Image", testImage)
+	suite("GitSource", testGitSource)
+	suite("Lockfile", testLockfile)
+	suite("Reproducible", testReproducible)
+	suite("SBOM", testSBOM)
+	suite("ReleaseIndex", testReleaseIndex)
+	suite("Update", testUpdate)
+	suite("BuildpackDiff", testBuildpackDiff)
+	suite("ReleaseNotes", testReleaseNotes)
+	suite("Signature", testSignature)
 
 	suite.Run(t)
 }
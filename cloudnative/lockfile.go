@@ -0,0 +1,167 @@
+package cloudnative
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const LockfileName = "cnb2cf.lock"
+
+// Lockfile records every dependency that went into a shimmed buildpack, so
+// that a later run can check that it produces exactly the same CNBs.
+type Lockfile struct {
+	Dependencies []LockedDependency `toml:"dependencies"`
+}
+
+// LockedDependency is a dependency as it was packaged for one stack.
+// BuildTool is empty for CNBs that were packaged as they were downloaded,
+// and Parent names the meta-buildpack that a child CNB was packaged for.
+type LockedDependency struct {
+	ID           string `toml:"id"`
+	Version      string `toml:"version"`
+	Stack        string `toml:"stack"`
+	Parent       string `toml:"parent,omitempty"`
+	Source       string `toml:"source,omitempty"`
+	SourceSHA256 string `toml:"source_sha256,omitempty"`
+	SHA256       string `toml:"sha256"`
+	BuildTool    string `toml:"build_tool,omitempty"`
+}
+
+func (d LockedDependency) key() string {
+	return strings.Join([]string{d.Stack, d.Parent, d.ID, d.Version}, "|")
+}
+
+func (d LockedDependency) String() string {
+	name := fmt.Sprintf("%s %s for %s", d.ID, d.Version, d.Stack)
+	if d.Parent != "" {
+		name = fmt.Sprintf("%s (in %s)", name, d.Parent)
+	}
+	return name
+}
+
+func ReadLockfile(path string) (Lockfile, error) {
+	var lockfile Lockfile
+	if _, err := toml.DecodeFile(path, &lockfile); err != nil {
+		return Lockfile{}, NewError(ParseError, err, "failed to parse %s", path)
+	}
+
+	return lockfile, nil
+}
+
+func WriteLockfile(lockfile Lockfile, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return toml.NewEncoder(file).Encode(lockfile)
+}
+
+// Stack returns the entries of the lockfile for stack.
+func (l Lockfile) Stack(stack string) Lockfile {
+	var locked Lockfile
+	for _, dependency := range l.Dependencies {
+		if dependency.Stack == stack {
+			locked.Dependencies = append(locked.Dependencies, dependency)
+		}
+	}
+	return locked
+}
+
+// VerifySources returns an error describing every dependency declared for
+// packaging whose source differs from the lockfile, so that a changed source
+// is caught before anything is downloaded or built. Git and image sources are
+// only pinned to a commit or digest while packaging, so Verify checks them
+// afterwards instead.
+func (l Lockfile) VerifySources(declared Lockfile) error {
+	locked := map[string]LockedDependency{}
+	for _, dependency := range l.Dependencies {
+		locked[dependency.key()] = dependency
+	}
+
+	var differences []string
+	for _, dependency := range declared.Dependencies {
+		expected, ok := locked[dependency.key()]
+		if !ok {
+			differences = append(differences, fmt.Sprintf("%s is not in the lockfile", dependency))
+			continue
+		}
+
+		if isPinnedWhilePackaging(dependency.Source) || isPinnedWhilePackaging(expected.Source) {
+			continue
+		}
+
+		for _, field := range []struct{ name, expected, actual string }{
+			{"source", expected.Source, dependency.Source},
+			{"source_sha256", expected.SourceSHA256, dependency.SourceSHA256},
+		} {
+			if field.expected != field.actual {
+				differences = append(differences, fmt.Sprintf("%s has %s %q, expected %q", dependency, field.name, field.actual, field.expected))
+			}
+		}
+	}
+
+	if len(differences) > 0 {
+		return NewError(BuildError, errors.New(strings.Join(differences, "\n")), "dependency sources diverge from the lockfile")
+	}
+
+	return nil
+}
+
+// Verify returns an error describing every way that packaged diverges from
+// the lockfile, or nil if it matches. CNBs built from source are only byte
+// for byte the same when they are normalized, so their sha256 is compared
+// only when reproducible is set.
+func (l Lockfile) Verify(packaged Lockfile, reproducible bool) error {
+	locked := map[string]LockedDependency{}
+	for _, dependency := range l.Dependencies {
+		locked[dependency.key()] = dependency
+	}
+
+	var differences []string
+	for _, dependency := range packaged.Dependencies {
+		expected, ok := locked[dependency.key()]
+		if !ok {
+			differences = append(differences, fmt.Sprintf("%s is not in the lockfile", dependency))
+			continue
+		}
+		delete(locked, dependency.key())
+
+		built := expected.BuildTool != "" || dependency.BuildTool != ""
+		for _, field := range []struct{ name, expected, actual string }{
+			{"source", expected.Source, dependency.Source},
+			{"source_sha256", expected.SourceSHA256, dependency.SourceSHA256},
+			{"sha256", expected.SHA256, dependency.SHA256},
+			{"build_tool", expected.BuildTool, dependency.BuildTool},
+		} {
+			if field.name == "sha256" && built && !reproducible {
+				continue
+			}
+
+			if field.expected != field.actual {
+				differences = append(differences, fmt.Sprintf("%s has %s %q, expected %q", dependency, field.name, field.actual, field.expected))
+			}
+		}
+	}
+
+	for _, dependency := range l.Dependencies {
+		if _, ok := locked[dependency.key()]; ok {
+			differences = append(differences, fmt.Sprintf("%s was not packaged", dependency))
+		}
+	}
+
+	if len(differences) > 0 {
+		return NewError(BuildError, errors.New(strings.Join(differences, "\n")), "packaged dependencies diverge from the lockfile")
+	}
+
+	return nil
+}
+
+func isPinnedWhilePackaging(source string) bool {
+	return IsGitSource(source) || IsImageReference(source)
+}
@@ -0,0 +1,184 @@
+package cloudnative_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testLockfile(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		tmpDir   string
+		lockfile cloudnative.Lockfile
+	)
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "lockfile")
+		Expect(err).NotTo(HaveOccurred())
+
+		lockfile = cloudnative.Lockfile{Dependencies: []cloudnative.LockedDependency{
+			{
+				ID:           "org.cloudfoundry.nodejs",
+				Version:      "1.0.0",
+				Stack:        "cflinuxfs3",
+				Source:       "https://example.com/nodejs-source.tgz",
+				SourceSHA256: "some-source-sha",
+				SHA256:       "some-nodejs-sha",
+				BuildTool:    "jam",
+			},
+			{
+				ID:      "org.cloudfoundry.node-engine",
+				Version: "1.2.3",
+				Stack:   "cflinuxfs3",
+				Parent:  "org.cloudfoundry.nodejs",
+				SHA256:  "some-node-engine-sha",
+			},
+			{
+				ID:      "org.cloudfoundry.node-engine",
+				Version: "1.2.3",
+				Stack:   "cflinuxfs4",
+				Parent:  "org.cloudfoundry.nodejs",
+				SHA256:  "some-node-engine-sha",
+			},
+		}}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	when("WriteLockfile", func() {
+		it("writes a lockfile that can be read back", func() {
+			path := filepath.Join(tmpDir, cloudnative.LockfileName)
+			Expect(cloudnative.WriteLockfile(lockfile, path)).To(Succeed())
+
+			read, err := cloudnative.ReadLockfile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(read).To(Equal(lockfile))
+		})
+	})
+
+	when("ReadLockfile", func() {
+		when("the lockfile is missing", func() {
+			it("returns a parse error", func() {
+				_, err := cloudnative.ReadLockfile(filepath.Join(tmpDir, "missing.lock"))
+				Expect(err).To(MatchError(ContainSubstring("failed to parse")))
+				Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.ParseError))
+			})
+		})
+	})
+
+	when("Stack", func() {
+		it("returns the entries for the stack", func() {
+			Expect(lockfile.Stack("cflinuxfs4").Dependencies).To(Equal(lockfile.Dependencies[2:]))
+		})
+	})
+
+	when("Verify", func() {
+		var locked cloudnative.Lockfile
+
+		it.Before(func() {
+			locked = lockfile.Stack("cflinuxfs3")
+		})
+
+		it("accepts packaged dependencies that match", func() {
+			packaged := cloudnative.Lockfile{Dependencies: []cloudnative.LockedDependency{
+				locked.Dependencies[1],
+				locked.Dependencies[0],
+			}}
+
+			Expect(locked.Verify(packaged, true)).To(Succeed())
+		})
+
+		it("reports every difference", func() {
+			changed := locked.Dependencies[0]
+			changed.SHA256 = "some-other-sha"
+			changed.BuildTool = "cnbpackager"
+
+			extra := locked.Dependencies[1]
+			extra.Version = "2.0.0"
+
+			err := locked.Verify(cloudnative.Lockfile{Dependencies: []cloudnative.LockedDependency{changed, extra}}, true)
+			Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.BuildError))
+			Expect(err).To(MatchError(ContainSubstring("packaged dependencies diverge from the lockfile")))
+			Expect(err).To(MatchError(ContainSubstring(`org.cloudfoundry.nodejs 1.0.0 for cflinuxfs3 has sha256 "some-other-sha", expected "some-nodejs-sha"`)))
+			Expect(err).To(MatchError(ContainSubstring(`org.cloudfoundry.nodejs 1.0.0 for cflinuxfs3 has build_tool "cnbpackager", expected "jam"`)))
+			Expect(err).To(MatchError(ContainSubstring("org.cloudfoundry.node-engine 2.0.0 for cflinuxfs3 (in org.cloudfoundry.nodejs) is not in the lockfile")))
+			Expect(err).To(MatchError(ContainSubstring("org.cloudfoundry.node-engine 1.2.3 for cflinuxfs3 (in org.cloudfoundry.nodejs) was not packaged")))
+		})
+
+		when("the packaging is not reproducible", func() {
+			it("ignores the sha256 of built CNBs, but not of downloaded ones", func() {
+				built := locked.Dependencies[0]
+				built.SHA256 = "some-rebuilt-sha"
+
+				Expect(locked.Verify(cloudnative.Lockfile{Dependencies: []cloudnative.LockedDependency{built, locked.Dependencies[1]}}, false)).To(Succeed())
+
+				downloaded := locked.Dependencies[1]
+				downloaded.SHA256 = "some-other-sha"
+
+				err := locked.Verify(cloudnative.Lockfile{Dependencies: []cloudnative.LockedDependency{built, downloaded}}, false)
+				Expect(err).To(MatchError(ContainSubstring(`has sha256 "some-other-sha", expected "some-node-engine-sha"`)))
+				Expect(err).NotTo(MatchError(ContainSubstring("some-rebuilt-sha")))
+			})
+		})
+	})
+
+	when("VerifySources", func() {
+		var (
+			locked   cloudnative.Lockfile
+			declared cloudnative.LockedDependency
+		)
+
+		it.Before(func() {
+			locked = lockfile.Stack("cflinuxfs3")
+			declared = cloudnative.LockedDependency{
+				ID:           "org.cloudfoundry.nodejs",
+				Version:      "1.0.0",
+				Stack:        "cflinuxfs3",
+				Source:       "https://example.com/nodejs-source.tgz",
+				SourceSHA256: "some-source-sha",
+			}
+		})
+
+		it("accepts declared sources that match", func() {
+			Expect(locked.VerifySources(cloudnative.Lockfile{Dependencies: []cloudnative.LockedDependency{declared}})).To(Succeed())
+		})
+
+		it("reports changed and unknown sources", func() {
+			changed := declared
+			changed.Source = "https://example.com/nodejs-other-source.tgz"
+			changed.SourceSHA256 = "some-other-source-sha"
+
+			unknown := declared
+			unknown.Version = "2.0.0"
+
+			err := locked.VerifySources(cloudnative.Lockfile{Dependencies: []cloudnative.LockedDependency{changed, unknown}})
+			Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.BuildError))
+			Expect(err).To(MatchError(ContainSubstring("dependency sources diverge from the lockfile")))
+			Expect(err).To(MatchError(ContainSubstring(`org.cloudfoundry.nodejs 1.0.0 for cflinuxfs3 has source "https://example.com/nodejs-other-source.tgz", expected "https://example.com/nodejs-source.tgz"`)))
+			Expect(err).To(MatchError(ContainSubstring(`has source_sha256 "some-other-source-sha", expected "some-source-sha"`)))
+			Expect(err).To(MatchError(ContainSubstring("org.cloudfoundry.nodejs 2.0.0 for cflinuxfs3 is not in the lockfile")))
+		})
+
+		it("leaves git and image sources to be checked once they are pinned", func() {
+			locked.Dependencies[0].Source = "git+https://github.com/cloudfoundry/nodejs-cnb#0123456789abcdef"
+			locked.Dependencies[0].SourceSHA256 = ""
+			declared.Source = "git+https://github.com/cloudfoundry/nodejs-cnb#main"
+			declared.SourceSHA256 = ""
+
+			Expect(locked.VerifySources(cloudnative.Lockfile{Dependencies: []cloudnative.LockedDependency{declared}})).To(Succeed())
+		})
+	})
+}
@@ -9,6 +9,7 @@ import (
 
 type Manifest struct {
 	Language     string               `yaml:"language"`
+	Stack        string               `yaml:"stack,omitempty"`
 	IncludeFiles []string             `yaml:"include_files"`
 	Dependencies []ManifestDependency `yaml:"dependencies"`
 }
@@ -21,6 +22,7 @@ type ManifestDependency struct {
 	Version      string   `yaml:"version"`
 	Source       string   `yaml:"source"`
 	SourceSHA256 string   `yaml:"source_sha256"`
+	File         string   `yaml:"file,omitempty"`
 }
 
 func UpdateStacks(stacks []string) []string {
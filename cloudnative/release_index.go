@@ -0,0 +1,190 @@
+package cloudnative
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// Release is a version of a dependency, with the CNB and source that it
+// was released as.
+type Release struct {
+	Version      string
+	URI          string
+	SHA256       string
+	Source       string
+	SourceSHA256 string
+}
+
+// ReleaseIndex finds the releases of dependencies.
+type ReleaseIndex interface {
+	// Latest returns the newest release of the dependency, reporting false
+	// if the index does not list it.
+	Latest(id string) (Release, bool, error)
+}
+
+// Fetcher downloads files whose checksum is not known in advance.
+type Fetcher interface {
+	Fetch(uri, destination string) error
+}
+
+type gitHubRelease struct {
+	TagName    string        `json:"tag_name"`
+	Draft      bool          `json:"draft"`
+	Prerelease bool          `json:"prerelease"`
+	TarballURL string        `json:"tarball_url"`
+	Assets     []gitHubAsset `json:"assets"`
+}
+
+type gitHubAsset struct {
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+	Digest             string `json:"digest"`
+}
+
+// GitHubReleaseIndex is a JSON document that lists the releases of each
+// dependency id in the form that the GitHub releases API returns them.
+// The CNB is the .tgz or .cnb asset of a release, and the source is the
+// asset with "source" in its name or else the release tarball. Checksums
+// are taken from the digest of an asset, or computed by downloading it.
+type GitHubReleaseIndex struct {
+	releases map[string][]gitHubRelease
+	fetcher  Fetcher
+}
+
+// NewGitHubReleaseIndex reads the index at uri.
+func NewGitHubReleaseIndex(uri string, fetcher Fetcher) (GitHubReleaseIndex, error) {
+	dir, err := ioutil.TempDir("", "release-index")
+	if err != nil {
+		return GitHubReleaseIndex{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "index.json")
+	if err := fetcher.Fetch(uri, path); err != nil {
+		return GitHubReleaseIndex{}, NewError(DownloadError, err, "failed to download release index %s", uri)
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return GitHubReleaseIndex{}, err
+	}
+
+	index := GitHubReleaseIndex{fetcher: fetcher}
+	if err := json.Unmarshal(contents, &index.releases); err != nil {
+		return GitHubReleaseIndex{}, NewError(ParseError, err, "failed to parse release index %s", uri)
+	}
+
+	return index, nil
+}
+
+func (i GitHubReleaseIndex) Latest(id string) (Release, bool, error) {
+	var (
+		latest        gitHubRelease
+		latestVersion *semver.Version
+		cnb           gitHubAsset
+	)
+	for _, release := range i.releases[id] {
+		if release.Draft || release.Prerelease {
+			continue
+		}
+
+		version, err := semver.NewVersion(strings.TrimPrefix(release.TagName, "v"))
+		if err != nil {
+			continue
+		}
+
+		asset, ok := release.cnb()
+		if !ok {
+			continue
+		}
+
+		if latestVersion == nil || version.GreaterThan(latestVersion) {
+			latest, latestVersion, cnb = release, version, asset
+		}
+	}
+
+	if latestVersion == nil {
+		return Release{}, false, nil
+	}
+
+	checksum, err := i.checksum(cnb)
+	if err != nil {
+		return Release{}, false, err
+	}
+
+	source := gitHubAsset{BrowserDownloadURL: latest.TarballURL}
+	for _, asset := range latest.Assets {
+		if strings.Contains(asset.Name, "source") {
+			source = asset
+			break
+		}
+	}
+
+	release := Release{
+		Version: strings.TrimPrefix(latest.TagName, "v"),
+		URI:     cnb.BrowserDownloadURL,
+		SHA256:  checksum,
+	}
+
+	if source.BrowserDownloadURL != "" {
+		release.Source = source.BrowserDownloadURL
+		if release.SourceSHA256, err = i.checksum(source); err != nil {
+			return Release{}, false, err
+		}
+	}
+
+	return release, true, nil
+}
+
+func (r gitHubRelease) cnb() (gitHubAsset, bool) {
+	for _, asset := range r.Assets {
+		if strings.Contains(asset.Name, "source") {
+			continue
+		}
+
+		for _, suffix := range []string{".tgz", ".tar.gz", ".cnb"} {
+			if strings.HasSuffix(asset.Name, suffix) {
+				return asset, true
+			}
+		}
+	}
+	return gitHubAsset{}, false
+}
+
+func (i GitHubReleaseIndex) checksum(asset gitHubAsset) (string, error) {
+	if digest := strings.TrimPrefix(asset.Digest, "sha256:"); sha256Pattern.MatchString(digest) {
+		return digest, nil
+	}
+
+	file, err := ioutil.TempFile("", "release-asset")
+	if err != nil {
+		return "", err
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	if err := i.fetcher.Fetch(asset.BrowserDownloadURL, file.Name()); err != nil {
+		return "", NewError(DownloadError, err, "failed to download %s", asset.BrowserDownloadURL)
+	}
+
+	file, err = os.Open(file.Name())
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,130 @@
+package cloudnative_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testReleaseIndex(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		server *httptest.Server
+		feed   string
+	)
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/index.json":
+				fmt.Fprint(w, feed)
+			case "/node-engine-source.tgz", "/npm-tarball":
+				fmt.Fprint(w, "some-source")
+			default:
+				http.NotFound(w, req)
+			}
+		}))
+
+		feed = fmt.Sprintf(`{
+  "org.cloudfoundry.node-engine": [
+    {"tag_name": "v0.0.170", "assets": [{"name": "node-engine-0.0.170.tgz", "browser_download_url": "https://example.com/node-engine-0.0.170.tgz", "digest": "sha256:%[2]s"}]},
+    {"tag_name": "v0.0.180", "assets": [
+      {"name": "node-engine-0.0.180.tgz", "browser_download_url": "https://example.com/node-engine-0.0.180.tgz", "digest": "sha256:%[3]s"},
+      {"name": "node-engine-source.tgz", "browser_download_url": "%[1]s/node-engine-source.tgz"}
+    ]},
+    {"tag_name": "v0.1.0", "prerelease": true, "assets": [{"name": "node-engine-0.1.0.tgz", "browser_download_url": "https://example.com/node-engine-0.1.0.tgz"}]},
+    {"tag_name": "v0.2.0", "draft": true, "assets": [{"name": "node-engine-0.2.0.tgz", "browser_download_url": "https://example.com/node-engine-0.2.0.tgz"}]},
+    {"tag_name": "nightly", "assets": [{"name": "node-engine-nightly.tgz", "browser_download_url": "https://example.com/node-engine-nightly.tgz"}]},
+    {"tag_name": "v0.3.0", "tarball_url": "https://example.com/tarball"}
+  ],
+  "org.cloudfoundry.npm": [
+    {"tag_name": "0.1.5", "tarball_url": "%[1]s/npm-tarball", "assets": [{"name": "npm.cnb", "browser_download_url": "https://example.com/npm.cnb", "digest": "sha256:%[2]s"}]}
+  ]
+}`, server.URL, strings.Repeat("a", 64), strings.Repeat("b", 64))
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	when("Latest", func() {
+		it("returns the newest published release with a CNB", func() {
+			index, err := cloudnative.NewGitHubReleaseIndex(server.URL+"/index.json", cloudnative.NewDependencyInstaller())
+			Expect(err).NotTo(HaveOccurred())
+
+			release, ok, err := index.Latest("org.cloudfoundry.node-engine")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(release).To(Equal(cloudnative.Release{
+				Version:      "0.0.180",
+				URI:          "https://example.com/node-engine-0.0.180.tgz",
+				SHA256:       strings.Repeat("b", 64),
+				Source:       server.URL + "/node-engine-source.tgz",
+				SourceSHA256: "c1aeb172c969434c400f44990d51a38a312dde373a15db129fd2187f16793bb1",
+			}))
+		})
+
+		it("falls back to the release tarball for the source", func() {
+			index, err := cloudnative.NewGitHubReleaseIndex(server.URL+"/index.json", cloudnative.NewDependencyInstaller())
+			Expect(err).NotTo(HaveOccurred())
+
+			release, ok, err := index.Latest("org.cloudfoundry.npm")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(release.Version).To(Equal("0.1.5"))
+			Expect(release.Source).To(Equal(server.URL + "/npm-tarball"))
+			Expect(release.SourceSHA256).To(Equal("c1aeb172c969434c400f44990d51a38a312dde373a15db129fd2187f16793bb1"))
+		})
+
+		when("the source cannot be downloaded", func() {
+			it("returns a download error", func() {
+				feed = `{"org.cloudfoundry.npm": [{"tag_name": "0.1.5", "tarball_url": "` + server.URL + `/missing", "assets": [{"name": "npm.cnb", "browser_download_url": "https://example.com/npm.cnb", "digest": "sha256:` + strings.Repeat("a", 64) + `"}]}]}`
+
+				index, err := cloudnative.NewGitHubReleaseIndex(server.URL+"/index.json", cloudnative.NewDependencyInstaller())
+				Expect(err).NotTo(HaveOccurred())
+
+				_, _, err = index.Latest("org.cloudfoundry.npm")
+				Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.DownloadError))
+			})
+		})
+
+		when("the index does not list the dependency", func() {
+			it("reports that it was not found", func() {
+				index, err := cloudnative.NewGitHubReleaseIndex(server.URL+"/index.json", cloudnative.NewDependencyInstaller())
+				Expect(err).NotTo(HaveOccurred())
+
+				_, ok, err := index.Latest("org.cloudfoundry.yarn")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ok).To(BeFalse())
+			})
+		})
+	})
+
+	when("NewGitHubReleaseIndex", func() {
+		when("the index is not valid JSON", func() {
+			it("returns a parse error", func() {
+				feed = "not json"
+
+				_, err := cloudnative.NewGitHubReleaseIndex(server.URL+"/index.json", cloudnative.NewDependencyInstaller())
+				Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.ParseError))
+			})
+		})
+
+		when("the index cannot be downloaded", func() {
+			it("returns a download error", func() {
+				_, err := cloudnative.NewGitHubReleaseIndex(server.URL+"/missing.json", cloudnative.NewDependencyInstaller().WithRetries(0, 0))
+				Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.DownloadError))
+			})
+		})
+	})
+}
@@ -0,0 +1,117 @@
+package cloudnative
+
+import (
+	"strings"
+)
+
+// ReleaseNotes describes the CNBs packaged into a release of a shimmed
+// buildpack across all of its stacks and, when there was a previous release
+// to compare against, what changed since then.
+type ReleaseNotes struct {
+	ID         string
+	Name       string
+	Version    string
+	Lifecycle  string
+	Stacks     []string
+	Buildpacks []ReleaseNotesBuildpack
+	Changes    *BuildpackDiff
+}
+
+// ReleaseNotesBuildpack is a packaged CNB. Parent names the meta-buildpack
+// that a child CNB was packaged for.
+type ReleaseNotesBuildpack struct {
+	ID      string
+	Version string
+	Parent  string
+	Stacks  []string
+}
+
+// NewReleaseNotes describes the dependencies that were packaged for
+// buildpack. When previous is given, the notes include the changes since
+// then; order groups are only compared if previous records them, which a
+// lockfile does not.
+func NewReleaseNotes(buildpack Buildpack, packaged Lockfile, previous *ShimmedBuildpack) ReleaseNotes {
+	notes := ReleaseNotes{
+		ID:      buildpack.Info.ID,
+		Name:    buildpack.Info.Name,
+		Version: buildpack.Info.Version,
+	}
+
+	var stacks []string
+	for _, dependency := range packaged.Dependencies {
+		stacks = append(stacks, dependency.Stack)
+
+		if dependency.ID == Lifecycle && dependency.Parent == "" {
+			notes.Lifecycle = dependency.Version
+			continue
+		}
+
+		i := 0
+		for ; i < len(notes.Buildpacks); i++ {
+			b := notes.Buildpacks[i]
+			if b.ID == dependency.ID && b.Version == dependency.Version && b.Parent == dependency.Parent {
+				break
+			}
+		}
+		if i == len(notes.Buildpacks) {
+			notes.Buildpacks = append(notes.Buildpacks, ReleaseNotesBuildpack{ID: dependency.ID, Version: dependency.Version, Parent: dependency.Parent})
+		}
+
+		notes.Buildpacks[i].Stacks = sortedUnique(append(notes.Buildpacks[i].Stacks, dependency.Stack))
+	}
+	notes.Stacks = sortedUnique(stacks)
+
+	if previous != nil {
+		current := ShimmedBuildpack{
+			Version:   buildpack.Info.Version,
+			Buildpack: buildpack,
+			Manifest:  packaged.Manifest(),
+		}
+
+		changes := DiffBuildpacks(*previous, current)
+		if len(previous.Buildpack.Orders) == 0 {
+			changes.Orders = nil
+		}
+		notes.Changes = &changes
+	}
+
+	return notes
+}
+
+// ReadPreviousRelease reads the shimmed buildpack zip, or the lockfile, of
+// a release to compare a new one against. A lockfile is described as a
+// buildpack with no version or order groups.
+func ReadPreviousRelease(path string) (ShimmedBuildpack, error) {
+	if strings.HasSuffix(path, ".zip") {
+		shimmed, err := ReadShimmedBuildpack(path)
+		if err != nil {
+			return ShimmedBuildpack{}, NewError(ParseError, err, "failed to read previous release")
+		}
+		return shimmed, nil
+	}
+
+	lockfile, err := ReadLockfile(path)
+	if err != nil {
+		return ShimmedBuildpack{}, err
+	}
+
+	return ShimmedBuildpack{Manifest: lockfile.Manifest()}, nil
+}
+
+// Manifest lists the locked dependencies as the manifest of a zip that
+// supports each of their stacks would.
+func (l Lockfile) Manifest() Manifest {
+	var manifest Manifest
+	for _, dependency := range l.Dependencies {
+		manifest.Dependencies = append(manifest.Dependencies, ManifestDependency{
+			ID:           dependency.ID,
+			Name:         dependency.ID,
+			Version:      dependency.Version,
+			SHA256:       dependency.SHA256,
+			Source:       dependency.Source,
+			SourceSHA256: dependency.SourceSHA256,
+			Stacks:       []string{dependency.Stack},
+		})
+	}
+	return manifest
+}
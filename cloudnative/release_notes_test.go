@@ -0,0 +1,98 @@
+package cloudnative_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testReleaseNotes(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		buildpack cloudnative.Buildpack
+		packaged  cloudnative.Lockfile
+	)
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		buildpack = cloudnative.Buildpack{
+			Info: cloudnative.BuildpackInfo{ID: "org.cloudfoundry.nodejs", Name: "Node.js Buildpack", Version: "1.1.0"},
+			Orders: []cloudnative.BuildpackOrder{
+				{Groups: []cloudnative.BuildpackOrderGroup{{ID: "org.cloudfoundry.nodejs-meta", Version: "0.2.0"}}},
+			},
+		}
+
+		packaged = cloudnative.Lockfile{Dependencies: []cloudnative.LockedDependency{
+			{ID: "lifecycle", Version: "0.7.5", Stack: "cflinuxfs3", SHA256: "lifecycle-sha"},
+			{ID: "org.cloudfoundry.nodejs-meta", Version: "0.2.0", Stack: "cflinuxfs3", SHA256: "meta-sha"},
+			{ID: "org.cloudfoundry.node-engine", Version: "0.0.100", Stack: "cflinuxfs3", Parent: "org.cloudfoundry.nodejs-meta", SHA256: "node-sha"},
+			{ID: "lifecycle", Version: "0.7.5", Stack: "bionic", SHA256: "lifecycle-sha"},
+			{ID: "org.cloudfoundry.nodejs-meta", Version: "0.2.0", Stack: "bionic", SHA256: "meta-sha"},
+			{ID: "org.cloudfoundry.node-engine", Version: "0.0.100", Stack: "bionic", Parent: "org.cloudfoundry.nodejs-meta", SHA256: "node-sha"},
+		}}
+	})
+
+	when("NewReleaseNotes", func() {
+		it("lists every packaged CNB with the stacks it was packaged for", func() {
+			notes := cloudnative.NewReleaseNotes(buildpack, packaged, nil)
+
+			Expect(notes).To(Equal(cloudnative.ReleaseNotes{
+				ID:        "org.cloudfoundry.nodejs",
+				Name:      "Node.js Buildpack",
+				Version:   "1.1.0",
+				Lifecycle: "0.7.5",
+				Stacks:    []string{"bionic", "cflinuxfs3"},
+				Buildpacks: []cloudnative.ReleaseNotesBuildpack{
+					{ID: "org.cloudfoundry.nodejs-meta", Version: "0.2.0", Stacks: []string{"bionic", "cflinuxfs3"}},
+					{ID: "org.cloudfoundry.node-engine", Version: "0.0.100", Parent: "org.cloudfoundry.nodejs-meta", Stacks: []string{"bionic", "cflinuxfs3"}},
+				},
+			}))
+		})
+
+		it("describes the changes since a previous lockfile", func() {
+			tmpDir, err := ioutil.TempDir("", "release-notes")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(tmpDir)
+
+			path := filepath.Join(tmpDir, "cnb2cf.lock")
+			Expect(cloudnative.WriteLockfile(cloudnative.Lockfile{Dependencies: []cloudnative.LockedDependency{
+				{ID: "lifecycle", Version: "0.7.2", Stack: "cflinuxfs3", SHA256: "old-lifecycle-sha"},
+				{ID: "org.cloudfoundry.nodejs-meta", Version: "0.2.0", Stack: "cflinuxfs3", SHA256: "meta-sha"},
+				{ID: "org.cloudfoundry.node-engine", Version: "0.0.99", Stack: "cflinuxfs3", Parent: "org.cloudfoundry.nodejs-meta", SHA256: "old-node-sha"},
+			}}, path)).To(Succeed())
+
+			previous, err := cloudnative.ReadPreviousRelease(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			notes := cloudnative.NewReleaseNotes(buildpack, packaged, &previous)
+			Expect(notes.Changes).To(Equal(&cloudnative.BuildpackDiff{
+				ID:            "org.cloudfoundry.nodejs",
+				ToVersion:     "1.1.0",
+				FromLifecycle: "0.7.2",
+				ToLifecycle:   "0.7.5",
+				AddedStacks:   []string{"bionic"},
+				Changed: []cloudnative.DependencyChange{
+					{ID: "org.cloudfoundry.node-engine", From: []string{"0.0.99"}, To: []string{"0.0.100"}, AddedStacks: []string{"bionic"}},
+					{ID: "org.cloudfoundry.nodejs-meta", From: []string{"0.2.0"}, To: []string{"0.2.0"}, AddedStacks: []string{"bionic"}},
+				},
+			}))
+		})
+	})
+
+	when("ReadPreviousRelease", func() {
+		when("the zip cannot be read", func() {
+			it("returns a parse error", func() {
+				_, err := cloudnative.ReadPreviousRelease("/does/not/exist.zip")
+				Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.ParseError))
+			})
+		})
+	})
+}
@@ -0,0 +1,259 @@
+package cloudnative
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry/libbuildpack"
+)
+
+const SourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+// DefaultSourceDate is the earliest time that a zip file can record.
+var DefaultSourceDate = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// SourceDate returns the time that reproducible archives are stamped with,
+// taken from SOURCE_DATE_EPOCH when it is set.
+func SourceDate() (time.Time, error) {
+	epoch := os.Getenv(SourceDateEpochEnv)
+	if epoch == "" {
+		return DefaultSourceDate, nil
+	}
+
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, NewError(ParseError, err, "invalid %s %q", SourceDateEpochEnv, epoch)
+	}
+
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// normalizedMode keeps the type of a file and only whether it is
+// executable, so that archives do not depend on the umask of the machine
+// that built them.
+func normalizedMode(mode os.FileMode) os.FileMode {
+	perm := os.FileMode(0644)
+	switch {
+	case mode&os.ModeSymlink != 0:
+		perm = 0777
+	case mode.IsDir(), mode&0111 != 0:
+		perm = 0755
+	}
+
+	return mode&^os.ModePerm | perm
+}
+
+// tarEntry is the normalized header of an entry, and where its contents
+// start in the spool file.
+type tarEntry struct {
+	header *tar.Header
+	offset int64
+}
+
+// NormalizeTarGz rewrites the gzipped tarball at path so that it only
+// depends on the files it holds: entries are sorted by name, owned by root,
+// stamped with modTime and given normalized permissions. Their contents are
+// spooled to a file beside path while the headers are sorted, rather than
+// held in memory. It returns the SHA256 of the rewritten tarball.
+func NormalizeTarGz(path string, modTime time.Time) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		return "", err
+	}
+
+	spool, err := ioutil.TempFile(filepath.Dir(path), ".spool-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	var entries []tarEntry
+	var offset int64
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+
+		size, err := io.Copy(spool, tr)
+		if err != nil {
+			return "", err
+		}
+
+		entries = append(entries, tarEntry{
+			header: &tar.Header{
+				Typeflag: header.Typeflag,
+				Name:     header.Name,
+				Linkname: header.Linkname,
+				Size:     size,
+				Mode:     int64(normalizedMode(header.FileInfo().Mode()).Perm()),
+				ModTime:  modTime.Truncate(time.Second),
+			},
+			offset: offset,
+		})
+		offset += size
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].header.Name < entries[j].header.Name
+	})
+
+	output, err := ioutil.TempFile(filepath.Dir(path), ".normalize-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(output.Name())
+	defer output.Close()
+
+	hash := sha256.New()
+	gw := gzip.NewWriter(io.MultiWriter(output, hash))
+	tw := tar.NewWriter(gw)
+	for _, entry := range entries {
+		if err := tw.WriteHeader(entry.header); err != nil {
+			return "", err
+		}
+
+		if _, err := io.Copy(tw, io.NewSectionReader(spool, entry.offset, entry.header.Size)); err != nil {
+			return "", err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+
+	if err := gw.Close(); err != nil {
+		return "", err
+	}
+
+	if err := output.Close(); err != nil {
+		return "", err
+	}
+
+	if err := os.Chmod(output.Name(), 0644); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(output.Name(), path); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// NormalizeZip rewrites the zip file at path with its entries sorted by
+// name, stamped with modTime and given normalized permissions.
+func NormalizeZip(path string, modTime time.Time) error {
+	// zip files record times from 1980 onwards
+	if modTime.Before(DefaultSourceDate) {
+		modTime = DefaultSourceDate
+	}
+
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	files := append([]*zip.File(nil), reader.File...)
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+
+	output, err := ioutil.TempFile(filepath.Dir(path), ".normalize-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(output.Name())
+	defer output.Close()
+
+	zw := zip.NewWriter(output)
+	for _, file := range files {
+		header := &zip.FileHeader{
+			Name:     file.Name,
+			Method:   zip.Deflate,
+			Modified: modTime.UTC().Truncate(time.Second),
+		}
+		header.SetMode(normalizedMode(file.Mode()))
+		if file.FileInfo().IsDir() {
+			header.Method = zip.Store
+		}
+
+		writer, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		contents, err := file.Open()
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(writer, contents)
+		contents.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	if err := output.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(output.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(output.Name(), path)
+}
+
+// StoreByChecksum copies the file at path to dir/<checksum>/<name>, unless
+// it is already there, and returns the new path. Files kept this way have
+// the same path in every run that produces them.
+func StoreByChecksum(path, checksum, dir string) (string, error) {
+	destination := filepath.Join(dir, checksum, filepath.Base(path))
+	if err := libbuildpack.CheckSha256(destination, checksum); err == nil {
+		return destination, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return "", err
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(destination), ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	if err := libbuildpack.CopyFile(path, tmpFile.Name()); err != nil {
+		return "", err
+	}
+
+	return destination, os.Rename(tmpFile.Name(), destination)
+}
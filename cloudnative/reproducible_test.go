@@ -0,0 +1,301 @@
+package cloudnative_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testReproducible(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		tmpDir     string
+		sourceDate time.Time
+	)
+
+	type entry struct {
+		name     string
+		mode     int64
+		contents string
+	}
+
+	checksum := func(path string) string {
+		contents, err := ioutil.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		sum := sha256.Sum256(contents)
+		return hex.EncodeToString(sum[:])
+	}
+
+	writeTarGz := func(name string, modTime time.Time, uid int, entries ...entry) string {
+		path := filepath.Join(tmpDir, name)
+		file, err := os.Create(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close()
+
+		gw := gzip.NewWriter(file)
+		gw.ModTime = modTime
+		defer gw.Close()
+
+		tw := tar.NewWriter(gw)
+		defer tw.Close()
+
+		for _, e := range entries {
+			Expect(tw.WriteHeader(&tar.Header{
+				Name:    e.name,
+				Mode:    e.mode,
+				Size:    int64(len(e.contents)),
+				ModTime: modTime,
+				Uid:     uid,
+				Uname:   "some-user",
+			})).To(Succeed())
+			_, err := tw.Write([]byte(e.contents))
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		return path
+	}
+
+	writeZip := func(name string, modTime time.Time, entries ...entry) string {
+		path := filepath.Join(tmpDir, name)
+		file, err := os.Create(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close()
+
+		zw := zip.NewWriter(file)
+		defer zw.Close()
+
+		for _, e := range entries {
+			header := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: modTime}
+			header.SetMode(os.FileMode(e.mode))
+			writer, err := zw.CreateHeader(header)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = writer.Write([]byte(e.contents))
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		return path
+	}
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "reproducible")
+		Expect(err).NotTo(HaveOccurred())
+
+		sourceDate = time.Unix(1600000000, 0).UTC()
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	when("SourceDate", func() {
+		it.After(func() {
+			Expect(os.Unsetenv(cloudnative.SourceDateEpochEnv)).To(Succeed())
+		})
+
+		it("reads SOURCE_DATE_EPOCH", func() {
+			Expect(os.Setenv(cloudnative.SourceDateEpochEnv, "1600000000")).To(Succeed())
+
+			date, err := cloudnative.SourceDate()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(date).To(Equal(sourceDate))
+		})
+
+		it("defaults to the earliest time a zip file can record", func() {
+			Expect(os.Unsetenv(cloudnative.SourceDateEpochEnv)).To(Succeed())
+
+			date, err := cloudnative.SourceDate()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(date).To(Equal(cloudnative.DefaultSourceDate))
+		})
+
+		when("SOURCE_DATE_EPOCH is not a number of seconds", func() {
+			it("returns a parse error", func() {
+				Expect(os.Setenv(cloudnative.SourceDateEpochEnv, "yesterday")).To(Succeed())
+
+				_, err := cloudnative.SourceDate()
+				Expect(err).To(MatchError(ContainSubstring(`invalid SOURCE_DATE_EPOCH "yesterday"`)))
+				Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.ParseError))
+			})
+		})
+	})
+
+	when("NormalizeTarGz", func() {
+		it("gives tarballs with the same files the same checksum", func() {
+			first := writeTarGz("first.tgz", time.Now(), 1000,
+				entry{"buildpack.toml", 0600, "some-buildpack"},
+				entry{"bin/build", 0700, "some-build"},
+			)
+			second := writeTarGz("second.tgz", time.Now().Add(time.Hour), 0,
+				entry{"bin/build", 0755, "some-build"},
+				entry{"buildpack.toml", 0644, "some-buildpack"},
+			)
+
+			firstSHA, err := cloudnative.NormalizeTarGz(first, sourceDate)
+			Expect(err).NotTo(HaveOccurred())
+			secondSHA, err := cloudnative.NormalizeTarGz(second, sourceDate)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(firstSHA).To(Equal(secondSHA))
+			Expect(checksum(first)).To(Equal(firstSHA))
+			Expect(checksum(second)).To(Equal(secondSHA))
+		})
+
+		it("sorts the entries and normalizes their headers", func() {
+			path := writeTarGz("cnb.tgz", time.Now(), 1000,
+				entry{"buildpack.toml", 0600, "some-buildpack"},
+				entry{"bin/build", 0700, "some-build"},
+			)
+
+			_, err := cloudnative.NormalizeTarGz(path, sourceDate)
+			Expect(err).NotTo(HaveOccurred())
+
+			file, err := os.Open(path)
+			Expect(err).NotTo(HaveOccurred())
+			defer file.Close()
+
+			gr, err := gzip.NewReader(file)
+			Expect(err).NotTo(HaveOccurred())
+
+			var headers []tar.Header
+			tr := tar.NewReader(gr)
+			for {
+				header, err := tr.Next()
+				if err != nil {
+					break
+				}
+				headers = append(headers, *header)
+			}
+
+			Expect(headers).To(HaveLen(2))
+			Expect(headers[0].Name).To(Equal("bin/build"))
+			Expect(headers[0].Mode).To(Equal(int64(0755)))
+			Expect(headers[1].Name).To(Equal("buildpack.toml"))
+			Expect(headers[1].Mode).To(Equal(int64(0644)))
+			for _, header := range headers {
+				Expect(header.ModTime.Equal(sourceDate)).To(BeTrue())
+				Expect(header.Uid).To(Equal(0))
+				Expect(header.Uname).To(BeEmpty())
+			}
+		})
+
+		it("keeps symlinks and the contents of each entry", func() {
+			path := filepath.Join(tmpDir, "cnb.tgz")
+			file, err := os.Create(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			gw := gzip.NewWriter(file)
+			tw := tar.NewWriter(gw)
+			Expect(tw.WriteHeader(&tar.Header{Name: "bin/detect", Typeflag: tar.TypeSymlink, Linkname: "build", Mode: 0755})).To(Succeed())
+			Expect(tw.WriteHeader(&tar.Header{Name: "bin/build", Mode: 0700, Size: 10})).To(Succeed())
+			_, err = tw.Write([]byte("some-build"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tw.Close()).To(Succeed())
+			Expect(gw.Close()).To(Succeed())
+			Expect(file.Close()).To(Succeed())
+
+			_, err = cloudnative.NormalizeTarGz(path, sourceDate)
+			Expect(err).NotTo(HaveOccurred())
+
+			file, err = os.Open(path)
+			Expect(err).NotTo(HaveOccurred())
+			defer file.Close()
+
+			gr, err := gzip.NewReader(file)
+			Expect(err).NotTo(HaveOccurred())
+			tr := tar.NewReader(gr)
+
+			header, err := tr.Next()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.Name).To(Equal("bin/build"))
+			contents, err := ioutil.ReadAll(tr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("some-build"))
+
+			header, err = tr.Next()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.Name).To(Equal("bin/detect"))
+			Expect(header.Typeflag).To(Equal(byte(tar.TypeSymlink)))
+			Expect(header.Linkname).To(Equal("build"))
+			Expect(header.Mode).To(Equal(int64(0777)))
+		})
+	})
+
+	when("NormalizeZip", func() {
+		it("gives zip files with the same files the same checksum", func() {
+			first := writeZip("first.zip", time.Now(),
+				entry{"manifest.yml", 0600, "some-manifest"},
+				entry{"bin/supply", 0700, "some-supply"},
+			)
+			second := writeZip("second.zip", time.Now().Add(time.Hour),
+				entry{"bin/supply", 0755, "some-supply"},
+				entry{"manifest.yml", 0644, "some-manifest"},
+			)
+
+			Expect(cloudnative.NormalizeZip(first, sourceDate)).To(Succeed())
+			Expect(cloudnative.NormalizeZip(second, sourceDate)).To(Succeed())
+			Expect(checksum(first)).To(Equal(checksum(second)))
+
+			reader, err := zip.OpenReader(first)
+			Expect(err).NotTo(HaveOccurred())
+			defer reader.Close()
+
+			Expect(reader.File).To(HaveLen(2))
+			Expect(reader.File[0].Name).To(Equal("bin/supply"))
+			Expect(reader.File[0].Mode()).To(Equal(os.FileMode(0755)))
+			Expect(reader.File[1].Name).To(Equal("manifest.yml"))
+			Expect(reader.File[1].Mode()).To(Equal(os.FileMode(0644)))
+			Expect(reader.File[0].Modified.Equal(sourceDate)).To(BeTrue())
+		})
+
+		it("keeps symlinks", func() {
+			path := writeZip("buildpack.zip", time.Now(),
+				entry{"bin/supply", 0700, "some-supply"},
+				entry{"bin/finalize", int64(os.ModeSymlink | 0755), "supply"},
+			)
+
+			Expect(cloudnative.NormalizeZip(path, sourceDate)).To(Succeed())
+
+			reader, err := zip.OpenReader(path)
+			Expect(err).NotTo(HaveOccurred())
+			defer reader.Close()
+
+			Expect(reader.File[0].Name).To(Equal("bin/finalize"))
+			Expect(reader.File[0].Mode()).To(Equal(os.ModeSymlink | 0777))
+			Expect(reader.File[1].Mode()).To(Equal(os.FileMode(0755)))
+		})
+	})
+
+	when("StoreByChecksum", func() {
+		it("keeps the file under its checksum", func() {
+			path := filepath.Join(tmpDir, "scratch", "some-cnb.tgz")
+			Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(path, []byte("some-cnb"), 0644)).To(Succeed())
+			sum := checksum(path)
+
+			stored, err := cloudnative.StoreByChecksum(path, sum, filepath.Join(tmpDir, "built"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored).To(Equal(filepath.Join(tmpDir, "built", sum, "some-cnb.tgz")))
+			Expect(checksum(stored)).To(Equal(sum))
+
+			again, err := cloudnative.StoreByChecksum(path, sum, filepath.Join(tmpDir, "built"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(again).To(Equal(stored))
+		})
+	})
+}
@@ -0,0 +1,381 @@
+package cloudnative
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// SBOM formats that package can write.
+const (
+	CycloneDX = "cyclonedx"
+	SPDX      = "spdx"
+)
+
+var SBOMFormats = []string{CycloneDX, SPDX}
+
+// Kinds of software listed in an SBOM.
+const (
+	SBOMLifecycle  = "lifecycle"
+	SBOMBuildpack  = "buildpack"
+	SBOMDependency = "dependency"
+)
+
+// SBOM lists the software packaged in a shimmed buildpack for one stack.
+type SBOM struct {
+	Name       string
+	Version    string
+	Stack      string
+	Created    time.Time
+	Components []SBOMComponent
+}
+
+// SBOMComponent is one piece of software in an SBOM. SHA256 is the checksum
+// of the component as it is packaged, and URI is where it was downloaded
+// from as it is. A component that was built is listed with the Source it
+// was built from and the SourceSHA256 of that source instead of a URI.
+// Parent is the ID of the buildpack that packages it, empty for the
+// shimmed buildpack itself.
+type SBOMComponent struct {
+	Kind         string
+	ID           string
+	Version      string
+	URI          string
+	SHA256       string
+	Source       string
+	SourceSHA256 string
+	Licenses     []string
+	Parent       string
+}
+
+func (c SBOMComponent) ref() string {
+	return c.ID + "@" + c.Version
+}
+
+// SBOMFileName returns the name that an SBOM in format is packaged under.
+func SBOMFileName(format string) string {
+	if format == SPDX {
+		return "sbom.spdx.json"
+	}
+	return "sbom.cdx.json"
+}
+
+// IsSBOMFormat reports whether format is one of SBOMFormats.
+func IsSBOMFormat(format string) bool {
+	for _, f := range SBOMFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// components returns the components with duplicates removed, along with the
+// refs of the components that each ref contains. The shimmed buildpack is
+// keyed by the empty ref.
+func (s SBOM) components() ([]SBOMComponent, map[string][]string) {
+	var components []SBOMComponent
+	contains := map[string][]string{}
+	seen := map[string]bool{}
+
+	parents := map[string]string{"": ""}
+	for _, component := range s.Components {
+		if _, ok := parents[component.ID]; !ok {
+			parents[component.ID] = component.ref()
+		}
+	}
+
+	for _, component := range s.Components {
+		parent := parents[component.Parent]
+		edge := parent + "|" + component.ref()
+		if !seen[edge] {
+			seen[edge] = true
+			contains[parent] = append(contains[parent], component.ref())
+		}
+
+		if !seen[component.ref()] {
+			seen[component.ref()] = true
+			components = append(components, component)
+		}
+	}
+
+	return components, contains
+}
+
+// WriteSBOM writes the SBOM to path as JSON in format.
+func WriteSBOM(sbom SBOM, format, path string) error {
+	var document interface{}
+	switch format {
+	case CycloneDX:
+		document = sbom.cycloneDX()
+	case SPDX:
+		document = sbom.spdx()
+	default:
+		return fmt.Errorf("unknown SBOM format %q, expected one of %s", format, strings.Join(SBOMFormats, ", "))
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(document)
+}
+
+type cdxBOM struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     []cdxTool    `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTool struct {
+	Name string `json:"name"`
+}
+
+type cdxComponent struct {
+	Type               string                 `json:"type"`
+	BOMRef             string                 `json:"bom-ref"`
+	Name               string                 `json:"name"`
+	Version            string                 `json:"version"`
+	Hashes             []cdxHash              `json:"hashes,omitempty"`
+	Licenses           []cdxLicense           `json:"licenses,omitempty"`
+	ExternalReferences []cdxExternalReference `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty          `json:"properties,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxLicense struct {
+	Expression string `json:"expression"`
+}
+
+type cdxExternalReference struct {
+	Type    string    `json:"type"`
+	URL     string    `json:"url"`
+	Comment string    `json:"comment,omitempty"`
+	Hashes  []cdxHash `json:"hashes,omitempty"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+func (s SBOM) cycloneDX() cdxBOM {
+	rootRef := s.Name + "@" + s.Version
+	bom := cdxBOM{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.4",
+		Version:     1,
+		Metadata: cdxMetadata{
+			Timestamp: s.Created.UTC().Format(time.RFC3339),
+			Tools:     []cdxTool{{Name: "cnb2cf"}},
+			Component: cdxComponent{
+				Type:       "application",
+				BOMRef:     rootRef,
+				Name:       s.Name,
+				Version:    s.Version,
+				Properties: []cdxProperty{{Name: "cnb2cf:stack", Value: s.Stack}},
+			},
+		},
+		Components: []cdxComponent{},
+	}
+
+	components, contains := s.components()
+	for _, c := range components {
+		component := cdxComponent{
+			Type:       "application",
+			BOMRef:     c.ref(),
+			Name:       c.ID,
+			Version:    c.Version,
+			Properties: []cdxProperty{{Name: "cnb2cf:kind", Value: c.Kind}},
+		}
+		if c.Kind == SBOMDependency {
+			component.Type = "library"
+		}
+		if c.SHA256 != "" {
+			component.Hashes = []cdxHash{{Alg: "SHA-256", Content: c.SHA256}}
+		}
+		for _, license := range c.Licenses {
+			component.Licenses = append(component.Licenses, cdxLicense{Expression: license})
+		}
+		if c.URI != "" {
+			component.ExternalReferences = append(component.ExternalReferences, cdxExternalReference{Type: "distribution", URL: c.URI})
+		}
+		if c.Source != "" {
+			// CycloneDX 1.4 has no reference type for the source a component was built from
+			source := cdxExternalReference{Type: "other", URL: c.Source, Comment: "source"}
+			if c.SourceSHA256 != "" {
+				source.Hashes = []cdxHash{{Alg: "SHA-256", Content: c.SourceSHA256}}
+			}
+			component.ExternalReferences = append(component.ExternalReferences, source)
+		}
+
+		bom.Components = append(bom.Components, component)
+	}
+
+	bom.Dependencies = append(bom.Dependencies, cdxDependency{Ref: rootRef, DependsOn: append([]string{}, contains[""]...)})
+	for _, c := range components {
+		bom.Dependencies = append(bom.Dependencies, cdxDependency{Ref: c.ref(), DependsOn: append([]string{}, contains[c.ref()]...)})
+	}
+
+	return bom
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string         `json:"name"`
+	SPDXID           string         `json:"SPDXID"`
+	VersionInfo      string         `json:"versionInfo"`
+	DownloadLocation string         `json:"downloadLocation"`
+	FilesAnalyzed    bool           `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum `json:"checksums,omitempty"`
+	SourceInfo       string         `json:"sourceInfo,omitempty"`
+	LicenseConcluded string         `json:"licenseConcluded"`
+	LicenseDeclared  string         `json:"licenseDeclared"`
+	CopyrightText    string         `json:"copyrightText"`
+	Comment          string         `json:"comment,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+func (s SBOM) spdx() spdxDocument {
+	name := fmt.Sprintf("%s-%s-%s", s.Name, s.Version, s.Stack)
+	document := spdxDocument{
+		SPDXVersion: "SPDX-2.3",
+		DataLicense: "CC0-1.0",
+		SPDXID:      "SPDXRef-DOCUMENT",
+		Name:        name,
+		CreationInfo: spdxCreationInfo{
+			Created:  s.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: cnb2cf"},
+		},
+		Packages: []spdxPackage{{
+			Name:             s.Name,
+			SPDXID:           "SPDXRef-Package-0",
+			VersionInfo:      s.Version,
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+			CopyrightText:    "NOASSERTION",
+			Comment:          "shimmed buildpack for " + s.Stack,
+		}},
+		Relationships: []spdxRelationship{{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: "SPDXRef-Package-0",
+		}},
+	}
+
+	components, contains := s.components()
+
+	// SPDX ids may only hold letters, digits, dots and dashes
+	ids := map[string]string{"": "SPDXRef-Package-0"}
+	for i, c := range components {
+		ids[c.ref()] = fmt.Sprintf("SPDXRef-Package-%d", i+1)
+	}
+
+	hash := sha256.New()
+	for _, c := range components {
+		fmt.Fprintf(hash, "%s|%s|%s|%s|%s\n", c.ref(), c.URI, c.SHA256, c.Source, c.SourceSHA256)
+
+		pkg := spdxPackage{
+			Name:             c.ID,
+			SPDXID:           ids[c.ref()],
+			VersionInfo:      c.Version,
+			DownloadLocation: "NOASSERTION",
+			LicenseConcluded: "NOASSERTION",
+			LicenseDeclared:  "NOASSERTION",
+			CopyrightText:    "NOASSERTION",
+			Comment:          c.Kind,
+		}
+		if c.URI != "" {
+			pkg.DownloadLocation = c.URI
+		}
+		if c.SHA256 != "" {
+			pkg.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: c.SHA256}}
+		}
+		if c.Source != "" {
+			pkg.SourceInfo = "built from " + c.Source
+			if c.SourceSHA256 != "" {
+				pkg.SourceInfo += " with SHA256 " + c.SourceSHA256
+			}
+		}
+		if len(c.Licenses) > 0 {
+			pkg.LicenseDeclared = strings.Join(c.Licenses, " AND ")
+		}
+
+		document.Packages = append(document.Packages, pkg)
+	}
+
+	for _, parent := range append([]string{""}, refs(components)...) {
+		for _, child := range contains[parent] {
+			document.Relationships = append(document.Relationships, spdxRelationship{
+				SPDXElementID:      ids[parent],
+				RelationshipType:   "CONTAINS",
+				RelatedSPDXElement: ids[child],
+			})
+		}
+	}
+
+	// the namespace must be unique to the document, so it is derived from what it lists
+	document.DocumentNamespace = fmt.Sprintf("https://cloudfoundry.org/cnb2cf/spdx/%s-%s", name, hex.EncodeToString(hash.Sum(nil))[:16])
+
+	return document
+}
+
+func refs(components []SBOMComponent) []string {
+	var refs []string
+	for _, c := range components {
+		refs = append(refs, c.ref())
+	}
+	return refs
+}
@@ -0,0 +1,202 @@
+package cloudnative_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testSBOM(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		tmpDir string
+		sbom   cloudnative.SBOM
+	)
+
+	read := func(path string) map[string]interface{} {
+		contents, err := ioutil.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+
+		var document map[string]interface{}
+		Expect(json.Unmarshal(contents, &document)).To(Succeed())
+		return document
+	}
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "sbom")
+		Expect(err).NotTo(HaveOccurred())
+
+		sbom = cloudnative.SBOM{
+			Name:    "org.cloudfoundry.nodejs",
+			Version: "1.0.0",
+			Stack:   "cflinuxfs3",
+			Created: time.Unix(1600000000, 0),
+			Components: []cloudnative.SBOMComponent{
+				{
+					Kind:    cloudnative.SBOMLifecycle,
+					ID:      "lifecycle",
+					Version: "0.7.2",
+					URI:     "https://example.com/lifecycle.tgz",
+					SHA256:  "some-lifecycle-sha",
+				},
+				{
+					Kind:         cloudnative.SBOMBuildpack,
+					ID:           "org.cloudfoundry.node-engine",
+					Version:      "0.0.169",
+					SHA256:       "some-node-engine-sha",
+					Source:       "https://example.com/node-engine-source.tgz",
+					SourceSHA256: "some-node-engine-source-sha",
+					Licenses:     []string{"Apache-2.0"},
+					Parent:       "org.cloudfoundry.meta",
+				},
+				{
+					Kind:     cloudnative.SBOMDependency,
+					ID:       "node",
+					Version:  "12.16.1",
+					URI:      "https://example.com/node.tgz",
+					SHA256:   "some-node-sha",
+					Licenses: []string{"MIT"},
+					Parent:   "org.cloudfoundry.node-engine",
+				},
+				{
+					Kind:    cloudnative.SBOMBuildpack,
+					ID:      "org.cloudfoundry.meta",
+					Version: "0.1.0",
+					URI:     "file://meta/",
+					SHA256:  "some-meta-sha",
+				},
+			},
+		}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	when("WriteSBOM", func() {
+		it("writes a CycloneDX document", func() {
+			path := filepath.Join(tmpDir, cloudnative.SBOMFileName(cloudnative.CycloneDX))
+			Expect(path).To(HaveSuffix("sbom.cdx.json"))
+			Expect(cloudnative.WriteSBOM(sbom, cloudnative.CycloneDX, path)).To(Succeed())
+
+			document := read(path)
+			Expect(document["bomFormat"]).To(Equal("CycloneDX"))
+			Expect(document["specVersion"]).To(Equal("1.4"))
+			Expect(document["metadata"]).To(HaveKeyWithValue("timestamp", "2020-09-13T12:26:40Z"))
+			Expect(document["metadata"]).To(HaveKeyWithValue("component", HaveKeyWithValue("bom-ref", "org.cloudfoundry.nodejs@1.0.0")))
+
+			components := document["components"].([]interface{})
+			Expect(components).To(HaveLen(4))
+			Expect(components[1]).To(HaveKeyWithValue("hashes", []interface{}{map[string]interface{}{"alg": "SHA-256", "content": "some-node-engine-sha"}}))
+			Expect(components[1]).To(HaveKeyWithValue("externalReferences", []interface{}{map[string]interface{}{
+				"type":    "other",
+				"url":     "https://example.com/node-engine-source.tgz",
+				"comment": "source",
+				"hashes":  []interface{}{map[string]interface{}{"alg": "SHA-256", "content": "some-node-engine-source-sha"}},
+			}}))
+			Expect(components[2]).To(Equal(map[string]interface{}{
+				"type":               "library",
+				"bom-ref":            "node@12.16.1",
+				"name":               "node",
+				"version":            "12.16.1",
+				"hashes":             []interface{}{map[string]interface{}{"alg": "SHA-256", "content": "some-node-sha"}},
+				"licenses":           []interface{}{map[string]interface{}{"expression": "MIT"}},
+				"externalReferences": []interface{}{map[string]interface{}{"type": "distribution", "url": "https://example.com/node.tgz"}},
+				"properties":         []interface{}{map[string]interface{}{"name": "cnb2cf:kind", "value": "dependency"}},
+			}))
+
+			Expect(document["dependencies"]).To(ConsistOf(
+				map[string]interface{}{"ref": "org.cloudfoundry.nodejs@1.0.0", "dependsOn": []interface{}{"lifecycle@0.7.2", "org.cloudfoundry.meta@0.1.0"}},
+				map[string]interface{}{"ref": "lifecycle@0.7.2", "dependsOn": []interface{}{}},
+				map[string]interface{}{"ref": "org.cloudfoundry.meta@0.1.0", "dependsOn": []interface{}{"org.cloudfoundry.node-engine@0.0.169"}},
+				map[string]interface{}{"ref": "org.cloudfoundry.node-engine@0.0.169", "dependsOn": []interface{}{"node@12.16.1"}},
+				map[string]interface{}{"ref": "node@12.16.1", "dependsOn": []interface{}{}},
+			))
+		})
+
+		it("writes an SPDX document", func() {
+			path := filepath.Join(tmpDir, cloudnative.SBOMFileName(cloudnative.SPDX))
+			Expect(path).To(HaveSuffix("sbom.spdx.json"))
+			Expect(cloudnative.WriteSBOM(sbom, cloudnative.SPDX, path)).To(Succeed())
+
+			document := read(path)
+			Expect(document["spdxVersion"]).To(Equal("SPDX-2.3"))
+			Expect(document["name"]).To(Equal("org.cloudfoundry.nodejs-1.0.0-cflinuxfs3"))
+			Expect(document["documentNamespace"]).To(HavePrefix("https://cloudfoundry.org/cnb2cf/spdx/org.cloudfoundry.nodejs-1.0.0-cflinuxfs3-"))
+			Expect(document["creationInfo"]).To(HaveKeyWithValue("created", "2020-09-13T12:26:40Z"))
+
+			packages := document["packages"].([]interface{})
+			Expect(packages).To(HaveLen(5))
+			Expect(packages[2]).To(HaveKeyWithValue("downloadLocation", "NOASSERTION"))
+			Expect(packages[2]).To(HaveKeyWithValue("checksums", []interface{}{map[string]interface{}{"algorithm": "SHA256", "checksumValue": "some-node-engine-sha"}}))
+			Expect(packages[2]).To(HaveKeyWithValue("sourceInfo", "built from https://example.com/node-engine-source.tgz with SHA256 some-node-engine-source-sha"))
+			Expect(packages[3]).To(Equal(map[string]interface{}{
+				"name":             "node",
+				"SPDXID":           "SPDXRef-Package-3",
+				"versionInfo":      "12.16.1",
+				"downloadLocation": "https://example.com/node.tgz",
+				"filesAnalyzed":    false,
+				"checksums":        []interface{}{map[string]interface{}{"algorithm": "SHA256", "checksumValue": "some-node-sha"}},
+				"licenseConcluded": "NOASSERTION",
+				"licenseDeclared":  "MIT",
+				"copyrightText":    "NOASSERTION",
+				"comment":          "dependency",
+			}))
+
+			Expect(document["relationships"]).To(ConsistOf(
+				map[string]interface{}{"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-Package-0"},
+				map[string]interface{}{"spdxElementId": "SPDXRef-Package-0", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-Package-1"},
+				map[string]interface{}{"spdxElementId": "SPDXRef-Package-0", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-Package-4"},
+				map[string]interface{}{"spdxElementId": "SPDXRef-Package-4", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-Package-2"},
+				map[string]interface{}{"spdxElementId": "SPDXRef-Package-2", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-Package-3"},
+			))
+		})
+
+		it("lists a component packaged by several buildpacks once", func() {
+			sbom.Components = append(sbom.Components, cloudnative.SBOMComponent{
+				Kind:    cloudnative.SBOMDependency,
+				ID:      "node",
+				Version: "12.16.1",
+				URI:     "https://example.com/node.tgz",
+				SHA256:  "some-node-sha",
+				Parent:  "org.cloudfoundry.meta",
+			})
+
+			path := filepath.Join(tmpDir, "sbom.cdx.json")
+			Expect(cloudnative.WriteSBOM(sbom, cloudnative.CycloneDX, path)).To(Succeed())
+
+			document := read(path)
+			Expect(document["components"]).To(HaveLen(4))
+			Expect(document["dependencies"]).To(ContainElement(
+				map[string]interface{}{"ref": "org.cloudfoundry.meta@0.1.0", "dependsOn": []interface{}{"org.cloudfoundry.node-engine@0.0.169", "node@12.16.1"}},
+			))
+		})
+
+		when("the format is unknown", func() {
+			it("returns an error", func() {
+				err := cloudnative.WriteSBOM(sbom, "some-format", filepath.Join(tmpDir, "sbom.json"))
+				Expect(err).To(MatchError(`unknown SBOM format "some-format", expected one of cyclonedx, spdx`))
+			})
+		})
+	})
+
+	when("IsSBOMFormat", func() {
+		it("accepts the supported formats", func() {
+			Expect(cloudnative.IsSBOMFormat("cyclonedx")).To(BeTrue())
+			Expect(cloudnative.IsSBOMFormat("spdx")).To(BeTrue())
+			Expect(cloudnative.IsSBOMFormat("swid")).To(BeFalse())
+		})
+	})
+}
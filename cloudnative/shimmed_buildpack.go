@@ -0,0 +1,77 @@
+package cloudnative
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/cloudfoundry/cnb2cf/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// ShimmedBuildpack describes the contents of a packaged shimmed buildpack zip.
+type ShimmedBuildpack struct {
+	Version   string
+	Buildpack Buildpack
+	Manifest  Manifest
+	Files     []string
+}
+
+func ReadShimmedBuildpack(path string) (ShimmedBuildpack, error) {
+	files, err := utils.GetFilesFromZip(path)
+	if err != nil {
+		return ShimmedBuildpack{}, fmt.Errorf("failed to open %s: %s", path, err)
+	}
+
+	manifestContents, err := utils.GetFileContentsFromZip(path, "manifest.yml")
+	if err != nil {
+		return ShimmedBuildpack{}, fmt.Errorf("failed to read manifest.yml from %s: %s", path, err)
+	}
+
+	var manifest Manifest
+	if err := yaml.Unmarshal(manifestContents, &manifest); err != nil {
+		return ShimmedBuildpack{}, fmt.Errorf("failed to parse manifest.yml from %s: %s", path, err)
+	}
+
+	buildpackContents, err := utils.GetFileContentsFromZip(path, "buildpack.toml")
+	if err != nil {
+		return ShimmedBuildpack{}, fmt.Errorf("failed to read buildpack.toml from %s: %s", path, err)
+	}
+
+	var buildpack Buildpack
+	if _, err := toml.Decode(string(buildpackContents), &buildpack); err != nil {
+		return ShimmedBuildpack{}, fmt.Errorf("failed to parse buildpack.toml from %s: %s", path, err)
+	}
+
+	versionContents, err := utils.GetFileContentsFromZip(path, "VERSION")
+	if err != nil {
+		return ShimmedBuildpack{}, fmt.Errorf("failed to read VERSION from %s: %s", path, err)
+	}
+
+	return ShimmedBuildpack{
+		Version:   strings.TrimSpace(string(versionContents)),
+		Buildpack: buildpack,
+		Manifest:  manifest,
+		Files:     files,
+	}, nil
+}
+
+func (s ShimmedBuildpack) HasFile(name string) bool {
+	for _, file := range s.Files {
+		if file == name {
+			return true
+		}
+	}
+	return false
+}
+
+// LifecycleVersion returns the version of the lifecycle dependency, or an
+// empty string if the buildpack does not contain one.
+func (s ShimmedBuildpack) LifecycleVersion() string {
+	for _, dependency := range s.Manifest.Dependencies {
+		if dependency.ID == Lifecycle {
+			return dependency.Version
+		}
+	}
+	return ""
+}
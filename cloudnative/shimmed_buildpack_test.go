@@ -0,0 +1,124 @@
+package cloudnative_test
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testShimmedBuildpack(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		tmpDir  string
+		zipPath string
+	)
+
+	writeZip := func(files map[string]string) {
+		file, err := os.Create(zipPath)
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close()
+
+		writer := zip.NewWriter(file)
+		for name, contents := range files {
+			w, err := writer.Create(name)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = w.Write([]byte(contents))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(writer.Close()).To(Succeed())
+	}
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "shimmed-buildpack")
+		Expect(err).NotTo(HaveOccurred())
+
+		zipPath = filepath.Join(tmpDir, "some_buildpack-cflinuxfs3-v1.2.3.zip")
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	when("ReadShimmedBuildpack", func() {
+		it.Before(func() {
+			writeZip(map[string]string{
+				"VERSION": "1.2.3\n",
+				"buildpack.toml": `
+[buildpack]
+id = "org.cloudfoundry.some-language"
+name = "Some Buildpack"
+version = "1.2.3"
+
+[[order]]
+[[order.group]]
+id = "some-dependency"
+version = "1.0.0"
+`,
+				"manifest.yml": `---
+language: some-language
+stack: cflinuxfs3
+dependencies:
+- name: lifecycle
+  id: lifecycle
+  version: 0.7.2
+  uri: https://example.com/lifecycle.tgz
+  sha256: some-lifecycle-sha256
+  file: dependencies/abc/lifecycle.tgz
+- name: some-dependency
+  id: some-dependency
+  version: 1.0.0
+  uri: file:///tmp/some-dependency.tgz
+  sha256: some-dependency-sha256
+  file: dependencies/def/some-dependency.tgz
+`,
+				"dependencies/abc/lifecycle.tgz": "lifecycle",
+			})
+		})
+
+		it("reads the VERSION, buildpack.toml and manifest.yml", func() {
+			shimmed, err := cloudnative.ReadShimmedBuildpack(zipPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(shimmed.Version).To(Equal("1.2.3"))
+			Expect(shimmed.Buildpack.Info.ID).To(Equal("org.cloudfoundry.some-language"))
+			Expect(shimmed.Buildpack.Orders).To(HaveLen(1))
+			Expect(shimmed.Manifest.Stack).To(Equal("cflinuxfs3"))
+			Expect(shimmed.Manifest.Dependencies).To(HaveLen(2))
+			Expect(shimmed.Manifest.Dependencies[1].File).To(Equal("dependencies/def/some-dependency.tgz"))
+			Expect(shimmed.LifecycleVersion()).To(Equal("0.7.2"))
+			Expect(shimmed.HasFile("dependencies/abc/lifecycle.tgz")).To(BeTrue())
+			Expect(shimmed.HasFile("dependencies/def/some-dependency.tgz")).To(BeFalse())
+		})
+
+		when("failure cases", func() {
+			when("the zip does not exist", func() {
+				it("returns an error", func() {
+					_, err := cloudnative.ReadShimmedBuildpack(filepath.Join(tmpDir, "missing.zip"))
+					Expect(err).To(MatchError(ContainSubstring("failed to open")))
+				})
+			})
+
+			when("the zip has no manifest.yml", func() {
+				it.Before(func() {
+					writeZip(map[string]string{"VERSION": "1.2.3"})
+				})
+
+				it("returns an error", func() {
+					_, err := cloudnative.ReadShimmedBuildpack(zipPath)
+					Expect(err).To(MatchError(ContainSubstring("failed to read manifest.yml")))
+				})
+			})
+		})
+	})
+}
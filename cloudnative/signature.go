@@ -0,0 +1,126 @@
+package cloudnative
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry/cnb2cf/signature"
+)
+
+// ReadSigningKey reads a PEM encoded PKCS #8 ed25519 private key, as
+// written by `openssl genpkey -algorithm ed25519`.
+func ReadSigningKey(path string) (ed25519.PrivateKey, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, NewError(ParseError, err, "failed to read signing key")
+	}
+
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, NewError(ParseError, errors.New("no PEM block found"), "failed to parse signing key %s", path)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, NewError(ParseError, err, "failed to parse signing key %s", path)
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, NewError(ParseError, fmt.Errorf("%T is not an ed25519 key", key), "failed to parse signing key %s", path)
+	}
+
+	return privateKey, nil
+}
+
+// SignManifest signs the manifest.yml inside the shimmed buildpack zip at
+// path and adds the signature to the zip as signature.ManifestFile. The zip
+// must be complete, as the packager rewrites manifest.yml while zipping.
+func SignManifest(path string, key ed25519.PrivateKey) error {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	output, err := ioutil.TempFile(filepath.Dir(path), ".sign-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(output.Name())
+	defer output.Close()
+
+	var manifestSignature []byte
+	zw := zip.NewWriter(output)
+	for _, file := range reader.File {
+		if file.Name == signature.ManifestFile {
+			continue
+		}
+
+		header := file.FileHeader
+		writer, err := zw.CreateHeader(&header)
+		if err != nil {
+			return err
+		}
+
+		contents, err := file.Open()
+		if err != nil {
+			return err
+		}
+
+		var manifest bytes.Buffer
+		if file.Name == "manifest.yml" {
+			writer = io.MultiWriter(writer, &manifest)
+		}
+
+		_, err = io.Copy(writer, contents)
+		contents.Close()
+		if err != nil {
+			return err
+		}
+
+		if file.Name == "manifest.yml" {
+			manifestSignature = ed25519.Sign(key, manifest.Bytes())
+		}
+	}
+
+	if manifestSignature == nil {
+		return fmt.Errorf("%s has no manifest.yml", path)
+	}
+
+	header := &zip.FileHeader{Name: signature.ManifestFile, Method: zip.Deflate, Modified: time.Now()}
+	header.SetMode(0644)
+	writer, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.Write([]byte(base64.StdEncoding.EncodeToString(manifestSignature) + "\n")); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	if err := output.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(output.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(output.Name(), path)
+}
@@ -0,0 +1,112 @@
+package cloudnative_test
+
+import (
+	"archive/zip"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/cloudfoundry/cnb2cf/signature"
+	"github.com/cloudfoundry/cnb2cf/utils"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testSignature(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		tmpDir     string
+		publicKey  ed25519.PublicKey
+		privateKey ed25519.PrivateKey
+		keyPath    string
+	)
+
+	writePEM := func(path, kind string, der []byte) {
+		Expect(ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600)).To(Succeed())
+	}
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "signature")
+		Expect(err).NotTo(HaveOccurred())
+
+		publicKey, privateKey, err = ed25519.GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		keyPath = filepath.Join(tmpDir, "key.pem")
+		writePEM(keyPath, "PRIVATE KEY", der)
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	when("ReadSigningKey", func() {
+		it("reads a PKCS #8 ed25519 key", func() {
+			key, err := cloudnative.ReadSigningKey(keyPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(key).To(Equal(privateKey))
+		})
+
+		when("the key is not an ed25519 key", func() {
+			it("returns a parse error", func() {
+				ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+				Expect(err).NotTo(HaveOccurred())
+
+				der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+				Expect(err).NotTo(HaveOccurred())
+				writePEM(keyPath, "PRIVATE KEY", der)
+
+				_, err = cloudnative.ReadSigningKey(keyPath)
+				Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.ParseError))
+				Expect(err).To(MatchError(ContainSubstring("is not an ed25519 key")))
+			})
+		})
+	})
+
+	when("SignManifest", func() {
+		it("adds a signature over manifest.yml to the zip", func() {
+			path := filepath.Join(tmpDir, "buildpack.zip")
+			file, err := os.Create(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			zw := zip.NewWriter(file)
+			for name, contents := range map[string]string{"manifest.yml": "language: nodejs\n", "VERSION": "1.0.0"} {
+				writer, err := zw.Create(name)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = writer.Write([]byte(contents))
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(zw.Close()).To(Succeed())
+			Expect(file.Close()).To(Succeed())
+
+			Expect(cloudnative.SignManifest(path, privateKey)).To(Succeed())
+
+			files, err := utils.GetFilesFromZip(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(ConsistOf("manifest.yml", "VERSION", "manifest.yml.sig"))
+
+			for _, name := range []string{"manifest.yml", "manifest.yml.sig"} {
+				contents, err := utils.GetFileContentsFromZip(path, name)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(filepath.Join(tmpDir, name), contents, 0644)).To(Succeed())
+			}
+			Expect(signature.VerifyFile(filepath.Join(tmpDir, "manifest.yml"), filepath.Join(tmpDir, "manifest.yml.sig"), publicKey)).To(Succeed())
+		})
+	})
+}
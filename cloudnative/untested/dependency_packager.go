@@ -5,15 +5,19 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/cloudfoundry/cnb2cf/cloudnative"
 	"github.com/cloudfoundry/cnb2cf/packager"
 	"github.com/cloudfoundry/cnb2cf/shims"
+	"github.com/cloudfoundry/libbuildpack"
 )
 
 //go:generate faux -i Installer -o fakes/installer.go
 type Installer interface {
 	Download(uri, checksum, destination string) error
+	DownloadImage(reference, id, version, destination string) (string, string, error)
 }
 
 type DependencyPackager struct {
@@ -22,90 +26,478 @@ type DependencyPackager struct {
 	scratchDirectory string
 	cached           bool
 	dev              bool
+	release          bool
+
+	// reproducible packagers normalize the CNBs they build and keep every
+	// packaged CNB in storeDir under its checksum, so that their paths and
+	// checksums only depend on their contents
+	reproducible bool
+	sourceDate   time.Time
+	storeDir     string
+
+	// built holds the result of building each dependency, so that packaging
+	// the same buildpack for several stacks downloads and builds it once.
+	built   map[string]*buildResult
+	builtMu *sync.Mutex
+
+	// buildpackages holds the layout each .cnb archive was unpacked to, so
+	// that a meta-buildpack and the children packaged with it share one copy.
+	buildpackages map[string]*extractResult
+}
+
+type buildResult struct {
+	done  chan struct{}
+	built builtDependency
+	err   error
+}
+
+// PackagedDependency is a dependency as it was packaged, along with the
+// meta-buildpack it was packaged for and the tool it was built with, if any.
+// Origin is where the CNB came from: the source it was built from, or the
+// released CNB or image it was packaged from. RuntimeDependencies are the
+// dependencies that the CNB itself declares.
+type PackagedDependency struct {
+	cloudnative.BuildpackMetadataDependency
+	Parent              string
+	BuildTool           string
+	Origin              string
+	RuntimeDependencies []cloudnative.BuildpackMetadataDependency
+}
+
+type extractResult struct {
+	done   chan struct{}
+	layout string
+	err    error
 }
 
-func NewDependencyPackager(scratchDirectory string, cached, dev bool, installer Installer) DependencyPackager {
+type builtDependency struct {
+	uri      string
+	sha256   string
+	children []cloudnative.BuildpackMetadataDependency
+
+	// buildTool is the tool the CNB was built with, empty if it was packaged as it was downloaded
+	buildTool string
+
+	// origin is the source, released CNB or image the CNB came from
+	origin string
+
+	// source and sourceSHA256 pin a CNB image or git source to the digest or
+	// commit it was built from
+	source       string
+	sourceSHA256 string
+
+	// licenses and runtime are declared by the buildpack.toml of a CNB that
+	// is not a meta-buildpack
+	licenses []string
+	runtime  []cloudnative.BuildpackMetadataDependency
+}
+
+// NewDependencyPackager returns a packager that rebuilds each CNB from its
+// source, or, in release mode, packages the released CNB tarball as it is.
+func NewDependencyPackager(scratchDirectory string, cached, dev, release bool, installer Installer) DependencyPackager {
 	return DependencyPackager{
 		installer:        installer,
 		scratchDirectory: scratchDirectory,
 		cached:           cached,
 		dev:              dev,
+		release:          release,
+		built:            map[string]*buildResult{},
+		builtMu:          &sync.Mutex{},
+		buildpackages:    map[string]*extractResult{},
+	}
+}
+
+// WithReproducible returns a packager that normalizes the CNBs it builds,
+// stamping them with sourceDate, and keeps the CNBs it packages in storeDir.
+func (dp DependencyPackager) WithReproducible(sourceDate time.Time, storeDir string) DependencyPackager {
+	dp.reproducible = true
+	dp.sourceDate = sourceDate
+	dp.storeDir = storeDir
+	return dp
+}
+
+// PackageAll packages each of the dependencies for the stack, running up to
+// jobs of them at once. The result keeps the order of dependencies, and
+// every dependency that fails is reported.
+func (dp DependencyPackager) PackageAll(dependencies []cloudnative.BuildpackMetadataDependency, stack string, jobs int) ([]PackagedDependency, error) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	results := make([][]PackagedDependency, len(dependencies))
+	errs := make([]error, len(dependencies))
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i], errs[i] = dp.Package(dependencies[i], stack)
+			}
+		}()
+	}
+
+	for i := range dependencies {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	var packaged []PackagedDependency
+	var failures cloudnative.Errors
+	for i := range dependencies {
+		if errs[i] != nil {
+			failures = append(failures, errs[i])
+			continue
+		}
+		packaged = append(packaged, results[i]...)
+	}
+
+	switch len(failures) {
+	case 0:
+		return packaged, nil
+	case 1:
+		return nil, failures[0]
+	default:
+		return nil, failures
 	}
 }
 
-func (dp DependencyPackager) Package(dependency cloudnative.BuildpackMetadataDependency, stack string) ([]cloudnative.BuildpackMetadataDependency, error) {
+// Package packages the dependency for the stack, followed by the children
+// it depends on if it is a meta-buildpack.
+func (dp DependencyPackager) Package(dependency cloudnative.BuildpackMetadataDependency, stack string) ([]PackagedDependency, error) {
+	return dp.packageDependency(dependency, stack, "")
+}
+
+func (dp DependencyPackager) packageDependency(dependency cloudnative.BuildpackMetadataDependency, stack, parent string) ([]PackagedDependency, error) {
 	if !dependency.MatchesStack(stack) {
 		return nil, nil
 	}
 
-	downloadDir, err := ioutil.TempDir(dp.scratchDirectory, "download")
+	built, err := dp.build(dependency)
 	if err != nil {
 		return nil, err
 	}
 
+	var dependencies []PackagedDependency
+	for _, d := range built.children {
+		children, err := dp.packageDependency(d, stack, dependency.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		dependencies = append(dependencies, children...)
+	}
+
+	dependency.URI = built.uri
+	dependency.SHA256 = built.sha256
+	if built.source != "" {
+		dependency.Source = built.source
+		dependency.SourceSHA256 = built.sourceSHA256
+	}
+
+	if len(dependency.Licenses) == 0 {
+		dependency.Licenses = built.licenses
+	}
+
+	stacks := make([]string, len(dependency.Stacks))
+	for i, stack := range dependency.Stacks {
+		// Translate stack from org.cloudfoundry.stacks.cflinuxfs3 to just cflinuxfs3
+		parts := strings.Split(stack, ".stacks.")
+		if len(parts) != 2 {
+			return nil, cloudnative.NewError(cloudnative.ParseError, nil, "invalid stack %q for %s", stack, dependency.ID)
+		}
+		stacks[i] = parts[1]
+	}
+	dependency.Stacks = stacks
+
+	dependencies = append(dependencies, PackagedDependency{
+		BuildpackMetadataDependency: dependency,
+		Parent:                      parent,
+		BuildTool:                   built.buildTool,
+		Origin:                      built.origin,
+		RuntimeDependencies:         built.runtime,
+	})
+
+	return dependencies, nil
+}
+
+// build downloads and builds a dependency once. The built CNB does not
+// depend on the stack it is packaged for, so the result is reused for
+// every stack that lists the dependency. Concurrent callers asking for the
+// same dependency wait for the first build to finish.
+func (dp DependencyPackager) build(dependency cloudnative.BuildpackMetadataDependency) (builtDependency, error) {
+	key := strings.Join([]string{dependency.ID, dependency.Version, dependency.URI, dependency.Source, dependency.SourceSHA256}, "|")
+
+	dp.builtMu.Lock()
+	result, ok := dp.built[key]
+	if ok {
+		dp.builtMu.Unlock()
+		<-result.done
+		return result.built, result.err
+	}
+
+	result = &buildResult{done: make(chan struct{})}
+	dp.built[key] = result
+	dp.builtMu.Unlock()
+
+	result.built, result.err = dp.buildDependency(dependency)
+	close(result.done)
+
+	return result.built, result.err
+}
+
+func (dp DependencyPackager) buildDependency(dependency cloudnative.BuildpackMetadataDependency) (builtDependency, error) {
+	downloadDir, err := ioutil.TempDir(dp.scratchDirectory, "download")
+	if err != nil {
+		return builtDependency{}, err
+	}
+
 	buildDir, err := ioutil.TempDir(dp.scratchDirectory, "build")
 	if err != nil {
-		return nil, err
+		return builtDependency{}, err
+	}
+
+	image, checksum := dependency.Source, dependency.SourceSHA256
+	if dp.release {
+		image, checksum = dependency.URI, dependency.SHA256
 	}
 
-	var tarFile string
+	built := builtDependency{uri: dependency.URI, sha256: dependency.SHA256, origin: image}
 	if dependency.ID == cloudnative.Lifecycle {
+		built.origin = dependency.URI
+	}
+
+	// a .cnb buildpackage holds an OCI layout, so once unpacked it is read like any other image
+	buildpackage := dependency.ID != cloudnative.Lifecycle && cloudnative.IsBuildpackage(image)
+	if buildpackage {
+		layout, err := dp.extractBuildpackage(image, checksum)
+		if err != nil {
+			return builtDependency{}, err
+		}
+		image = "oci://" + layout
+	}
+
+	fromImage := dependency.ID != cloudnative.Lifecycle && cloudnative.IsImageReference(image)
+
+	var tarFile, pinned string
+	if fromImage {
+		tarFile = filepath.Join(buildDir, shims.SanitizeId(dependency.ID)+".tgz")
+		var sha256 string
+		pinned, sha256, err = dp.installer.DownloadImage(image, dependency.ID, dependency.Version, tarFile)
+		if err != nil {
+			return builtDependency{}, cloudnative.NewError(cloudnative.DownloadError, err, "failed to download cnb image for %s", dependency.ID)
+		}
+
+		built.sha256 = sha256
+		if !buildpackage {
+			// a buildpackage is already pinned by its checksum
+			built.source = pinned
+			built.origin = pinned
+			built.sourceSHA256 = strings.TrimPrefix(pinned[strings.LastIndex(pinned, "@")+1:], "sha256:")
+		}
+	} else if dependency.ID == cloudnative.Lifecycle || dp.release {
 		tarFileName := shims.SanitizeId(dependency.ID) + ".tgz"
 		tarFile = filepath.Join(buildDir, tarFileName)
 		err := dp.installer.Download(dependency.URI, dependency.SHA256, tarFile)
 		if err != nil {
-			return nil, fmt.Errorf("failed to download cnb source for %s: %s", dependency.ID, err)
+			return builtDependency{}, cloudnative.NewError(cloudnative.DownloadError, err, "failed to download cnb for %s", dependency.ID)
+		}
+	} else if cloudnative.IsGitSource(dependency.Source) {
+		// git sources are checked out straight into the directory the CNB is built from
+		built.source, err = cloudnative.CheckoutGitSource(dependency.Source, downloadDir)
+		if err != nil {
+			return builtDependency{}, cloudnative.NewError(cloudnative.DownloadError, err, "failed to download cnb source for %s", dependency.ID)
 		}
+		built.origin = built.source
+	} else if strings.HasPrefix(dependency.Source, "file://") && strings.HasSuffix(dependency.Source, "/") {
+		// local directory sources are copied as they are, there is no archive to checksum
+		tarFile = strings.TrimPrefix(dependency.Source, "file://")
 	} else {
 		tarFile = filepath.Join(downloadDir, filepath.Base(dependency.Source))
 		err := dp.installer.Download(dependency.Source, dependency.SourceSHA256, tarFile)
 		if err != nil {
-			return nil, fmt.Errorf("failed to download cnb source for %s: %s", dependency.ID, err)
+			return builtDependency{}, cloudnative.NewError(cloudnative.DownloadError, err, "failed to download cnb source for %s", dependency.ID)
 		}
 	}
 
-	var dependencies []cloudnative.BuildpackMetadataDependency
-	if dependency.ID != cloudnative.Lifecycle {
-		if err := packager.ExtractCNBSource(dependency, tarFile, downloadDir); err != nil {
-			return nil, fmt.Errorf("failed to extract cnb source for %s: %s", dependency.ID, err)
+	if dependency.ID == cloudnative.Lifecycle {
+		return built, nil
+	}
+
+	if dp.release || fromImage {
+		// released CNBs and CNB images are packaged as they are, they are only extracted to read their buildpack.toml
+		if err := libbuildpack.ExtractTarGz(tarFile, downloadDir); err != nil {
+			return builtDependency{}, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to extract released cnb for %s", dependency.ID)
+		}
+
+		built.uri = fmt.Sprintf("file://%s", tarFile)
+	} else {
+		if !cloudnative.IsGitSource(dependency.Source) {
+			if err := packager.ExtractCNBSource(dependency, tarFile, downloadDir); err != nil {
+				return builtDependency{}, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to extract cnb source for %s", dependency.ID)
+			}
+		}
+
+		built.buildTool, err = packager.BuildTool(downloadDir)
+		if err != nil {
+			return builtDependency{}, cloudnative.NewError(cloudnative.BuildError, err, "failed to build cnb %s", dependency.ID)
 		}
 
 		tarFileName := shims.SanitizeId(dependency.ID)
 		tarballPath, sha256, err := packager.BuildCNB(downloadDir, filepath.Join(buildDir, tarFileName), dp.cached, dependency.Version)
 		if err != nil {
-			panic(err)
+			return builtDependency{}, cloudnative.NewError(cloudnative.BuildError, err, "failed to build cnb %s", dependency.ID)
 		}
 
-		path, err := packager.FindCNB(downloadDir)
-		if err != nil {
-			panic(err)
+		if dp.reproducible {
+			sha256, err = cloudnative.NormalizeTarGz(tarballPath, dp.sourceDate)
+			if err != nil {
+				return builtDependency{}, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to normalize cnb %s", dependency.ID)
+			}
 		}
 
-		buildpack, err := cloudnative.ParseBuildpack(filepath.Join(path, "buildpack.toml"))
+		built.uri = fmt.Sprintf("file://%s", tarballPath)
+		built.sha256 = sha256
+	}
+
+	if dp.reproducible {
+		// the scratch directory differs between runs, and the uri ends up in the manifest and the zip
+		path, err := cloudnative.StoreByChecksum(strings.TrimPrefix(built.uri, "file://"), built.sha256, dp.storeDir)
 		if err != nil {
-			panic(err)
+			return builtDependency{}, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to store cnb %s", dependency.ID)
 		}
 
-		if len(buildpack.Orders) > 0 {
-			for _, d := range buildpack.Metadata.Dependencies {
-				children, err := dp.Package(d, stack)
-				if err != nil {
-					return nil, err
-				}
+		built.uri = fmt.Sprintf("file://%s", path)
+	}
+
+	path, err := packager.FindCNB(downloadDir)
+	if err != nil {
+		return builtDependency{}, cloudnative.NewError(cloudnative.BuildError, err, "failed to find cnb for %s", dependency.ID)
+	}
 
-				dependencies = append(dependencies, children...)
+	buildpack, err := cloudnative.ParseBuildpack(filepath.Join(path, "buildpack.toml"))
+	if err != nil {
+		return builtDependency{}, err
+	}
+
+	for _, license := range buildpack.Info.Licenses {
+		built.licenses = append(built.licenses, license.Type)
+	}
+
+	if len(buildpack.Orders) == 0 {
+		built.runtime = buildpack.Metadata.Dependencies
+	} else {
+		built.children = buildpack.Metadata.Dependencies
+		if len(built.children) == 0 && fromImage {
+			// the children of a meta-buildpack image are packaged in the same image
+			built.children, err = imageChildren(dependency, buildpack.Orders, pinned, buildpackage)
+			if err != nil {
+				return builtDependency{}, err
 			}
 		}
-		dependency.URI = fmt.Sprintf("file://%s", tarballPath)
-		dependency.SHA256 = sha256
 	}
 
-	for i, stack := range dependency.Stacks {
-		// Translate stack from org.cloudfoundry.stacks.cflinuxfs3 to just cflinuxfs3
-		dependency.Stacks[i] = strings.Split(stack, ".stacks.")[1]
+	return built, nil
+}
+
+// extractBuildpackage downloads and unpacks a .cnb buildpackage once, and
+// returns the directory holding its OCI layout.
+func (dp DependencyPackager) extractBuildpackage(uri, checksum string) (string, error) {
+	key := uri + "|" + checksum
+
+	dp.builtMu.Lock()
+	result, ok := dp.buildpackages[key]
+	if ok {
+		dp.builtMu.Unlock()
+		<-result.done
+		return result.layout, result.err
 	}
 
-	dependencies = append(dependencies, dependency)
+	result = &extractResult{done: make(chan struct{})}
+	dp.buildpackages[key] = result
+	dp.builtMu.Unlock()
 
-	return dependencies, nil
+	defer close(result.done)
+
+	dir, err := ioutil.TempDir(dp.scratchDirectory, "buildpackage")
+	if err != nil {
+		result.err = err
+		return "", err
+	}
+
+	archive := filepath.Join(dir, filepath.Base(uri))
+	if err := dp.installer.Download(uri, checksum, archive); err != nil {
+		result.err = cloudnative.NewError(cloudnative.DownloadError, err, "failed to download buildpackage %s", uri)
+		return "", result.err
+	}
+
+	layout := filepath.Join(dir, "layout")
+	if err := cloudnative.ExtractBuildpackage(archive, layout); err != nil {
+		result.err = err
+		return "", err
+	}
+
+	result.layout = layout
+	return layout, nil
+}
+
+// imageChildren returns the buildpacks that the order groups of a
+// meta-buildpack refer to, read from the image the meta-buildpack came from.
+// Children of a buildpackage point back at the same archive.
+func imageChildren(parent cloudnative.BuildpackMetadataDependency, orders []cloudnative.BuildpackOrder, reference string, buildpackage bool) ([]cloudnative.BuildpackMetadataDependency, error) {
+	image, _, err := cloudnative.ResolveImage(reference)
+	if err != nil {
+		return nil, err
+	}
+
+	buildpacks, err := cloudnative.ImageBuildpacks(image)
+	if err != nil {
+		return nil, cloudnative.NewError(cloudnative.BuildError, err, "failed to list buildpacks in %s", reference)
+	}
+
+	var children []cloudnative.BuildpackMetadataDependency
+	seen := map[string]bool{}
+	for _, order := range orders {
+		for _, group := range order.Groups {
+			found := false
+			for _, buildpack := range buildpacks {
+				if buildpack.ID != group.ID || (group.Version != "" && buildpack.Version != group.Version) {
+					continue
+				}
+				found = true
+
+				key := buildpack.ID + "@" + buildpack.Version
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+
+				child := cloudnative.BuildpackMetadataDependency{
+					ID:      buildpack.ID,
+					Version: buildpack.Version,
+					URI:     reference,
+					Source:  reference,
+					Stacks:  buildpack.Stacks,
+				}
+				if buildpackage {
+					child.URI, child.SHA256 = parent.URI, parent.SHA256
+					child.Source, child.SourceSHA256 = parent.Source, parent.SourceSHA256
+				}
+				if len(child.Stacks) == 0 {
+					child.Stacks = parent.Stacks
+				}
+
+				children = append(children, child)
+			}
+
+			if !found && !group.Optional {
+				return nil, cloudnative.NewError(cloudnative.BuildError, nil, "%s does not contain %s@%s, which %s depends on", reference, group.ID, group.Version, parent.ID)
+			}
+		}
+	}
+
+	return children, nil
 }
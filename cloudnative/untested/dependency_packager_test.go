@@ -0,0 +1,175 @@
+package untested_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/cloudfoundry/cnb2cf/cloudnative/untested"
+	"github.com/cloudfoundry/cnb2cf/cloudnative/untested/fakes"
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestUnitDependencyPackager(t *testing.T) {
+	spec.Run(t, "DependencyPackager", testDependencyPackager, spec.Report(report.Terminal{}))
+}
+
+func testDependencyPackager(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		tmpDir       string
+		installer    *fakes.Installer
+		packager     untested.DependencyPackager
+		dependencies []cloudnative.BuildpackMetadataDependency
+		failing      map[string]bool
+	)
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "dependency-packager")
+		Expect(err).NotTo(HaveOccurred())
+
+		scratchDir := filepath.Join(tmpDir, "scratch")
+		Expect(os.MkdirAll(scratchDir, 0755)).To(Succeed())
+
+		dependencies = nil
+		for i := 0; i < 5; i++ {
+			id := fmt.Sprintf("org.cloudfoundry.cnb-%d", i)
+			path := filepath.Join(tmpDir, id+".tgz")
+			writeTarGz(t, path, map[string]string{"buildpack.toml": fmt.Sprintf(`api = "0.2"
+
+[buildpack]
+  id = %q
+  version = "1.0.0"
+
+[[metadata.dependencies]]
+  id = "jre"
+  version = "11.0.9"
+
+  [[metadata.dependencies.licenses]]
+    type = "GPL-2.0 WITH Classpath-exception-2.0"
+    uri = "https://openjdk.java.net/legal/gplv2+ce.html"
+`, id)})
+
+			dependencies = append(dependencies, cloudnative.BuildpackMetadataDependency{
+				ID:      id,
+				Version: "1.0.0",
+				URI:     "file://" + path,
+				SHA256:  strings.Repeat(fmt.Sprint(i), 64),
+				Stacks:  []string{"org.cloudfoundry.stacks.cflinuxfs3"},
+			})
+		}
+
+		// the fake installer downloads file uris by copying them, failing for the uris in failing
+		failing = map[string]bool{}
+		installer = &fakes.Installer{}
+		installer.DownloadCall.Stub = func(uri, checksum, destination string) error {
+			if failing[uri] {
+				return errors.New("connection refused")
+			}
+			return libbuildpack.CopyFile(strings.TrimPrefix(uri, "file://"), destination)
+		}
+
+		packager = untested.NewDependencyPackager(scratchDir, false, false, true, installer)
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	when("PackageAll", func() {
+		it("packages every dependency, keeping their order", func() {
+			packaged, err := packager.PackageAll(dependencies, "cflinuxfs3", 3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(installer.DownloadCall.CallCount).To(Equal(5))
+
+			var ids []string
+			for _, dependency := range packaged {
+				ids = append(ids, dependency.ID)
+				Expect(dependency.Stacks).To(Equal([]string{"cflinuxfs3"}))
+				Expect(strings.TrimPrefix(dependency.URI, "file://")).To(BeARegularFile())
+				Expect(dependency.RuntimeDependencies).To(HaveLen(1))
+				Expect(dependency.RuntimeDependencies[0].Licenses).To(Equal(cloudnative.DependencyLicenses{"GPL-2.0 WITH Classpath-exception-2.0"}))
+			}
+			Expect(ids).To(Equal([]string{
+				"org.cloudfoundry.cnb-0",
+				"org.cloudfoundry.cnb-1",
+				"org.cloudfoundry.cnb-2",
+				"org.cloudfoundry.cnb-3",
+				"org.cloudfoundry.cnb-4",
+			}))
+		})
+
+		it("packages one at a time when jobs is less than one", func() {
+			packaged, err := packager.PackageAll(dependencies, "cflinuxfs3", 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(packaged).To(HaveLen(5))
+		})
+
+		when("several dependencies fail", func() {
+			it.Before(func() {
+				failing[dependencies[3].URI] = true
+				failing[dependencies[1].URI] = true
+			})
+
+			it("reports every failure in the order of the dependencies", func() {
+				packaged, err := packager.PackageAll(dependencies, "cflinuxfs3", 3)
+				Expect(packaged).To(BeNil())
+				Expect(installer.DownloadCall.CallCount).To(Equal(5))
+
+				Expect(err).To(BeAssignableToTypeOf(cloudnative.Errors{}))
+				failures := err.(cloudnative.Errors)
+				Expect(failures).To(HaveLen(2))
+				Expect(failures[0]).To(MatchError(ContainSubstring("failed to download cnb for org.cloudfoundry.cnb-1")))
+				Expect(failures[1]).To(MatchError(ContainSubstring("failed to download cnb for org.cloudfoundry.cnb-3")))
+				Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.DownloadError))
+			})
+		})
+
+		when("one dependency fails", func() {
+			it.Before(func() {
+				failing[dependencies[2].URI] = true
+			})
+
+			it("returns its error alone", func() {
+				_, err := packager.PackageAll(dependencies, "cflinuxfs3", 3)
+				Expect(err).NotTo(BeAssignableToTypeOf(cloudnative.Errors{}))
+				Expect(err).To(MatchError(ContainSubstring("failed to download cnb for org.cloudfoundry.cnb-2")))
+				Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.DownloadError))
+			})
+		})
+	})
+}
+
+// writeTarGz writes files to a gzipped tarball at path.
+func writeTarGz(t *testing.T, path string, files map[string]string) {
+	Expect := NewWithT(t).Expect
+
+	file, err := os.Create(path)
+	Expect(err).NotTo(HaveOccurred())
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	for name, contents := range files {
+		Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents))})).To(Succeed())
+		_, err := tw.Write([]byte(contents))
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(tw.Close()).To(Succeed())
+	Expect(gz.Close()).To(Succeed())
+}
@@ -16,6 +16,22 @@ type Installer struct {
 		}
 		Stub func(string, string, string) error
 	}
+	DownloadImageCall struct {
+		sync.Mutex
+		CallCount int
+		Receives  struct {
+			Reference   string
+			Id          string
+			Version     string
+			Destination string
+		}
+		Returns struct {
+			String_1 string
+			String_2 string
+			Error    error
+		}
+		Stub func(string, string, string, string) (string, string, error)
+	}
 }
 
 func (f *Installer) Download(param1 string, param2 string, param3 string) error {
@@ -30,3 +46,17 @@ func (f *Installer) Download(param1 string, param2 string, param3 string) error
 	}
 	return f.DownloadCall.Returns.Error
 }
+
+func (f *Installer) DownloadImage(param1 string, param2 string, param3 string, param4 string) (string, string, error) {
+	f.DownloadImageCall.Lock()
+	defer f.DownloadImageCall.Unlock()
+	f.DownloadImageCall.CallCount++
+	f.DownloadImageCall.Receives.Reference = param1
+	f.DownloadImageCall.Receives.Id = param2
+	f.DownloadImageCall.Receives.Version = param3
+	f.DownloadImageCall.Receives.Destination = param4
+	if f.DownloadImageCall.Stub != nil {
+		return f.DownloadImageCall.Stub(param1, param2, param3, param4)
+	}
+	return f.DownloadImageCall.Returns.String_1, f.DownloadImageCall.Returns.String_2, f.DownloadImageCall.Returns.Error
+}
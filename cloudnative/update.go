@@ -0,0 +1,217 @@
+package cloudnative
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// DependencyUpdate records a dependency that was moved to a newer release.
+type DependencyUpdate struct {
+	ID   string
+	From string
+	To   string
+}
+
+var tomlStringValue = regexp.MustCompile(`^(\s*[A-Za-z0-9_-]+\s*=\s*)("(?:[^"\\]|\\.)*"|'[^']*')(\s*(?:#.*)?)$`)
+
+// UpdateBuildpack moves each dependency of the buildpack.toml at path that
+// the index lists to its latest release, along with the order groups that
+// refer to it. Where an id is listed more than once, only the entries with
+// its highest version are moved. A source or source_sha256 that the new
+// release does not have is removed. The file is edited line by line so that
+// its formatting and comments are kept; the updated contents are returned
+// rather than written.
+func UpdateBuildpack(path string, index ReleaseIndex) ([]byte, []DependencyUpdate, error) {
+	buildpack, err := ParseBuildpack(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tables, err := indexTOMLLines(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current := map[string]*semver.Version{}
+	for _, dependency := range buildpack.Metadata.Dependencies {
+		version, err := semver.NewVersion(dependency.Version)
+		if err != nil {
+			continue
+		}
+
+		if current[dependency.ID] == nil || version.GreaterThan(current[dependency.ID]) {
+			current[dependency.ID] = version
+		}
+	}
+
+	lines := strings.SplitAfter(string(contents), "\n")
+	edits := tomlEdits{lines: lines, inserts: map[int][]string{}, removed: map[int]bool{}}
+
+	var updates []DependencyUpdate
+	releases := map[string]Release{}
+	updated := map[string]bool{}
+	for i, dependency := range buildpack.Metadata.Dependencies {
+		version, err := semver.NewVersion(dependency.Version)
+		if err != nil || !version.Equal(current[dependency.ID]) {
+			continue
+		}
+
+		release, ok := releases[dependency.ID]
+		if !ok {
+			release, ok, err = index.Latest(dependency.ID)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if !ok {
+				continue
+			}
+			releases[dependency.ID] = release
+		}
+
+		latest, err := semver.NewVersion(release.Version)
+		if err != nil || !latest.GreaterThan(version) {
+			continue
+		}
+
+		table := tables.table("metadata.dependencies", i)
+		for _, field := range []struct{ key, value string }{
+			{"version", release.Version},
+			{"uri", release.URI},
+			{"sha256", release.SHA256},
+			{"source", release.Source},
+			{"source_sha256", release.SourceSHA256},
+		} {
+			if field.value == "" {
+				edits.remove(table, field.key)
+				continue
+			}
+
+			if err := edits.set(table, field.key, field.value); err != nil {
+				return nil, nil, NewError(ParseError, err, "failed to update %s in %s", dependency.ID, path)
+			}
+		}
+
+		if updated[dependency.ID] {
+			continue
+		}
+		updated[dependency.ID] = true
+
+		groupIndex := 0
+		for _, order := range buildpack.Orders {
+			for _, group := range order.Groups {
+				table := tables.table("order.group", groupIndex)
+				groupIndex++
+
+				if group.ID != dependency.ID || group.Version != dependency.Version {
+					continue
+				}
+
+				if err := edits.set(table, "version", release.Version); err != nil {
+					return nil, nil, NewError(ParseError, err, "failed to update order group %s in %s", group.ID, path)
+				}
+			}
+		}
+
+		updates = append(updates, DependencyUpdate{ID: dependency.ID, From: dependency.Version, To: release.Version})
+	}
+
+	return []byte(edits.String()), updates, nil
+}
+
+// tomlEdits rewrites the values of keys in place, adds missing keys to the
+// end of their table and removes keys. Line numbers are those of the
+// original file.
+type tomlEdits struct {
+	lines   []string
+	inserts map[int][]string
+	removed map[int]bool
+}
+
+func (e tomlEdits) set(table tomlTableLines, key, value string) error {
+	if table.header == 0 {
+		return fmt.Errorf("could not find the table that sets %s", key)
+	}
+
+	quoted := strconv.Quote(value)
+
+	if number, ok := table.keys[key]; ok {
+		line := e.lines[number-1]
+		match := tomlStringValue.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+		if match == nil {
+			return fmt.Errorf("line %d does not set %s to a string", number, key)
+		}
+
+		e.lines[number-1] = match[1] + quoted + match[3] + line[len(strings.TrimRight(line, "\r\n")):]
+		return nil
+	}
+
+	// indent a new key like the last key of the table
+	last := table.header
+	for _, number := range table.keys {
+		if number > last {
+			last = number
+		}
+	}
+
+	indent := e.lines[last-1][:len(e.lines[last-1])-len(strings.TrimLeft(e.lines[last-1], " \t"))]
+	if last == table.header {
+		indent += "  "
+	}
+
+	e.inserts[last] = append(e.inserts[last], fmt.Sprintf("%s%s = %s\n", indent, key, quoted))
+	return nil
+}
+
+func (e tomlEdits) remove(table tomlTableLines, key string) {
+	if number, ok := table.keys[key]; ok {
+		e.removed[number] = true
+	}
+}
+
+func (e tomlEdits) String() string {
+	var numbers []int
+	for number := range e.inserts {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	var builder strings.Builder
+	next := 0
+	for _, number := range numbers {
+		for ; next < number; next++ {
+			e.write(&builder, next)
+		}
+
+		if !strings.HasSuffix(e.lines[number-1], "\n") {
+			builder.WriteString("\n")
+		}
+
+		for _, line := range e.inserts[number] {
+			builder.WriteString(line)
+		}
+	}
+
+	for ; next < len(e.lines); next++ {
+		e.write(&builder, next)
+	}
+
+	return builder.String()
+}
+
+func (e tomlEdits) write(builder *strings.Builder, index int) {
+	if !e.removed[index+1] {
+		builder.WriteString(e.lines[index])
+	}
+}
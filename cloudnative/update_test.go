@@ -0,0 +1,203 @@
+package cloudnative_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+type fakeReleaseIndex map[string]cloudnative.Release
+
+func (f fakeReleaseIndex) Latest(id string) (cloudnative.Release, bool, error) {
+	release, ok := f[id]
+	return release, ok, nil
+}
+
+func testUpdate(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		tmpDir string
+		path   string
+		index  fakeReleaseIndex
+	)
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "update")
+		Expect(err).NotTo(HaveOccurred())
+
+		path = filepath.Join(tmpDir, "buildpack.toml")
+		Expect(ioutil.WriteFile(path, []byte(`api = "0.2"
+
+[buildpack]
+  id = "org.cloudfoundry.nodejs"
+  name = "Node.js Buildpack"
+  version = "1.0.0"
+
+# pinned by the release pipeline
+[[metadata.dependencies]]
+  id = "org.cloudfoundry.node-engine"
+  version = "0.0.169"   # keep in step with the order
+  uri = 'https://example.com/node-engine-0.0.169.tgz'
+  sha256 = "old-sha"
+  stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]
+
+[[metadata.dependencies]]
+  id = "org.cloudfoundry.node-engine"
+  version = "0.0.100"
+  uri = "https://example.com/node-engine-0.0.100.tgz"
+  sha256 = "older-sha"
+  stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]
+
+[[metadata.dependencies]]
+  id = "org.cloudfoundry.npm"
+  version = "0.1.4"
+  uri = "https://example.com/npm-0.1.4.tgz"
+  sha256 = "npm-sha"
+  stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]
+
+[[order]]
+  [[order.group]]
+    id = "org.cloudfoundry.node-engine"
+    version = "0.0.169"
+
+  [[order.group]]
+    id = "org.cloudfoundry.npm"
+    version = "0.1.4"
+`), 0644)).To(Succeed())
+
+		index = fakeReleaseIndex{
+			"org.cloudfoundry.node-engine": {
+				Version:      "0.0.180",
+				URI:          "https://example.com/node-engine-0.0.180.tgz",
+				SHA256:       "new-sha",
+				Source:       "https://example.com/node-engine-source.tgz",
+				SourceSHA256: "new-source-sha",
+			},
+			"org.cloudfoundry.npm": {Version: "0.1.4", URI: "https://example.com/npm-0.1.4.tgz", SHA256: "npm-sha"},
+		}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	when("UpdateBuildpack", func() {
+		it("moves the newest entry of each dependency and its order groups to the latest release", func() {
+			contents, updates, err := cloudnative.UpdateBuildpack(path, index)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updates).To(Equal([]cloudnative.DependencyUpdate{
+				{ID: "org.cloudfoundry.node-engine", From: "0.0.169", To: "0.0.180"},
+			}))
+
+			Expect(string(contents)).To(ContainSubstring(`# pinned by the release pipeline
+[[metadata.dependencies]]
+  id = "org.cloudfoundry.node-engine"
+  version = "0.0.180"   # keep in step with the order
+  uri = "https://example.com/node-engine-0.0.180.tgz"
+  sha256 = "new-sha"
+  stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]
+  source = "https://example.com/node-engine-source.tgz"
+  source_sha256 = "new-source-sha"
+
+[[metadata.dependencies]]
+  id = "org.cloudfoundry.node-engine"
+  version = "0.0.100"
+`))
+			Expect(string(contents)).To(ContainSubstring(`    id = "org.cloudfoundry.node-engine"
+    version = "0.0.180"
+`))
+			Expect(string(contents)).To(ContainSubstring(`    id = "org.cloudfoundry.npm"
+    version = "0.1.4"
+`))
+
+			buildpack, err := cloudnative.ParseBuildpack(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buildpack.Metadata.Dependencies[0].Version).To(Equal("0.0.169"))
+		})
+
+		when("the latest release has no source", func() {
+			it("removes the source of the dependency", func() {
+				contents, err := ioutil.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(path, append(contents, []byte(`
+[[metadata.dependencies]]
+  id = "org.cloudfoundry.yarn"
+  version = "1.0.0"
+  uri = "https://example.com/yarn-1.0.0.tgz"
+  sha256 = "yarn-sha"
+  source = "https://example.com/yarn-source-1.0.0.tgz"
+  source_sha256 = "yarn-source-sha"
+  stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]
+`)...), 0644)).To(Succeed())
+				index["org.cloudfoundry.yarn"] = cloudnative.Release{Version: "1.1.0", URI: "https://example.com/yarn-1.1.0.tgz", SHA256: "new-yarn-sha"}
+
+				contents, _, err = cloudnative.UpdateBuildpack(path, index)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(HaveSuffix(`
+[[metadata.dependencies]]
+  id = "org.cloudfoundry.yarn"
+  version = "1.1.0"
+  uri = "https://example.com/yarn-1.1.0.tgz"
+  sha256 = "new-yarn-sha"
+  stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]
+`))
+			})
+		})
+
+		when("a value is not a string", func() {
+			it("returns a parse error", func() {
+				contents, err := ioutil.ReadFile(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(path, append(contents, []byte(`
+[[metadata.dependencies]]
+  id = "org.cloudfoundry.yarn"
+  version = "1.0.0"
+  uri = "https://example.com/yarn.tgz"
+  sha256 = """yarn-sha"""
+  stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]
+`)...), 0644)).To(Succeed())
+				index["org.cloudfoundry.yarn"] = cloudnative.Release{Version: "1.1.0", URI: "https://example.com/yarn-1.1.0.tgz", SHA256: "new-yarn-sha"}
+
+				_, _, err = cloudnative.UpdateBuildpack(path, index)
+				Expect(cloudnative.KindOf(err)).To(Equal(cloudnative.ParseError))
+			})
+		})
+	})
+
+	when("UnifiedDiff", func() {
+		it("returns the changed lines with context", func() {
+			from := []byte("a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n")
+			to := []byte("a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\n")
+
+			Expect(cloudnative.UnifiedDiff("a/buildpack.toml", "b/buildpack.toml", from, to)).To(Equal(`--- a/buildpack.toml
++++ b/buildpack.toml
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -11,3 +11,4 @@
+ k
+ l
+ m
++n
+`))
+		})
+
+		it("returns nothing for equal texts", func() {
+			Expect(cloudnative.UnifiedDiff("a", "b", []byte("a\n"), []byte("a\n"))).To(BeEmpty())
+		})
+	})
+}
@@ -0,0 +1,233 @@
+package cloudnative
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const cloudFoundryStackPrefix = "org.cloudfoundry.stacks."
+
+var sha256Pattern = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+type ValidationError struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	var messages []string
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("buildpack is invalid:\n%s", strings.Join(messages, "\n"))
+}
+
+// ValidateBuildpack checks that the buildpack.toml at path can be packaged
+// for the given stack. An empty stack accepts dependencies for any stack.
+// All problems are reported at once as ValidationErrors.
+func ValidateBuildpack(path, stack string) error {
+	buildpack, err := ParseBuildpack(path)
+	if err != nil {
+		return err
+	}
+
+	lines, err := indexTOMLLines(path)
+	if err != nil {
+		return err
+	}
+
+	var problems ValidationErrors
+	report := func(line int, format string, args ...interface{}) {
+		problems = append(problems, ValidationError{Path: path, Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	hasLifecycle := false
+	for i, dependency := range buildpack.Metadata.Dependencies {
+		table := lines.table("metadata.dependencies", i)
+		name := fmt.Sprintf("dependency %q", dependency.ID)
+		if dependency.Version != "" {
+			name = fmt.Sprintf("dependency %q version %q", dependency.ID, dependency.Version)
+		}
+
+		if dependency.ID == "" {
+			report(table.line(""), "dependency is missing an id")
+		}
+
+		if dependency.Version == "" {
+			report(table.line(""), "%s is missing a version", name)
+		}
+
+		if dependency.ID == Lifecycle && (stack == "" || dependency.MatchesStack(stack)) {
+			hasLifecycle = true
+		}
+
+		for _, field := range []struct{ key, value string }{
+			{"sha256", dependency.SHA256},
+			{"source_sha256", dependency.SourceSHA256},
+		} {
+			if field.value != "" && !sha256Pattern.MatchString(field.value) {
+				report(table.line(field.key), "%s has a malformed %s %q", name, field.key, field.value)
+			}
+		}
+
+		if IsGitSource(dependency.Source) {
+			if _, _, err := ParseGitSource(dependency.Source); err != nil {
+				report(table.line("source"), "%s has a git source that does not name a commit or ref", name)
+			}
+
+			if dependency.SourceSHA256 != "" {
+				report(table.line("source_sha256"), "%s has a source_sha256, but git sources are verified by their commit", name)
+			}
+		}
+
+		if len(dependency.Stacks) == 0 {
+			report(table.line("stacks"), "%s does not declare any stacks", name)
+		}
+
+		for _, s := range dependency.Stacks {
+			if !strings.HasPrefix(s, cloudFoundryStackPrefix) || s == cloudFoundryStackPrefix {
+				report(table.line("stacks"), "%s has stack %q which is not of the form %s<name>", name, s, cloudFoundryStackPrefix)
+			}
+		}
+
+		for j, other := range buildpack.Metadata.Dependencies[:i] {
+			if other.ID == dependency.ID && other.Version == dependency.Version && sharesStack(other, dependency) {
+				report(table.line(""), "%s is a duplicate of the dependency at line %d", name, lines.table("metadata.dependencies", j).line(""))
+			}
+		}
+	}
+
+	if !hasLifecycle {
+		if stack != "" {
+			report(0, "no %q dependency found for stack %q", Lifecycle, stack)
+		} else {
+			report(0, "no %q dependency found", Lifecycle)
+		}
+	}
+
+	groupIndex := 0
+	for _, order := range buildpack.Orders {
+		for _, group := range order.Groups {
+			table := lines.table("order.group", groupIndex)
+			groupIndex++
+
+			if !hasDependency(buildpack.Metadata.Dependencies, group, stack) {
+				if stack != "" {
+					report(table.line(""), "order group entry %q version %q has no matching dependency for stack %q", group.ID, group.Version, stack)
+				} else {
+					report(table.line(""), "order group entry %q version %q has no matching dependency", group.ID, group.Version)
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+
+	return nil
+}
+
+func hasDependency(dependencies []BuildpackMetadataDependency, group BuildpackOrderGroup, stack string) bool {
+	for _, dependency := range dependencies {
+		if dependency.ID != group.ID || dependency.Version != group.Version {
+			continue
+		}
+
+		if stack == "" || dependency.MatchesStack(stack) {
+			return true
+		}
+	}
+	return false
+}
+
+func sharesStack(a, b BuildpackMetadataDependency) bool {
+	for _, stack := range a.Stacks {
+		for _, other := range b.Stacks {
+			if stack == other {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var (
+	tomlArrayTableHeader = regexp.MustCompile(`^\s*\[\[\s*([A-Za-z0-9_.-]+)\s*\]\]`)
+	tomlTableHeader      = regexp.MustCompile(`^\s*\[\s*([A-Za-z0-9_.-]+)\s*\]`)
+	tomlKey              = regexp.MustCompile(`^\s*([A-Za-z0-9_-]+)\s*=`)
+)
+
+type tomlTableLines struct {
+	header int
+	keys   map[string]int
+}
+
+// line returns the line on which key is set, falling back to the table
+// header when the key is absent or empty.
+func (t tomlTableLines) line(key string) int {
+	if line, ok := t.keys[key]; ok {
+		return line
+	}
+	return t.header
+}
+
+type tomlLines map[string][]tomlTableLines
+
+func (l tomlLines) table(name string, index int) tomlTableLines {
+	tables := l[name]
+	if index < len(tables) {
+		return tables[index]
+	}
+	return tomlTableLines{}
+}
+
+// indexTOMLLines records the line of each array-of-tables header, and of
+// the keys set within it, so that decoded entries can be traced back to
+// the file. BurntSushi/toml does not expose positions itself.
+func indexTOMLLines(path string) (tomlLines, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	lines := tomlLines{}
+	var current *tomlTableLines
+
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		text := scanner.Text()
+
+		if match := tomlArrayTableHeader.FindStringSubmatch(text); match != nil {
+			lines[match[1]] = append(lines[match[1]], tomlTableLines{header: number, keys: map[string]int{}})
+			tables := lines[match[1]]
+			current = &tables[len(tables)-1]
+			continue
+		}
+
+		if tomlTableHeader.MatchString(text) {
+			current = nil
+			continue
+		}
+
+		if match := tomlKey.FindStringSubmatch(text); match != nil && current != nil {
+			current.keys[match[1]] = number
+		}
+	}
+
+	return lines, scanner.Err()
+}
@@ -0,0 +1,197 @@
+package cloudnative_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testValidation(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		tmpDir string
+		path   string
+	)
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "validation")
+		Expect(err).NotTo(HaveOccurred())
+
+		path = filepath.Join(tmpDir, "buildpack.toml")
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	when("ValidateBuildpack", func() {
+		when("the buildpack.toml is valid", func() {
+			it.Before(func() {
+				Expect(ioutil.WriteFile(path, []byte(`
+[buildpack]
+id = "org.cloudfoundry.some-language"
+
+[[metadata.dependencies]]
+id = "lifecycle"
+version = "0.7.2"
+sha256 = "5abc450423b9a13cf3e8f83623d30cd61081af293e85044a8d6d88e29548cc66"
+stacks = ["org.cloudfoundry.stacks.cflinuxfs3", "org.cloudfoundry.stacks.cflinuxfs4"]
+
+[[metadata.dependencies]]
+id = "some-dependency"
+version = "1.0.0"
+source_sha256 = "7dac96c4ad5401568eb880d75c5008731d24217af623a46136e0d36a29fe0078"
+stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]
+
+[[order]]
+[[order.group]]
+id = "some-dependency"
+version = "1.0.0"
+`), 0644)).To(Succeed())
+			})
+
+			it("returns no error", func() {
+				Expect(cloudnative.ValidateBuildpack(path, "cflinuxfs3")).To(Succeed())
+			})
+		})
+
+		when("a dependency has stacks from another namespace", func() {
+			it.Before(func() {
+				Expect(ioutil.WriteFile(path, []byte(`[buildpack]
+id = "org.cloudfoundry.some-language"
+
+[[metadata.dependencies]]
+id = "lifecycle"
+version = "0.7.2"
+sha256 = "5abc450423b9a13cf3e8f83623d30cd61081af293e85044a8d6d88e29548cc66"
+stacks = ["io.buildpacks.stacks.bionic", "io.buildpacks.stacks.cflinuxfs4"]
+`), 0644)).To(Succeed())
+			})
+
+			it("requires the org.cloudfoundry.stacks. prefix for every stack", func() {
+				for _, stack := range []string{"", "bionic", "cflinuxfs4"} {
+					err := cloudnative.ValidateBuildpack(path, stack)
+					Expect(err).To(BeAssignableToTypeOf(cloudnative.ValidationErrors{}), stack)
+					Expect(err.(cloudnative.ValidationErrors)).To(HaveLen(2), stack)
+					Expect(err).To(MatchError(ContainSubstring(`has stack "io.buildpacks.stacks.bionic" which is not of the form org.cloudfoundry.stacks.<name>`)), stack)
+					Expect(err).To(MatchError(ContainSubstring(`has stack "io.buildpacks.stacks.cflinuxfs4" which is not of the form org.cloudfoundry.stacks.<name>`)), stack)
+				}
+			})
+		})
+
+		when("the buildpack.toml has several problems", func() {
+			it.Before(func() {
+				Expect(ioutil.WriteFile(path, []byte(`[buildpack]
+id = "org.cloudfoundry.some-language"
+
+[[metadata.dependencies]]
+id = "some-dependency"
+version = "1.0.0"
+sha256 = "not-a-sha"
+stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]
+
+[[metadata.dependencies]]
+id = "some-dependency"
+version = "1.0.0"
+stacks = ["io.buildpacks.stacks.cflinuxfs3", "bionic"]
+
+[[order]]
+[[order.group]]
+id = "some-dependency"
+version = "1.0.0"
+
+[[order.group]]
+id = "other-dependency"
+version = "2.0.0"
+`), 0644)).To(Succeed())
+			})
+
+			it("reports every problem with its line", func() {
+				err := cloudnative.ValidateBuildpack(path, "cflinuxfs3")
+				Expect(err).To(BeAssignableToTypeOf(cloudnative.ValidationErrors{}))
+
+				var messages []string
+				for _, problem := range err.(cloudnative.ValidationErrors) {
+					messages = append(messages, problem.Error())
+				}
+
+				Expect(messages).To(ConsistOf(
+					path+`:7: dependency "some-dependency" version "1.0.0" has a malformed sha256 "not-a-sha"`,
+					path+`:13: dependency "some-dependency" version "1.0.0" has stack "io.buildpacks.stacks.cflinuxfs3" which is not of the form org.cloudfoundry.stacks.<name>`,
+					path+`:13: dependency "some-dependency" version "1.0.0" has stack "bionic" which is not of the form org.cloudfoundry.stacks.<name>`,
+					path+`: no "lifecycle" dependency found for stack "cflinuxfs3"`,
+					path+`:20: order group entry "other-dependency" version "2.0.0" has no matching dependency for stack "cflinuxfs3"`,
+				))
+			})
+		})
+
+		when("the buildpack.toml has duplicate dependencies", func() {
+			it.Before(func() {
+				Expect(ioutil.WriteFile(path, []byte(`[[metadata.dependencies]]
+id = "lifecycle"
+version = "0.7.2"
+stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]
+
+[[metadata.dependencies]]
+id = "lifecycle"
+version = "0.7.2"
+stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]
+`), 0644)).To(Succeed())
+			})
+
+			it("reports the duplicate", func() {
+				err := cloudnative.ValidateBuildpack(path, "")
+				Expect(err).To(MatchError(ContainSubstring(path + `:6: dependency "lifecycle" version "0.7.2" is a duplicate of the dependency at line 1`)))
+			})
+		})
+
+		when("the buildpack.toml has git sources", func() {
+			it.Before(func() {
+				Expect(ioutil.WriteFile(path, []byte(`[[metadata.dependencies]]
+id = "lifecycle"
+version = "0.7.2"
+stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]
+
+[[metadata.dependencies]]
+id = "some-dependency"
+version = "1.0.0"
+source = "git+https://github.com/some-org/some-dependency"
+stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]
+
+[[metadata.dependencies]]
+id = "other-dependency"
+version = "2.0.0"
+source = "git+https://github.com/some-org/other-dependency#main"
+source_sha256 = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]
+`), 0644)).To(Succeed())
+			})
+
+			it("reports sources without a ref and checksums that would be ignored", func() {
+				err := cloudnative.ValidateBuildpack(path, "")
+				Expect(err).To(MatchError(ContainSubstring(path + `:9: dependency "some-dependency" version "1.0.0" has a git source that does not name a commit or ref`)))
+				Expect(err).To(MatchError(ContainSubstring(path + `:16: dependency "other-dependency" version "2.0.0" has a source_sha256, but git sources are verified by their commit`)))
+			})
+		})
+
+		when("the file cannot be parsed", func() {
+			it.Before(func() {
+				Expect(ioutil.WriteFile(path, []byte("%%%"), 0644)).To(Succeed())
+			})
+
+			it("returns the parse error", func() {
+				Expect(cloudnative.ValidateBuildpack(path, "")).To(MatchError(ContainSubstring("failed to parse")))
+			})
+		})
+	})
+}
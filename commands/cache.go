@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/cloudfoundry/cnb2cf/packager"
+	"github.com/google/subcommands"
+)
+
+const CacheUsage = `cache [-cachedir <path to cachedir>] list
+cache [-cachedir <path to cachedir>] [-older-than <duration>] prune:
+  lists or removes the downloaded CNB sources and release tarballs kept in the download cache.
+
+`
+
+type Cache struct {
+	cacheDir  string
+	olderThan time.Duration
+}
+
+func (*Cache) Name() string {
+	return "cache"
+}
+
+func (*Cache) Synopsis() string {
+	return "List or prune the download cache"
+}
+
+func (*Cache) Usage() string {
+	return CacheUsage
+}
+
+func (c *Cache) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.cacheDir, "cachedir", packager.DefaultCacheDir, "cache dir")
+	f.DurationVar(&c.olderThan, "older-than", 0, "only prune entries that have not been used for this long")
+}
+
+func (c *Cache) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		fmt.Print(CacheUsage)
+		return subcommands.ExitUsageError
+	}
+
+	cache := cloudnative.NewDownloadCache(c.cacheDir)
+
+	var (
+		entries []cloudnative.DownloadCacheEntry
+		err     error
+	)
+	switch f.Arg(0) {
+	case "list":
+		entries, err = cache.List()
+	case "prune":
+		entries, err = cache.Prune(time.Now().Add(-c.olderThan))
+	default:
+		fmt.Print(CacheUsage)
+		return subcommands.ExitUsageError
+	}
+	if err != nil {
+		log.Printf("failed to %s cache: %s\n", f.Arg(0), err)
+		return subcommands.ExitFailure
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SHA256\tSIZE\tLAST USED")
+	for _, entry := range entries {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", entry.SHA256, entry.Size, entry.LastUsed.Format(time.RFC3339))
+	}
+	if err := tw.Flush(); err != nil {
+		log.Println(err)
+		return subcommands.ExitFailure
+	}
+
+	if f.Arg(0) == "prune" {
+		log.Printf("Removed %d entries from %s", len(entries), c.cacheDir)
+	}
+
+	return subcommands.ExitSuccess
+}
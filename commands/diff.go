@@ -0,0 +1,184 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/google/subcommands"
+)
+
+const DiffUsage = `diff <old zip or buildpack.toml> <new zip or buildpack.toml>:
+  describes, as markdown, the dependencies, stacks, lifecycle and order groups that changed between two shimmed buildpacks.
+
+`
+
+// WriteBuildpackDiff writes the diff as markdown suitable for release notes.
+func WriteBuildpackDiff(w io.Writer, diff cloudnative.BuildpackDiff) error {
+	title := diff.ID
+	if diff.FromVersion != diff.ToVersion {
+		title += fmt.Sprintf(" %s → %s", diff.FromVersion, diff.ToVersion)
+	} else if diff.ToVersion != "" {
+		title += " " + diff.ToVersion
+	}
+	fmt.Fprintf(w, "## %s\n\n", title)
+
+	return writeDiffSections(w, diff)
+}
+
+// writeDiffSections writes each kind of change under its own third level
+// heading.
+func writeDiffSections(w io.Writer, diff cloudnative.BuildpackDiff) error {
+	if diff.Empty() {
+		_, err := fmt.Fprintln(w, "No changes.")
+		return err
+	}
+
+	if diff.FromLifecycle != diff.ToLifecycle {
+		fmt.Fprintf(w, "**Lifecycle:** %s → %s\n\n", markdownVersion(diff.FromLifecycle), markdownVersion(diff.ToLifecycle))
+	}
+
+	if len(diff.AddedStacks) > 0 || len(diff.RemovedStacks) > 0 {
+		fmt.Fprintln(w, "### Stacks")
+		fmt.Fprintln(w)
+		for _, stack := range diff.AddedStacks {
+			fmt.Fprintf(w, "- Added `%s`\n", stack)
+		}
+		for _, stack := range diff.RemovedStacks {
+			fmt.Fprintf(w, "- Removed `%s`\n", stack)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(diff.Added) > 0 || len(diff.Removed) > 0 || len(diff.Changed) > 0 {
+		fmt.Fprintln(w, "### Dependencies")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Dependency | Change | From | To |")
+		fmt.Fprintln(w, "|---|---|---|---|")
+		for _, change := range diff.Changed {
+			fmt.Fprintf(w, "| `%s` | %s | %s | %s |\n", change.ID, dependencyChangeKind(change), markdownVersions(change.From), markdownVersions(change.To))
+		}
+		for _, dependency := range diff.Added {
+			fmt.Fprintf(w, "| `%s` | added | | %s |\n", dependency.ID, markdownVersions(dependency.Versions))
+		}
+		for _, dependency := range diff.Removed {
+			fmt.Fprintf(w, "| `%s` | removed | %s | |\n", dependency.ID, markdownVersions(dependency.Versions))
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(diff.Orders) > 0 {
+		fmt.Fprintln(w, "### Order groups")
+		fmt.Fprintln(w)
+		for _, order := range diff.Orders {
+			fmt.Fprintf(w, "- Order %d: %s → %s\n", order.Index+1, markdownGroups(order.From), markdownGroups(order.To))
+		}
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
+
+// dependencyChangeKind describes a change by comparing the newest versions
+// on each side, followed by the stacks that were added or removed.
+func dependencyChangeKind(change cloudnative.DependencyChange) string {
+	var kinds []string
+
+	from, to := change.From[len(change.From)-1], change.To[len(change.To)-1]
+	switch {
+	case strings.Join(change.From, ",") == strings.Join(change.To, ","):
+	case from == to:
+		kinds = append(kinds, "changed")
+	case strings.Join(cloudnative.SortVersions([]string{from, to}), ",") == from+","+to:
+		kinds = append(kinds, "upgraded")
+	default:
+		kinds = append(kinds, "downgraded")
+	}
+
+	for _, stack := range change.AddedStacks {
+		kinds = append(kinds, fmt.Sprintf("added to `%s`", stack))
+	}
+	for _, stack := range change.RemovedStacks {
+		kinds = append(kinds, fmt.Sprintf("removed from `%s`", stack))
+	}
+
+	if len(kinds) == 0 {
+		return "changed"
+	}
+	return strings.Join(kinds, ", ")
+}
+
+func markdownVersion(version string) string {
+	if version == "" {
+		return "none"
+	}
+	return "`" + version + "`"
+}
+
+func markdownVersions(versions []string) string {
+	var quoted []string
+	for _, version := range versions {
+		quoted = append(quoted, markdownVersion(version))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func markdownGroups(groups []string) string {
+	if len(groups) == 0 {
+		return "none"
+	}
+	return markdownList(groups)
+}
+
+func markdownList(values []string) string {
+	var quoted []string
+	for _, value := range values {
+		quoted = append(quoted, "`"+value+"`")
+	}
+	return strings.Join(quoted, ", ")
+}
+
+type Diff struct{}
+
+func (*Diff) Name() string {
+	return "diff"
+}
+
+func (*Diff) Synopsis() string {
+	return "Describe what changed between two shimmed buildpacks as markdown"
+}
+
+func (*Diff) Usage() string {
+	return DiffUsage
+}
+
+func (*Diff) SetFlags(_ *flag.FlagSet) {}
+
+func (*Diff) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 2 {
+		fmt.Print(DiffUsage)
+		return subcommands.ExitUsageError
+	}
+
+	var buildpacks []cloudnative.ShimmedBuildpack
+	for _, path := range f.Args() {
+		buildpack, err := cloudnative.LoadShimmedBuildpack(path)
+		if err != nil {
+			log.Printf("failed to read %s: %s\n", path, err)
+			return ExitStatus(err)
+		}
+		buildpacks = append(buildpacks, buildpack)
+	}
+
+	if err := WriteBuildpackDiff(os.Stdout, cloudnative.DiffBuildpacks(buildpacks[0], buildpacks[1])); err != nil {
+		log.Printf("failed to write diff: %s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,72 @@
+package commands_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/cloudfoundry/cnb2cf/commands"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestUnitDiffCommand(t *testing.T) {
+	spec.Run(t, "Diff", testDiffCommand, spec.Report(report.Terminal{}))
+}
+
+func testDiffCommand(t *testing.T, when spec.G, it spec.S) {
+	var Expect func(interface{}, ...interface{}) Assertion
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+	})
+
+	when("WriteBuildpackDiff", func() {
+		it("writes the changes as markdown", func() {
+			buffer := bytes.NewBuffer(nil)
+			Expect(commands.WriteBuildpackDiff(buffer, cloudnative.BuildpackDiff{
+				ID:            "org.cloudfoundry.nodejs",
+				FromVersion:   "1.0.0",
+				ToVersion:     "1.1.0",
+				FromLifecycle: "0.7.2",
+				ToLifecycle:   "0.7.5",
+				AddedStacks:   []string{"bionic"},
+				Added:         []cloudnative.DependencyVersions{{ID: "org.cloudfoundry.npm", Versions: []string{"0.1.4"}}},
+				Removed:       []cloudnative.DependencyVersions{{ID: "org.cloudfoundry.yarn", Versions: []string{"0.1.0"}}},
+				Changed: []cloudnative.DependencyChange{
+					{ID: "org.cloudfoundry.node-engine", From: []string{"0.0.99"}, To: []string{"0.0.100"}},
+					{ID: "org.cloudfoundry.dotnet", From: []string{"2.0.0"}, To: []string{"1.0.0", "1.5.0"}},
+					{ID: "org.cloudfoundry.go", From: []string{"1.0.0"}, To: []string{"1.0.0"}, AddedStacks: []string{"bionic"}},
+					{ID: "org.cloudfoundry.php", From: []string{"1.0.0"}, To: []string{"1.1.0"}, RemovedStacks: []string{"cflinuxfs2"}},
+				},
+				Orders: []cloudnative.OrderChange{
+					{Index: 1, To: []string{"org.cloudfoundry.npm@0.1.4 (optional)"}},
+				},
+			})).To(Succeed())
+
+			Expect(buffer.String()).To(Equal("## org.cloudfoundry.nodejs 1.0.0 → 1.1.0\n\n" +
+				"**Lifecycle:** `0.7.2` → `0.7.5`\n\n" +
+				"### Stacks\n\n" +
+				"- Added `bionic`\n\n" +
+				"### Dependencies\n\n" +
+				"| Dependency | Change | From | To |\n" +
+				"|---|---|---|---|\n" +
+				"| `org.cloudfoundry.node-engine` | upgraded | `0.0.99` | `0.0.100` |\n" +
+				"| `org.cloudfoundry.dotnet` | downgraded | `2.0.0` | `1.0.0`, `1.5.0` |\n" +
+				"| `org.cloudfoundry.go` | added to `bionic` | `1.0.0` | `1.0.0` |\n" +
+				"| `org.cloudfoundry.php` | upgraded, removed from `cflinuxfs2` | `1.0.0` | `1.1.0` |\n" +
+				"| `org.cloudfoundry.npm` | added | | `0.1.4` |\n" +
+				"| `org.cloudfoundry.yarn` | removed | `0.1.0` | |\n\n" +
+				"### Order groups\n\n" +
+				"- Order 2: none → `org.cloudfoundry.npm@0.1.4 (optional)`\n\n"))
+		})
+
+		it("says when nothing changed", func() {
+			buffer := bytes.NewBuffer(nil)
+			Expect(commands.WriteBuildpackDiff(buffer, cloudnative.BuildpackDiff{ID: "org.cloudfoundry.nodejs", FromVersion: "1.0.0", ToVersion: "1.0.0"})).To(Succeed())
+			Expect(buffer.String()).To(Equal("## org.cloudfoundry.nodejs 1.0.0\n\nNo changes.\n"))
+		})
+	})
+}
@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/google/subcommands"
+)
+
+// Exit statuses returned by commands for each kind of failure, in addition
+// to subcommands.ExitFailure and subcommands.ExitUsageError.
+const (
+	ExitParseError subcommands.ExitStatus = iota + 3
+	ExitDownloadError
+	ExitBuildError
+	ExitArchiveError
+)
+
+func ExitStatus(err error) subcommands.ExitStatus {
+	switch cloudnative.KindOf(err) {
+	case cloudnative.ParseError:
+		return ExitParseError
+	case cloudnative.DownloadError:
+		return ExitDownloadError
+	case cloudnative.BuildError:
+		return ExitBuildError
+	case cloudnative.ArchiveError:
+		return ExitArchiveError
+	default:
+		return subcommands.ExitFailure
+	}
+}
+
+// Summarize describes err prefixed with its kind. The first line is a one
+// line summary; errors such as validation problems keep their detail on the
+// lines that follow.
+func Summarize(err error) string {
+	return fmt.Sprintf("%s: %s", cloudnative.KindOf(err), err)
+}
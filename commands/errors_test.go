@@ -0,0 +1,45 @@
+package commands_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/cloudfoundry/cnb2cf/commands"
+	"github.com/google/subcommands"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestUnitErrors(t *testing.T) {
+	spec.Run(t, "Errors", testErrors, spec.Report(report.Terminal{}))
+}
+
+func testErrors(t *testing.T, when spec.G, it spec.S) {
+	var Expect func(interface{}, ...interface{}) Assertion
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+	})
+
+	when("ExitStatus", func() {
+		it("maps each kind of failure to its own exit status", func() {
+			cause := errors.New("some-error")
+
+			Expect(commands.ExitStatus(cloudnative.NewError(cloudnative.ParseError, cause, "parse"))).To(Equal(commands.ExitParseError))
+			Expect(commands.ExitStatus(cloudnative.NewError(cloudnative.DownloadError, cause, "download"))).To(Equal(commands.ExitDownloadError))
+			Expect(commands.ExitStatus(cloudnative.NewError(cloudnative.BuildError, cause, "build"))).To(Equal(commands.ExitBuildError))
+			Expect(commands.ExitStatus(cloudnative.NewError(cloudnative.ArchiveError, cause, "archive"))).To(Equal(commands.ExitArchiveError))
+			Expect(commands.ExitStatus(cause)).To(Equal(subcommands.ExitFailure))
+		})
+	})
+
+	when("Summarize", func() {
+		it("prefixes the error with its kind", func() {
+			err := cloudnative.NewError(cloudnative.DownloadError, errors.New("404"), "failed to download cnb source for some-id")
+			Expect(commands.Summarize(err)).To(Equal("download error: failed to download cnb source for some-id: 404"))
+		})
+	})
+}
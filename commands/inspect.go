@@ -0,0 +1,154 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/google/subcommands"
+)
+
+const InspectUsage = `inspect [-json] <path to shimmed buildpack zip>:
+  describes the order groups, lifecycle and dependencies packaged inside a shimmed buildpack zip.
+
+`
+
+type InspectReport struct {
+	ID           string                       `json:"id"`
+	Name         string                       `json:"name"`
+	Version      string                       `json:"version"`
+	Language     string                       `json:"language"`
+	Stack        string                       `json:"stack,omitempty"`
+	Lifecycle    string                       `json:"lifecycle"`
+	Orders       []cloudnative.BuildpackOrder `json:"order"`
+	Dependencies []InspectReportDependency    `json:"dependencies"`
+}
+
+type InspectReportDependency struct {
+	ID      string   `json:"id"`
+	Version string   `json:"version"`
+	URI     string   `json:"uri"`
+	SHA256  string   `json:"sha256"`
+	Stacks  []string `json:"stacks"`
+	Cached  bool     `json:"cached"`
+}
+
+func NewInspectReport(shimmed cloudnative.ShimmedBuildpack) InspectReport {
+	report := InspectReport{
+		ID:        shimmed.Buildpack.Info.ID,
+		Name:      shimmed.Buildpack.Info.Name,
+		Version:   shimmed.Version,
+		Language:  shimmed.Manifest.Language,
+		Stack:     shimmed.Manifest.Stack,
+		Lifecycle: shimmed.LifecycleVersion(),
+		Orders:    shimmed.Buildpack.Orders,
+	}
+
+	for _, dependency := range shimmed.Manifest.Dependencies {
+		stacks := dependency.Stacks
+		if len(stacks) == 0 && shimmed.Manifest.Stack != "" {
+			// the packager strips cf_stacks when a zip is built for a single stack
+			stacks = []string{shimmed.Manifest.Stack}
+		}
+
+		report.Dependencies = append(report.Dependencies, InspectReportDependency{
+			ID:      dependency.ID,
+			Version: dependency.Version,
+			URI:     dependency.URI,
+			SHA256:  dependency.SHA256,
+			Stacks:  stacks,
+			Cached:  dependency.File != "" && shimmed.HasFile(dependency.File),
+		})
+	}
+
+	return report
+}
+
+func WriteInspectReport(w io.Writer, report InspectReport, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Buildpack:\t%s (%s)\n", report.ID, report.Name)
+	fmt.Fprintf(tw, "Version:\t%s\n", report.Version)
+	fmt.Fprintf(tw, "Language:\t%s\n", report.Language)
+	if report.Stack != "" {
+		fmt.Fprintf(tw, "Stack:\t%s\n", report.Stack)
+	}
+	fmt.Fprintf(tw, "Lifecycle:\t%s\n", report.Lifecycle)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "\nOrder groups:")
+	for i, order := range report.Orders {
+		var groups []string
+		for _, group := range order.Groups {
+			entry := fmt.Sprintf("%s@%s", group.ID, group.Version)
+			if group.Optional {
+				entry += " (optional)"
+			}
+			groups = append(groups, entry)
+		}
+		fmt.Fprintf(w, "  %d. %s\n", i+1, strings.Join(groups, ", "))
+	}
+
+	fmt.Fprintln(w, "\nDependencies:")
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  ID\tVERSION\tSTACKS\tCACHED\tSHA256")
+	for _, dependency := range report.Dependencies {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%t\t%s\n", dependency.ID, dependency.Version, strings.Join(dependency.Stacks, ","), dependency.Cached, dependency.SHA256)
+	}
+
+	return tw.Flush()
+}
+
+type Inspect struct {
+	json bool
+}
+
+func (*Inspect) Name() string {
+	return "inspect"
+}
+
+func (*Inspect) Synopsis() string {
+	return "Describe the contents of a packaged shimmed buildpack zipfile"
+}
+
+func (*Inspect) Usage() string {
+	return InspectUsage
+}
+
+func (i *Inspect) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&i.json, "json", false, "print the description as JSON")
+}
+
+func (i *Inspect) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		fmt.Print(InspectUsage)
+		return subcommands.ExitUsageError
+	}
+
+	shimmed, err := cloudnative.ReadShimmedBuildpack(f.Arg(0))
+	if err != nil {
+		log.Printf("failed to inspect buildpack: %s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	if err := WriteInspectReport(os.Stdout, NewInspectReport(shimmed), i.json); err != nil {
+		log.Printf("failed to write inspect report: %s\n", err)
+		return subcommands.ExitFailure
+	}
+
+	return subcommands.ExitSuccess
+}
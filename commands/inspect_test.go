@@ -0,0 +1,87 @@
+package commands_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/cloudfoundry/cnb2cf/commands"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestUnitInspectCommand(t *testing.T) {
+	spec.Run(t, "Inspect", testInspectCommand, spec.Report(report.Terminal{}))
+}
+
+func testInspectCommand(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		shimmed cloudnative.ShimmedBuildpack
+	)
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		shimmed = cloudnative.ShimmedBuildpack{
+			Version: "1.2.3",
+			Buildpack: cloudnative.Buildpack{
+				Info: cloudnative.BuildpackInfo{ID: "org.cloudfoundry.nodejs", Name: "Node.js Buildpack"},
+				Orders: []cloudnative.BuildpackOrder{
+					{Groups: []cloudnative.BuildpackOrderGroup{
+						{ID: "org.cloudfoundry.node-engine", Version: "0.0.169"},
+						{ID: "org.cloudfoundry.npm", Version: "0.1.4", Optional: true},
+					}},
+				},
+			},
+			Manifest: cloudnative.Manifest{
+				Language: "nodejs",
+				Stack:    "cflinuxfs3",
+				Dependencies: []cloudnative.ManifestDependency{
+					{ID: "lifecycle", Version: "0.7.2", SHA256: "lifecycle-sha", File: "dependencies/a/lifecycle.tgz"},
+					{ID: "org.cloudfoundry.node-engine", Version: "0.0.169", SHA256: "node-sha", Stacks: []string{"cflinuxfs3", "bionic"}},
+				},
+			},
+			Files: []string{"manifest.yml", "dependencies/a/lifecycle.tgz"},
+		}
+	})
+
+	when("NewInspectReport", func() {
+		it("describes the lifecycle, orders and dependencies", func() {
+			report := commands.NewInspectReport(shimmed)
+
+			Expect(report.ID).To(Equal("org.cloudfoundry.nodejs"))
+			Expect(report.Version).To(Equal("1.2.3"))
+			Expect(report.Lifecycle).To(Equal("0.7.2"))
+			Expect(report.Orders).To(Equal(shimmed.Buildpack.Orders))
+			Expect(report.Dependencies).To(Equal([]commands.InspectReportDependency{
+				{ID: "lifecycle", Version: "0.7.2", SHA256: "lifecycle-sha", Stacks: []string{"cflinuxfs3"}, Cached: true},
+				{ID: "org.cloudfoundry.node-engine", Version: "0.0.169", SHA256: "node-sha", Stacks: []string{"cflinuxfs3", "bionic"}, Cached: false},
+			}))
+		})
+	})
+
+	when("WriteInspectReport", func() {
+		it("writes a human readable description", func() {
+			buffer := bytes.NewBuffer(nil)
+			Expect(commands.WriteInspectReport(buffer, commands.NewInspectReport(shimmed), false)).To(Succeed())
+
+			Expect(buffer.String()).To(ContainSubstring("Lifecycle:  0.7.2"))
+			Expect(buffer.String()).To(ContainSubstring("1. org.cloudfoundry.node-engine@0.0.169, org.cloudfoundry.npm@0.1.4 (optional)"))
+			Expect(buffer.String()).To(MatchRegexp(`lifecycle\s+0\.7\.2\s+cflinuxfs3\s+true\s+lifecycle-sha`))
+		})
+
+		it("writes a JSON description", func() {
+			buffer := bytes.NewBuffer(nil)
+			Expect(commands.WriteInspectReport(buffer, commands.NewInspectReport(shimmed), true)).To(Succeed())
+
+			var decoded commands.InspectReport
+			Expect(json.Unmarshal(buffer.Bytes(), &decoded)).To(Succeed())
+			Expect(decoded).To(Equal(commands.NewInspectReport(shimmed)))
+		})
+	})
+}
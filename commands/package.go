@@ -2,6 +2,7 @@ package commands
 
 import (
 	"context"
+	"crypto/ed25519"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -9,43 +10,53 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/cloudfoundry/cnb2cf/cloudnative"
 	"github.com/cloudfoundry/cnb2cf/cloudnative/untested"
 	"github.com/cloudfoundry/cnb2cf/packager"
+	"github.com/cloudfoundry/cnb2cf/signature"
 	"github.com/cloudfoundry/libbuildpack"
 	cfPackager "github.com/cloudfoundry/libbuildpack/packager"
 	"github.com/google/subcommands"
 	"github.com/rakyll/statik/fs"
 )
 
-const PackageUsage = `package -stack <stack> [-cached] [-version <version>] [-cachedir <path to cachedir>] [-manifestpath <optional path to manifest>]:
-  when run in a directory that is structured as a shimmed buildpack, creates a zip file.
+const PackageUsage = `package (-stack <stack>[,<stack>...] | -all-stacks) [-cached] [-version <version>] [-cachedir <path to cachedir>] [-manifestpath <optional path to manifest>] [-output <output dir>] [-jobs <n>] [-download-timeout <duration>] [-download-retries <n>] [-netrc <path>] [-credentials <path>] [-lockfile <path>] [-locked] [-reproducible] [-sbom cyclonedx|spdx] [-release-notes <path> [-previous <zip or lockfile>]] [-sign-key <path>] [<source dir>]:
+  when run in (or given) a directory that is structured as a shimmed buildpack, creates a zip file.
 
 `
 
-func Fetch(bp cloudnative.Buildpack, installer untested.Installer) error {
-	// TODO: fixme
-	// package child dependencies of the top-level CNB
-	for _, dependency := range bp.Metadata.Dependencies {
-		downloadPath := filepath.Join(os.TempDir(), "downloads")
-		err := installer.Download(dependency.URI, dependency.SHA256, downloadPath)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 type Package struct {
 	cached            bool
 	version           string
 	cacheDir          string
 	stack             string
+	allStacks         bool
 	buildpackTOMLPath string
+	outputDir         string
+	sourceDir         string
+	jobs              int
+	downloadTimeout   time.Duration
+	downloadRetries   int
+	netrcPath         string
+	credentialsPath   string
+	lockfilePath      string
+	locked            bool
+	reproducible      bool
+	sourceDate        time.Time
+	sbomFormat        string
+	releaseNotesPath  string
+	previousPath      string
+	signKeyPath       string
+	signingKey        ed25519.PrivateKey
 	dev               bool
 	release           bool
+
+	// Installer downloads the dependencies. When nil, a
+	// cloudnative.DependencyInstaller configured by the flags is used.
+	Installer untested.Installer
 }
 
 func (*Package) Name() string {
@@ -64,45 +75,186 @@ func (p *Package) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&p.version, "version", "", "version to package as")
 	f.BoolVar(&p.cached, "cached", false, "include dependencies")
 	f.StringVar(&p.cacheDir, "cachedir", packager.DefaultCacheDir, "cache dir")
-	f.StringVar(&p.stack, "stack", "", "stack to package buildpack for")
+	f.StringVar(&p.stack, "stack", "", "comma separated stacks to package buildpack for, one zip per stack")
+	f.BoolVar(&p.allStacks, "all-stacks", false, "package buildpack for every Cloud Foundry stack its dependencies support")
 	f.BoolVar(&p.dev, "dev", false, "use local dependencies")
 	f.BoolVar(&p.release, "release", false, "use released dependencies instead of re-packaging from source")
-	f.StringVar(&p.buildpackTOMLPath, "manifestpath", "buildpack.toml", "custom path to a buildpack.toml file")
+	f.StringVar(&p.buildpackTOMLPath, "manifestpath", "buildpack.toml", "custom path to a buildpack.toml file, relative to the source dir")
+	f.StringVar(&p.outputDir, "output", ".", "directory to write the zip file to")
+	f.IntVar(&p.jobs, "jobs", 1, "number of dependencies to package at once")
+	f.DurationVar(&p.downloadTimeout, "download-timeout", cloudnative.DefaultDownloadTimeout, "time allowed for each download attempt, 0 for no limit")
+	f.StringVar(&p.netrcPath, "netrc", "", "netrc file with logins for dependency hosts (default $NETRC or ~/.netrc)")
+	f.StringVar(&p.credentialsPath, "credentials", "", "TOML file with bearer tokens or logins for dependency hosts")
+	f.StringVar(&p.lockfilePath, "lockfile", cloudnative.LockfileName, "path to the lockfile recording the packaged dependencies, relative to the source dir")
+	f.BoolVar(&p.locked, "locked", false, "fail instead of packaging dependencies that differ from the lockfile")
+	f.StringVar(&p.sbomFormat, "sbom", "", "write an SBOM in this format (cyclonedx or spdx) alongside the zip and inside it")
+	f.StringVar(&p.releaseNotesPath, "release-notes", "", "write markdown release notes listing every packaged CNB to this path")
+	f.StringVar(&p.previousPath, "previous", "", "zip or lockfile of the previous release to describe changes against in the release notes")
+	f.StringVar(&p.signKeyPath, "sign-key", "", "PEM encoded ed25519 private key to sign manifest.yml inside the zip, and the zip itself, with")
+	f.BoolVar(&p.reproducible, "reproducible", false, "normalize timestamps, ownership, permissions and ordering in the built CNBs and the zip, honouring SOURCE_DATE_EPOCH")
+	f.IntVar(&p.downloadRetries, "download-retries", cloudnative.DefaultDownloadRetries, "number of times to retry a download after a server or connection error")
 }
 
 func (p *Package) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if p.version == "" {
+		fmt.Println("-version is a required flag")
+		return subcommands.ExitUsageError
+	}
+
+	if p.stack == "" && !p.allStacks {
+		fmt.Println("-stack or -all-stacks is a required flag")
+		return subcommands.ExitUsageError
+	}
+
+	if p.stack != "" && p.allStacks {
+		fmt.Println("-stack and -all-stacks cannot be used together")
+		return subcommands.ExitUsageError
+	}
+
+	if p.sbomFormat != "" && !cloudnative.IsSBOMFormat(p.sbomFormat) {
+		fmt.Printf("-sbom must be one of %s\n", strings.Join(cloudnative.SBOMFormats, ", "))
+		return subcommands.ExitUsageError
+	}
+
+	if p.previousPath != "" && p.releaseNotesPath == "" {
+		fmt.Println("-previous requires -release-notes")
+		return subcommands.ExitUsageError
+	}
+
+	if f.NArg() > 1 {
+		fmt.Print(PackageUsage)
+		return subcommands.ExitUsageError
+	}
+
+	p.sourceDir = "."
+	if f.NArg() == 1 {
+		p.sourceDir = f.Arg(0)
+	}
+
+	zipFiles, err := p.Run()
+	if err != nil {
+		log.Println(Summarize(err))
+		return ExitStatus(err)
+	}
+
+	for _, zipFile := range zipFiles {
+		log.Printf("Packaged Shimmed Buildpack at: %s", zipFile)
+	}
+
+	return subcommands.ExitSuccess
+}
+
+// Run packages the shimmed buildpack once per stack and returns the paths
+// of the zip files. Failures are returned as cloudnative.Error values
+// describing their kind.
+func (p *Package) Run() ([]string, error) {
 	// START setup
 	tmpDir, err := ioutil.TempDir("", "cnb2cf")
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	defer os.RemoveAll(tmpDir)
 
 	statikFS, err := fs.New()
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	credentials, err := p.credentials()
+	if err != nil {
+		return nil, err
 	}
 
 	filesystem := cloudnative.NewFilesystem(statikFS)
-	dependencyInstaller := cloudnative.NewDependencyInstaller()
-	dependencyPackager := untested.NewDependencyPackager(tmpDir, p.cached, p.dev, dependencyInstaller)
+	dependencyInstaller := p.Installer
+	if dependencyInstaller == nil {
+		dependencyInstaller = cloudnative.NewDependencyInstaller().
+			WithCache(cloudnative.NewDownloadCache(p.cacheDir)).
+			WithCredentials(credentials).
+			WithTimeout(p.downloadTimeout).
+			WithRetries(p.downloadRetries, cloudnative.DefaultRetryBackoff)
+	}
+	dependencyPackager := untested.NewDependencyPackager(tmpDir, p.cached, p.dev, p.release, dependencyInstaller)
 	lifecycleHooks := cloudnative.NewLifecycleHooks(filesystem)
+	if p.reproducible {
+		if p.sourceDate, err = cloudnative.SourceDate(); err != nil {
+			return nil, err
+		}
+		dependencyPackager = dependencyPackager.WithReproducible(p.sourceDate, filepath.Join(p.cacheDir, "built"))
+	}
+	if p.signKeyPath != "" {
+		if p.signingKey, err = cloudnative.ReadSigningKey(p.signKeyPath); err != nil {
+			return nil, err
+		}
+	}
 	// END setup
 
+	sourceDir, err := filepath.Abs(p.sourceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	buildpackTOMLPath := p.buildpackTOMLPath
+	if !filepath.IsAbs(buildpackTOMLPath) {
+		buildpackTOMLPath = filepath.Join(sourceDir, buildpackTOMLPath)
+	}
+
+	lockfilePath := p.lockfilePath
+	if !filepath.IsAbs(lockfilePath) {
+		lockfilePath = filepath.Join(sourceDir, lockfilePath)
+	}
+
+	var lockfile *cloudnative.Lockfile
+	if p.locked {
+		locked, err := cloudnative.ReadLockfile(lockfilePath)
+		if err != nil {
+			return nil, err
+		}
+		lockfile = &locked
+	}
+
+	var previous *cloudnative.ShimmedBuildpack
+	if p.previousPath != "" {
+		release, err := cloudnative.ReadPreviousRelease(p.previousPath)
+		if err != nil {
+			return nil, err
+		}
+		previous = &release
+	}
+
 	// Parse current buildpack.toml
-	buildpack, err := cloudnative.ParseBuildpack("buildpack.toml")
+	buildpack, err := cloudnative.ParseBuildpack(buildpackTOMLPath)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	if p.version == "" {
-		fmt.Printf("--version is a required flag")
-		os.Exit(1)
+	stacks := buildpack.Stacks()
+	if !p.allStacks {
+		stacks = nil
+		for _, stack := range strings.Split(p.stack, ",") {
+			if stack = strings.TrimSpace(stack); stack != "" {
+				stacks = append(stacks, stack)
+			}
+		}
+	}
+
+	for _, stack := range stacks {
+		if err := cloudnative.ValidateBuildpack(buildpackTOMLPath, stack); err != nil {
+			return nil, err
+		}
 	}
 
-	if p.stack == "" {
-		fmt.Printf("--stack is a required flag")
-		os.Exit(1)
+	for i, dependency := range buildpack.Metadata.Dependencies {
+		buildpack.Metadata.Dependencies[i].URI = cloudnative.ResolveFileURI(dependency.URI, sourceDir)
+		buildpack.Metadata.Dependencies[i].Source = cloudnative.ResolveFileURI(dependency.Source, sourceDir)
+	}
+
+	if lockfile != nil {
+		for _, stack := range stacks {
+			if err := lockfile.Stack(stack).VerifySources(declaredSources(buildpack, stack, sourceDir)); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	buildpack.Info.Version = p.version
@@ -111,76 +263,134 @@ func (p *Package) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{})
 	buildDir := filepath.Join(tmpDir, buildpack.Info.ID, "build")
 	err = os.MkdirAll(buildDir, 0777)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	var zipFiles []string
+	var packaged cloudnative.Lockfile
+	for _, stack := range stacks {
+		// the dependency packager is shared between stacks so that each CNB is only downloaded and built once
+		zipFile, locked, err := p.packageStack(buildpack, stack, sourceDir, dependencyPackager, lifecycleHooks, lockfile)
+		if err != nil {
+			return nil, err
+		}
+
+		zipFiles = append(zipFiles, zipFile)
+		packaged.Dependencies = append(packaged.Dependencies, locked...)
 	}
 
+	if !p.locked {
+		if err := cloudnative.WriteLockfile(packaged, lockfilePath); err != nil {
+			return nil, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to write %s", lockfilePath)
+		}
+	}
+
+	if p.releaseNotesPath != "" {
+		if err := p.writeReleaseNotes(cloudnative.NewReleaseNotes(buildpack, packaged, previous)); err != nil {
+			return nil, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to write release notes")
+		}
+	}
+
+	return zipFiles, nil
+}
+
+// packageStack packages the buildpack for one stack and returns the path of
+// the zip file along with the lockfile entries for its dependencies. When
+// lockfile is given, the dependencies must match it before the zip is made.
+func (p *Package) packageStack(buildpack cloudnative.Buildpack, stack, sourceDir string, dependencyPackager untested.DependencyPackager, lifecycleHooks cloudnative.LifecycleHooks, lockfile *cloudnative.Lockfile) (string, []cloudnative.LockedDependency, error) {
 	// package child dependencies of the top-level CNB
 	var dependencies []cloudnative.BuildpackMetadataDependency
-	if p.release {
-		// TODO: fix the if branch
-		err := Fetch(buildpack, dependencyInstaller)
-		if err != nil {
-			panic(err)
-		}
-		dependencies = buildpack.Metadata.Dependencies
-	} else {
-
-		for _, dependency := range buildpack.Metadata.Dependencies {
-			var deps []cloudnative.BuildpackMetadataDependency
-			var err error
-			deps, err = dependencyPackager.Package(dependency, p.stack)
-			if err != nil {
-				log.Printf("failed to handle dependency: %s\n", err)
-				return subcommands.ExitFailure
-			}
+	var locked cloudnative.Lockfile
+	deps, err := dependencyPackager.PackageAll(buildpack.Metadata.Dependencies, stack, p.jobs)
+	if err != nil {
+		return "", nil, err
+	}
 
-			for _, dep := range deps {
-				dependencies = append(dependencies, cloudnative.BuildpackMetadataDependency{
-					ID:           dep.ID,
-					Version:      dep.Version,
-					URI:          dep.URI,
-					SHA256:       dep.SHA256,
-					Source:       dep.Source,
-					SourceSHA256: dep.SourceSHA256,
-					Stacks:       dep.Stacks,
-				})
-			}
+	for _, dep := range deps {
+		dependencies = append(dependencies, cloudnative.BuildpackMetadataDependency{
+			ID:           dep.ID,
+			Version:      dep.Version,
+			URI:          dep.URI,
+			SHA256:       dep.SHA256,
+			Source:       dep.Source,
+			SourceSHA256: dep.SourceSHA256,
+			Stacks:       dep.Stacks,
+		})
+
+		locked.Dependencies = append(locked.Dependencies, cloudnative.LockedDependency{
+			ID:           dep.ID,
+			Version:      dep.Version,
+			Stack:        stack,
+			Parent:       dep.Parent,
+			Source:       cloudnative.RelativeFileURI(dep.Source, sourceDir),
+			SourceSHA256: dep.SourceSHA256,
+			SHA256:       dep.SHA256,
+			BuildTool:    dep.BuildTool,
+		})
+	}
+
+	if lockfile != nil {
+		if err := lockfile.Stack(stack).Verify(locked, p.reproducible); err != nil {
+			return "", nil, err
 		}
 	}
 
 	dir, err := ioutil.TempDir("", "buildpack-packager")
 	if err != nil {
-		panic(err)
+		return "", nil, err
 	}
 	defer os.RemoveAll(dir)
 
 	// write the buildpack.toml to disk
 	bpTOMLFile, err := os.OpenFile(filepath.Join(dir, "buildpack.toml"), os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
-		panic(err)
+		return "", nil, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to write buildpack.toml")
 	}
+	defer bpTOMLFile.Close()
+
 	err = toml.NewEncoder(bpTOMLFile).Encode(buildpack)
 	if err != nil {
-		panic(err)
+		return "", nil, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to encode buildpack.toml")
 	}
 
 	for _, hook := range []string{"compile", "detect", "finalize", "release", "supply"} {
 		if err := lifecycleHooks.Install(hook, dir); err != nil {
-			panic(err)
+			return "", nil, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to install lifecycle hooks")
 		}
 	}
 
 	manifest := cloudnative.NewManifest(buildpack.Info.ID, dependencies)
+
+	for _, file := range buildpack.Metadata.IncludeFiles {
+		if containsString(manifest.IncludeFiles, file) {
+			continue
+		}
+
+		if err := libbuildpack.CopyFile(filepath.Join(sourceDir, file), filepath.Join(dir, file)); err != nil {
+			return "", nil, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to include %s", file)
+		}
+
+		manifest.IncludeFiles = append(manifest.IncludeFiles, file)
+	}
+
+	if p.sbomFormat != "" {
+		sbomFile := cloudnative.SBOMFileName(p.sbomFormat)
+		if err := cloudnative.WriteSBOM(p.sbom(buildpack, stack, sourceDir, deps), p.sbomFormat, filepath.Join(dir, sbomFile)); err != nil {
+			return "", nil, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to write SBOM")
+		}
+
+		manifest.IncludeFiles = append(manifest.IncludeFiles, sbomFile)
+	}
+
 	if err := cloudnative.WriteManifest(manifest, filepath.Join(dir, "manifest.yml")); err != nil {
-		log.Printf("failed to update manifest: %s\n", err.Error())
-		return subcommands.ExitFailure
+		return "", nil, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to update manifest")
 	}
 
 	// Uses V2B Packager to ensure cached dependencies are set up correctly
 	// Cached is always true, because the CNBs are being cached (even if their internal dependencies aren't) within the shimmed buildpack
-	zipFile, err := cfPackager.Package(dir, p.cacheDir, buildpack.Info.Version, p.stack, true)
+	zipFile, err := cfPackager.Package(dir, p.cacheDir, buildpack.Info.Version, stack, true)
 	if err != nil {
-		return subcommands.ExitFailure
+		return "", nil, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to create buildpack zip")
 	}
 
 	newName := filepath.Base(zipFile)
@@ -188,12 +398,169 @@ func (p *Package) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{})
 		newName = strings.Replace(newName, "-cached", "", 1)
 	}
 
+	newName = filepath.Join(p.outputDir, newName)
 	if err := libbuildpack.CopyFile(zipFile, newName); err != nil {
-		log.Print(err.Error())
-		return subcommands.ExitFailure
+		return "", nil, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to copy buildpack zip")
 	}
 
-	log.Printf("Packaged Shimmed Buildpack at: %s", filepath.Base(newName))
+	if p.signingKey != nil {
+		if err := cloudnative.SignManifest(newName, p.signingKey); err != nil {
+			return "", nil, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to sign manifest.yml")
+		}
+	}
 
-	return subcommands.ExitSuccess
+	if p.reproducible {
+		if err := cloudnative.NormalizeZip(newName, p.sourceDate); err != nil {
+			return "", nil, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to normalize buildpack zip")
+		}
+	}
+
+	if p.signingKey != nil {
+		if err := signature.SignFile(newName, newName+signature.Extension, p.signingKey); err != nil {
+			return "", nil, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to sign buildpack zip")
+		}
+	}
+
+	if p.sbomFormat != "" {
+		sbomFile := cloudnative.SBOMFileName(p.sbomFormat)
+		if err := libbuildpack.CopyFile(filepath.Join(dir, sbomFile), strings.TrimSuffix(newName, ".zip")+"."+sbomFile); err != nil {
+			return "", nil, cloudnative.NewError(cloudnative.ArchiveError, err, "failed to copy SBOM")
+		}
+	}
+
+	return newName, locked.Dependencies, nil
+}
+
+// sbom lists the lifecycle, each CNB and the runtime dependencies that
+// each CNB declares for the stack.
+func (p *Package) sbom(buildpack cloudnative.Buildpack, stack, sourceDir string, deps []untested.PackagedDependency) cloudnative.SBOM {
+	created := time.Now()
+	if p.reproducible {
+		created = p.sourceDate
+	}
+
+	sbom := cloudnative.SBOM{
+		Name:    buildpack.Info.ID,
+		Version: buildpack.Info.Version,
+		Stack:   stack,
+		Created: created,
+	}
+
+	for _, dep := range deps {
+		kind := cloudnative.SBOMBuildpack
+		if dep.ID == cloudnative.Lifecycle {
+			kind = cloudnative.SBOMLifecycle
+		}
+
+		component := cloudnative.SBOMComponent{
+			Kind:     kind,
+			ID:       dep.ID,
+			Version:  dep.Version,
+			SHA256:   dep.SHA256,
+			Licenses: dep.Licenses,
+			Parent:   dep.Parent,
+		}
+
+		// a CNB built from its source, or pinned from an image, is not the artifact that was downloaded
+		if dep.Source != "" && dep.Origin == dep.Source {
+			component.Source = cloudnative.RelativeFileURI(dep.Origin, sourceDir)
+			component.SourceSHA256 = dep.SourceSHA256
+		} else {
+			component.URI = cloudnative.RelativeFileURI(dep.Origin, sourceDir)
+		}
+
+		sbom.Components = append(sbom.Components, component)
+
+		for _, runtime := range dep.RuntimeDependencies {
+			if !runtime.MatchesStack(stack) {
+				continue
+			}
+
+			sbom.Components = append(sbom.Components, cloudnative.SBOMComponent{
+				Kind:     cloudnative.SBOMDependency,
+				ID:       runtime.ID,
+				Version:  runtime.Version,
+				URI:      runtime.URI,
+				SHA256:   runtime.SHA256,
+				Licenses: runtime.Licenses,
+				Parent:   dep.ID,
+			})
+		}
+	}
+
+	return sbom
+}
+
+// declaredSources returns lockfile entries holding the sources that
+// buildpack.toml declares for the top-level dependencies of the stack.
+func declaredSources(buildpack cloudnative.Buildpack, stack, sourceDir string) cloudnative.Lockfile {
+	var declared cloudnative.Lockfile
+	for _, dependency := range buildpack.Metadata.Dependencies {
+		if !dependency.MatchesStack(stack) {
+			continue
+		}
+
+		declared.Dependencies = append(declared.Dependencies, cloudnative.LockedDependency{
+			ID:           dependency.ID,
+			Version:      dependency.Version,
+			Stack:        stack,
+			Source:       cloudnative.RelativeFileURI(dependency.Source, sourceDir),
+			SourceSHA256: dependency.SourceSHA256,
+		})
+	}
+
+	return declared
+}
+
+func (p *Package) writeReleaseNotes(notes cloudnative.ReleaseNotes) error {
+	file, err := os.Create(p.releaseNotesPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return WriteReleaseNotes(file, notes)
+}
+
+// credentials scopes GIT_TOKEN to GitHub and adds the logins from the netrc
+// file and then the credentials file, so that the most specific source wins.
+// The default netrc file is optional; one given explicitly is not.
+func (p *Package) credentials() (cloudnative.Credentials, error) {
+	credentials := cloudnative.NewCredentials().WithGitHubToken(os.Getenv("GIT_TOKEN"))
+
+	netrcPath := p.netrcPath
+	if netrcPath == "" {
+		netrcPath = os.Getenv("NETRC")
+	}
+	if netrcPath == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if _, err := os.Stat(filepath.Join(home, ".netrc")); err == nil {
+				netrcPath = filepath.Join(home, ".netrc")
+			}
+		}
+	}
+
+	var err error
+	if netrcPath != "" {
+		if credentials, err = credentials.WithNetrc(netrcPath); err != nil {
+			return credentials, err
+		}
+	}
+
+	if p.credentialsPath != "" {
+		if credentials, err = credentials.WithFile(p.credentialsPath); err != nil {
+			return credentials, err
+		}
+	}
+
+	return credentials, nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
 }
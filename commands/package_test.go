@@ -1,47 +1,351 @@
 package commands_test
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/cloudfoundry/cnb2cf/cloudnative"
 	"github.com/cloudfoundry/cnb2cf/cloudnative/untested/fakes"
 	"github.com/cloudfoundry/cnb2cf/commands"
-
+	"github.com/cloudfoundry/cnb2cf/shims"
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/google/subcommands"
+	statikfs "github.com/rakyll/statik/fs"
+	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
 
 	. "github.com/onsi/gomega"
-	"github.com/sclevine/spec"
 )
 
 func TestUnitPackageCommand(t *testing.T) {
-	spec.Run(t, "Node", testPackageCommand, spec.Report(report.Terminal{}))
+	spec.Run(t, "Package", testPackageCommand, spec.Report(report.Terminal{}))
 }
 
 func testPackageCommand(t *testing.T, when spec.G, it spec.S) {
-	//var pkg commands.Package
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		tmpDir, sourceDir, outputDir string
+		installer                    *fakes.Installer
+		lifecycleSHA, cnbSHA         string
+	)
+
+	execute := func(args ...string) subcommands.ExitStatus {
+		pkg := &commands.Package{Installer: installer}
+		flags := flag.NewFlagSet("package", flag.ContinueOnError)
+		pkg.SetFlags(flags)
+		Expect(flags.Parse(append([]string{"-cachedir", filepath.Join(tmpDir, "cache"), "-output", outputDir}, args...))).To(Succeed())
+
+		return pkg.Execute(context.Background(), flags)
+	}
+
 	it.Before(func() {
-		RegisterTestingT(t)
+		Expect = NewWithT(t).Expect
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "package")
+		Expect(err).NotTo(HaveOccurred())
+
+		sourceDir = filepath.Join(tmpDir, "source")
+		outputDir = filepath.Join(tmpDir, "output")
+		Expect(os.MkdirAll(sourceDir, 0755)).To(Succeed())
+		Expect(os.MkdirAll(outputDir, 0755)).To(Succeed())
+
+		lifecycleSHA = writeTarGz(t, filepath.Join(sourceDir, "lifecycle.tgz"), map[string]string{"lifecycle/detector": "detector"})
+		cnbSHA = writeTarGz(t, filepath.Join(sourceDir, "nodejs.tgz"), map[string]string{"buildpack.toml": `api = "0.2"
+
+[buildpack]
+  id = "org.cloudfoundry.nodejs"
+  version = "1.0.0"
+
+[[stacks]]
+  id = "org.cloudfoundry.stacks.cflinuxfs3"
+`})
 
+		Expect(ioutil.WriteFile(filepath.Join(sourceDir, "buildpack.toml"), []byte(fmt.Sprintf(`api = "0.2"
+
+[buildpack]
+  id = "org.cloudfoundry.shim"
+  name = "Shimmed Buildpack"
+
+[metadata]
+  include_files = ["buildpack.toml"]
+
+[[metadata.dependencies]]
+  id = "lifecycle"
+  version = "0.7.2"
+  uri = "file://lifecycle.tgz"
+  sha256 = "%s"
+  stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]
+
+[[metadata.dependencies]]
+  id = "org.cloudfoundry.nodejs"
+  version = "1.0.0"
+  uri = "file://nodejs.tgz"
+  sha256 = "%s"
+  source = "https://example.com/nodejs-cnb/archive/v1.0.0.tar.gz"
+  source_sha256 = "%s"
+  stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]
+
+[[order]]
+
+[[order.group]]
+  id = "org.cloudfoundry.nodejs"
+  version = "1.0.0"
+`, lifecycleSHA, cnbSHA, strings.Repeat("a", 64))), 0644)).To(Succeed())
+
+		// the shims are only embedded by scripts/build.sh, so stand in for them
+		statikfs.Register(hooksZip(t, "compile", "detect", "finalize", "release", "supply"))
+
+		// the fake installer downloads file uris by copying them
+		installer = &fakes.Installer{}
+		installer.DownloadCall.Stub = func(uri, checksum, destination string) error {
+			return libbuildpack.CopyFile(strings.TrimPrefix(uri, "file://"), destination)
+		}
 	})
 
-	when("calling Fetch", func() {
-		it("fetches dependencies in a buildpack", func() {
-			mockInstaller := fakes.Installer{}
-			bpTOMLStub := filepath.Join("testdata", "buildpack.toml")
+	it.After(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	when("flags are missing", func() {
+		it("requires -version", func() {
+			Expect(execute("-stack", "cflinuxfs3", sourceDir)).To(Equal(subcommands.ExitUsageError))
+		})
 
-			buildpack, err := cloudnative.ParseBuildpack(bpTOMLStub)
+		it("requires -stack or -all-stacks, but not both", func() {
+			Expect(execute("-version", "1.2.3", sourceDir)).To(Equal(subcommands.ExitUsageError))
+			Expect(execute("-version", "1.2.3", "-stack", "cflinuxfs3", "-all-stacks", sourceDir)).To(Equal(subcommands.ExitUsageError))
+		})
+	})
+
+	when("-release is given", func() {
+		it("packages the released CNB tarballs without building them", func() {
+			Expect(execute("-version", "1.2.3", "-stack", "cflinuxfs3", "-release", sourceDir)).To(Equal(subcommands.ExitSuccess))
+
+			Expect(installer.DownloadCall.CallCount).To(Equal(2))
+			Expect(installer.DownloadCall.Receives.Uri).To(Equal("file://" + filepath.Join(sourceDir, "nodejs.tgz")))
+			Expect(installer.DownloadCall.Receives.Checksum).To(Equal(cnbSHA))
+
+			zipFile := filepath.Join(outputDir, "shim_buildpack-cflinuxfs3-v1.2.3.zip")
+			shimmed, err := cloudnative.ReadShimmedBuildpack(zipFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(shimmed.Manifest.Stack).To(Equal("cflinuxfs3"))
+			Expect(shimmed.Manifest.Dependencies).To(HaveLen(2))
+			Expect(shimmed.Manifest.Dependencies[0].ID).To(Equal("lifecycle"))
+			Expect(shimmed.Manifest.Dependencies[0].SHA256).To(Equal(lifecycleSHA))
+			Expect(shimmed.Manifest.Dependencies[1].ID).To(Equal("org.cloudfoundry.nodejs"))
+			Expect(shimmed.Manifest.Dependencies[1].SHA256).To(Equal(cnbSHA))
+
+			lockfile, err := cloudnative.ReadLockfile(filepath.Join(sourceDir, cloudnative.LockfileName))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(lockfile.Dependencies).To(HaveLen(2))
+			Expect(lockfile.Dependencies[1].Stack).To(Equal("cflinuxfs3"))
+			Expect(lockfile.Dependencies[1].SHA256).To(Equal(cnbSHA))
+			Expect(lockfile.Dependencies[1].BuildTool).To(BeEmpty())
+		})
+
+		it("fails with the download exit status when a CNB cannot be downloaded", func() {
+			installer.DownloadCall.Stub = nil
+			installer.DownloadCall.Returns.Error = fmt.Errorf("connection refused")
+
+			Expect(execute("-version", "1.2.3", "-stack", "cflinuxfs3", "-release", sourceDir)).To(Equal(commands.ExitDownloadError))
+		})
+	})
+
+	when("the buildpack.toml configures the platform env", func() {
+		it.Before(func() {
+			path := filepath.Join(sourceDir, "buildpack.toml")
+			contents, err := ioutil.ReadFile(path)
 			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(path, []byte(strings.Replace(string(contents), `  include_files = ["buildpack.toml"]
+`, `  include_files = ["buildpack.toml"]
+
+  [metadata.platform_env]
+    allow = ["BP_*", "NODE_ENV"]
+    deny = ["*_TOKEN"]
+
+    [metadata.platform_env.actions]
+      NODE_ENV = "override"
+`, 1)), 0644)).To(Succeed())
+		})
 
-			err = commands.Fetch(buildpack, &mockInstaller)
+		it("packages it in the buildpack.toml of the zip", func() {
+			Expect(execute("-version", "1.2.3", "-stack", "cflinuxfs3", "-release", sourceDir)).To(Equal(subcommands.ExitSuccess))
 
+			reader, err := zip.OpenReader(filepath.Join(outputDir, "shim_buildpack-cflinuxfs3-v1.2.3.zip"))
 			Expect(err).NotTo(HaveOccurred())
-			Expect(mockInstaller.DownloadCall.CallCount).To(Equal(3))
-			Expect(mockInstaller.DownloadCall.Receives.Uri).To(Equal("https://github.com/cloudfoundry/nodejs-cnb/releases/download/v0.0.2/nodejs-cnb-compat-cflinuxfs3-v0.0.2.zip"))
-			Expect(mockInstaller.DownloadCall.Receives.Checksum).To(Equal("a5d53002f97f380b40dace0112c21f4b2b60ba382a0fb499ca7c74c2d8fc44e9"))
-			destination := filepath.Join(os.TempDir(), "downloads", "")
-			Expect(mockInstaller.DownloadCall.Receives.Destination).To(Equal(destination))
+			defer reader.Close()
+
+			path := filepath.Join(tmpDir, "packaged.toml")
+			for _, file := range reader.File {
+				if file.Name != "buildpack.toml" {
+					continue
+				}
+
+				r, err := file.Open()
+				Expect(err).NotTo(HaveOccurred())
+				contents, err := ioutil.ReadAll(r)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(r.Close()).To(Succeed())
+				Expect(ioutil.WriteFile(path, contents, 0644)).To(Succeed())
+			}
+
+			platformEnv, err := shims.ReadPlatformEnv(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(platformEnv).To(Equal(shims.PlatformEnv{
+				Allow:   []string{"BP_*", "NODE_ENV"},
+				Deny:    []string{"*_TOKEN"},
+				Actions: map[string]string{"NODE_ENV": "override"},
+			}))
 		})
 	})
+
+	when("several stacks are given", func() {
+		it.Before(func() {
+			path := filepath.Join(sourceDir, "buildpack.toml")
+			contents, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(path, []byte(strings.Replace(string(contents), `stacks = ["org.cloudfoundry.stacks.cflinuxfs3"]`, `stacks = ["org.cloudfoundry.stacks.cflinuxfs3", "org.cloudfoundry.stacks.cflinuxfs4"]`, -1)), 0644)).To(Succeed())
+		})
+
+		it("writes a zip per stack from one download of each dependency", func() {
+			Expect(execute("-version", "1.2.3", "-stack", "cflinuxfs3,cflinuxfs4", "-release", sourceDir)).To(Equal(subcommands.ExitSuccess))
+			Expect(installer.DownloadCall.CallCount).To(Equal(2))
+
+			for _, stack := range []string{"cflinuxfs3", "cflinuxfs4"} {
+				shimmed, err := cloudnative.ReadShimmedBuildpack(filepath.Join(outputDir, fmt.Sprintf("shim_buildpack-%s-v1.2.3.zip", stack)))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(shimmed.Manifest.Stack).To(Equal(stack))
+				Expect(shimmed.Manifest.Dependencies).To(HaveLen(2))
+				Expect(shimmed.Manifest.Dependencies[1].SHA256).To(Equal(cnbSHA))
+			}
+		})
+
+		it("packages for every stack the dependencies list with -all-stacks", func() {
+			Expect(execute("-version", "1.2.3", "-all-stacks", "-release", sourceDir)).To(Equal(subcommands.ExitSuccess))
+			Expect(installer.DownloadCall.CallCount).To(Equal(2))
+
+			Expect(filepath.Join(outputDir, "shim_buildpack-cflinuxfs3-v1.2.3.zip")).To(BeARegularFile())
+			Expect(filepath.Join(outputDir, "shim_buildpack-cflinuxfs4-v1.2.3.zip")).To(BeARegularFile())
+		})
+	})
+
+	when("the source dir is not the working directory", func() {
+		var workingDir string
+
+		it.Before(func() {
+			var err error
+			workingDir, err = os.Getwd()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.Chdir(tmpDir)).To(Succeed())
+
+			contents, err := ioutil.ReadFile(filepath.Join(sourceDir, "buildpack.toml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.MkdirAll(filepath.Join(sourceDir, "shims"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(sourceDir, "shims", "nodejs.toml"), []byte(strings.Replace(string(contents), `include_files = ["buildpack.toml"]`, `include_files = ["buildpack.toml", "NOTICE"]`, 1)), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(sourceDir, "NOTICE"), []byte("some notice"), 0644)).To(Succeed())
+		})
+
+		it.After(func() {
+			Expect(os.Chdir(workingDir)).To(Succeed())
+		})
+
+		it("resolves the manifest, included files and file uris against the source dir", func() {
+			Expect(execute("-version", "1.2.3", "-stack", "cflinuxfs3", "-release", "-manifestpath", filepath.Join("shims", "nodejs.toml"), "source")).To(Equal(subcommands.ExitSuccess))
+
+			Expect(installer.DownloadCall.Receives.Uri).To(Equal("file://" + filepath.Join(sourceDir, "nodejs.tgz")))
+
+			reader, err := zip.OpenReader(filepath.Join(outputDir, "shim_buildpack-cflinuxfs3-v1.2.3.zip"))
+			Expect(err).NotTo(HaveOccurred())
+			defer reader.Close()
+
+			var names []string
+			for _, file := range reader.File {
+				names = append(names, file.Name)
+			}
+			Expect(names).To(ContainElement("NOTICE"))
+
+			Expect(filepath.Join(sourceDir, cloudnative.LockfileName)).To(BeARegularFile())
+			Expect(filepath.Join(tmpDir, cloudnative.LockfileName)).NotTo(BeAnExistingFile())
+		})
+	})
+
+	when("-locked is given", func() {
+		it.Before(func() {
+			Expect(execute("-version", "1.2.3", "-stack", "cflinuxfs3", "-release", sourceDir)).To(Equal(subcommands.ExitSuccess))
+			installer.DownloadCall.CallCount = 0
+		})
+
+		it("packages dependencies that match the lockfile", func() {
+			Expect(execute("-version", "1.2.3", "-stack", "cflinuxfs3", "-release", "-locked", sourceDir)).To(Equal(subcommands.ExitSuccess))
+			Expect(installer.DownloadCall.CallCount).To(Equal(2))
+		})
+
+		it("fails before downloading anything when a source differs from the lockfile", func() {
+			path := filepath.Join(sourceDir, "buildpack.toml")
+			contents, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(path, []byte(strings.Replace(string(contents), "v1.0.0.tar.gz", "v1.0.1.tar.gz", 1)), 0644)).To(Succeed())
+
+			Expect(execute("-version", "1.2.3", "-stack", "cflinuxfs3", "-release", "-locked", sourceDir)).To(Equal(commands.ExitBuildError))
+			Expect(installer.DownloadCall.CallCount).To(Equal(0))
+		})
+	})
+}
+
+// writeTarGz writes files to a gzipped tarball at path and returns its
+// sha256.
+func writeTarGz(t *testing.T, path string, files map[string]string) string {
+	Expect := NewWithT(t).Expect
+
+	file, err := os.Create(path)
+	Expect(err).NotTo(HaveOccurred())
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	for name, contents := range files {
+		Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents))})).To(Succeed())
+		_, err := tw.Write([]byte(contents))
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(tw.Close()).To(Succeed())
+	Expect(gz.Close()).To(Succeed())
+
+	contents, err := ioutil.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred())
+	sum := sha256.Sum256(contents)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// hooksZip returns the statik data for a filesystem holding a placeholder
+// script for each lifecycle hook.
+func hooksZip(t *testing.T, hooks ...string) string {
+	Expect := NewWithT(t).Expect
+
+	buffer := bytes.NewBuffer(nil)
+	zw := zip.NewWriter(buffer)
+	for _, hook := range hooks {
+		w, err := zw.Create("bin/" + hook)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = w.Write([]byte("#!/usr/bin/env bash\n"))
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(zw.Close()).To(Succeed())
+
+	return buffer.String()
 }
@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+)
+
+// WriteReleaseNotes writes the notes as markdown, listing each packaged CNB
+// beneath the meta-buildpack that it was packaged for.
+func WriteReleaseNotes(w io.Writer, notes cloudnative.ReleaseNotes) error {
+	title := notes.Name
+	if title == "" {
+		title = notes.ID
+	}
+	fmt.Fprintf(w, "# %s %s\n\n", title, notes.Version)
+
+	fmt.Fprintf(w, "**Buildpack ID:** `%s`  \n", notes.ID)
+	fmt.Fprintf(w, "**Lifecycle:** %s  \n", markdownVersion(notes.Lifecycle))
+	fmt.Fprintf(w, "**Stacks:** %s\n\n", markdownList(notes.Stacks))
+
+	fmt.Fprintln(w, "## Packaged buildpacks")
+	fmt.Fprintln(w)
+
+	written := map[int]bool{}
+	var writeChildren func(parent string, depth int)
+	writeChildren = func(parent string, depth int) {
+		for i, buildpack := range notes.Buildpacks {
+			if buildpack.Parent != parent || written[i] {
+				continue
+			}
+			written[i] = true
+
+			fmt.Fprintf(w, "%s- `%s` %s (%s)\n", strings.Repeat("  ", depth), buildpack.ID, markdownVersion(buildpack.Version), strings.Join(buildpack.Stacks, ", "))
+			writeChildren(buildpack.ID, depth+1)
+		}
+	}
+	writeChildren("", 0)
+
+	// children whose meta-buildpack was not packaged are listed at the top level
+	for i, buildpack := range notes.Buildpacks {
+		if !written[i] {
+			written[i] = true
+			fmt.Fprintf(w, "- `%s` %s (%s, in `%s`)\n", buildpack.ID, markdownVersion(buildpack.Version), strings.Join(buildpack.Stacks, ", "), buildpack.Parent)
+		}
+	}
+
+	if notes.Changes == nil {
+		return nil
+	}
+
+	fmt.Fprintln(w)
+	if notes.Changes.FromVersion != "" {
+		fmt.Fprintf(w, "## Changes since %s\n\n", notes.Changes.FromVersion)
+	} else {
+		fmt.Fprintln(w, "## Changes since the previous release")
+		fmt.Fprintln(w)
+	}
+
+	return writeDiffSections(w, *notes.Changes)
+}
@@ -0,0 +1,72 @@
+package commands_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/cloudfoundry/cnb2cf/commands"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestUnitReleaseNotes(t *testing.T) {
+	spec.Run(t, "ReleaseNotes", testReleaseNotes, spec.Report(report.Terminal{}))
+}
+
+func testReleaseNotes(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		notes cloudnative.ReleaseNotes
+	)
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		notes = cloudnative.ReleaseNotes{
+			ID:        "org.cloudfoundry.nodejs",
+			Name:      "Node.js Buildpack",
+			Version:   "1.1.0",
+			Lifecycle: "0.7.5",
+			Stacks:    []string{"bionic", "cflinuxfs3"},
+			Buildpacks: []cloudnative.ReleaseNotesBuildpack{
+				{ID: "org.cloudfoundry.nodejs-meta", Version: "0.2.0", Stacks: []string{"bionic", "cflinuxfs3"}},
+				{ID: "org.cloudfoundry.node-engine", Version: "0.0.100", Parent: "org.cloudfoundry.nodejs-meta", Stacks: []string{"cflinuxfs3"}},
+				{ID: "org.cloudfoundry.npm", Version: "0.1.4", Stacks: []string{"cflinuxfs3"}},
+			},
+		}
+	})
+
+	when("WriteReleaseNotes", func() {
+		it("lists the packaged CNBs beneath their meta-buildpacks", func() {
+			buffer := bytes.NewBuffer(nil)
+			Expect(commands.WriteReleaseNotes(buffer, notes)).To(Succeed())
+
+			Expect(buffer.String()).To(Equal("# Node.js Buildpack 1.1.0\n\n" +
+				"**Buildpack ID:** `org.cloudfoundry.nodejs`  \n" +
+				"**Lifecycle:** `0.7.5`  \n" +
+				"**Stacks:** `bionic`, `cflinuxfs3`\n\n" +
+				"## Packaged buildpacks\n\n" +
+				"- `org.cloudfoundry.nodejs-meta` `0.2.0` (bionic, cflinuxfs3)\n" +
+				"  - `org.cloudfoundry.node-engine` `0.0.100` (cflinuxfs3)\n" +
+				"- `org.cloudfoundry.npm` `0.1.4` (cflinuxfs3)\n"))
+		})
+
+		it("describes the changes since the previous release", func() {
+			notes.Changes = &cloudnative.BuildpackDiff{
+				FromVersion:   "1.0.0",
+				ToVersion:     "1.1.0",
+				FromLifecycle: "0.7.2",
+				ToLifecycle:   "0.7.5",
+			}
+
+			buffer := bytes.NewBuffer(nil)
+			Expect(commands.WriteReleaseNotes(buffer, notes)).To(Succeed())
+
+			Expect(buffer.String()).To(HaveSuffix("\n## Changes since 1.0.0\n\n**Lifecycle:** `0.7.2` → `0.7.5`\n\n"))
+		})
+	})
+}
@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"path/filepath"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/google/subcommands"
+)
+
+const UpdateUsage = `update -index <url or path> [-dry-run] [<path to buildpack.toml>]:
+  moves the dependencies of a shimmed buildpack.toml to the newest releases in a release index, and prints the changes.
+
+`
+
+type Update struct {
+	index  string
+	dryRun bool
+}
+
+func (*Update) Name() string {
+	return "update"
+}
+
+func (*Update) Synopsis() string {
+	return "Update the dependencies of a shimmed buildpack.toml to their latest releases"
+}
+
+func (*Update) Usage() string {
+	return UpdateUsage
+}
+
+func (u *Update) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&u.index, "index", "", "url or path of a GitHub releases style JSON index, keyed by dependency id")
+	f.BoolVar(&u.dryRun, "dry-run", false, "print the changes without writing them")
+}
+
+func (u *Update) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() > 1 || u.index == "" {
+		fmt.Print(UpdateUsage)
+		return subcommands.ExitUsageError
+	}
+
+	path := "buildpack.toml"
+	if f.NArg() == 1 {
+		path = f.Arg(0)
+	}
+
+	indexURI := u.index
+	if parsed, err := url.Parse(indexURI); err != nil || parsed.Scheme == "" {
+		absolute, err := filepath.Abs(indexURI)
+		if err != nil {
+			log.Printf("failed to find release index: %s\n", err)
+			return subcommands.ExitFailure
+		}
+		indexURI = "file://" + absolute
+	}
+
+	index, err := cloudnative.NewGitHubReleaseIndex(indexURI, cloudnative.NewDependencyInstaller())
+	if err != nil {
+		log.Println(Summarize(err))
+		return ExitStatus(err)
+	}
+
+	original, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Printf("failed to read %s: %s\n", path, err)
+		return subcommands.ExitFailure
+	}
+
+	updated, updates, err := cloudnative.UpdateBuildpack(path, index)
+	if err != nil {
+		log.Println(Summarize(err))
+		return ExitStatus(err)
+	}
+
+	if len(updates) == 0 {
+		log.Printf("%s is up to date\n", path)
+		return subcommands.ExitSuccess
+	}
+
+	for _, update := range updates {
+		log.Printf("updating %s from %s to %s\n", update.ID, update.From, update.To)
+	}
+
+	fmt.Print(cloudnative.UnifiedDiff("a/"+path, "b/"+path, original, updated))
+
+	if u.dryRun {
+		return subcommands.ExitSuccess
+	}
+
+	if err := ioutil.WriteFile(path, updated, 0644); err != nil {
+		log.Printf("failed to write %s: %s\n", path, err)
+		return subcommands.ExitFailure
+	}
+
+	return subcommands.ExitSuccess
+}
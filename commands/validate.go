@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/cloudfoundry/cnb2cf/cloudnative"
+	"github.com/google/subcommands"
+)
+
+const ValidateUsage = `validate [-stack <stack>] [<path to buildpack.toml>]:
+  checks that a shimmed buildpack.toml is well formed before it is packaged.
+
+`
+
+type Validate struct {
+	stack string
+}
+
+func (*Validate) Name() string {
+	return "validate"
+}
+
+func (*Validate) Synopsis() string {
+	return "Check a shimmed buildpack.toml for problems before packaging"
+}
+
+func (*Validate) Usage() string {
+	return ValidateUsage
+}
+
+func (v *Validate) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&v.stack, "stack", "", "stack to validate the buildpack for")
+}
+
+func (v *Validate) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() > 1 {
+		fmt.Print(ValidateUsage)
+		return subcommands.ExitUsageError
+	}
+
+	path := "buildpack.toml"
+	if f.NArg() == 1 {
+		path = f.Arg(0)
+	}
+
+	if err := cloudnative.ValidateBuildpack(path, v.stack); err != nil {
+		log.Println(Summarize(err))
+		return ExitStatus(err)
+	}
+
+	log.Printf("%s is valid\n", path)
+
+	return subcommands.ExitSuccess
+}
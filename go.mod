@@ -2,6 +2,7 @@ module github.com/cloudfoundry/cnb2cf
 
 require (
 	github.com/BurntSushi/toml v0.3.1
+	github.com/Masterminds/semver v1.5.0
 	github.com/buildpack/libbuildpack v1.25.11
 	github.com/cloudfoundry/dagger v0.0.0-20200515185726-631f0d5088e0
 	github.com/cloudfoundry/libbuildpack v0.0.0-20200515185320-c6e2c6273a97
@@ -9,6 +10,7 @@ require (
 	github.com/elazarl/goproxy v0.0.0-20191011121108-aa519ddbe484 // indirect
 	github.com/elazarl/goproxy/ext v0.0.0-20191011121108-aa519ddbe484 // indirect
 	github.com/golang/mock v1.6.0
+	github.com/google/go-containerregistry v0.4.0
 	github.com/google/subcommands v1.2.0
 	github.com/jarcoal/httpmock v1.0.8
 	github.com/onsi/ginkgo v1.15.0
@@ -1,6 +1,8 @@
 package integration_test
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"io/ioutil"
 	"os"
@@ -43,6 +45,48 @@ func testIntegration(t *testing.T, when spec.G, it spec.S) {
 		cutlass.DefaultStdoutStderr = ginkgo.GinkgoWriter
 	})
 
+	when("packaging reproducibly", func() {
+		var bpDir, outputDir string
+
+		it.Before(func() {
+			var err error
+			bpDir, err = filepath.Abs(filepath.Join("testdata", "shimmed_buildpack_reproducible"))
+			Expect(err).NotTo(HaveOccurred())
+
+			outputDir, err = ioutil.TempDir("", "reproducible")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		it.After(func() {
+			Expect(os.RemoveAll(outputDir)).To(Succeed())
+		})
+
+		it("creates byte-identical zips from the same local sources", func() {
+			checksum := func(run string) string {
+				output, err := runCNB2CF(bpDir, "package", "-stack", "cflinuxfs3", "-cached", "-reproducible", "-version", "1.0.0",
+					"-output", filepath.Join(outputDir, run), "-lockfile", filepath.Join(outputDir, run+".lock"))
+				Expect(err).NotTo(HaveOccurred(), output)
+
+				contents, err := ioutil.ReadFile(filepath.Join(outputDir, run, "hello_buildpack-cached-cflinuxfs3-v1.0.0.zip"))
+				Expect(err).NotTo(HaveOccurred())
+
+				sum := sha256.Sum256(contents)
+				return hex.EncodeToString(sum[:])
+			}
+
+			first := checksum("first")
+			// make sure that the second run gets different file times
+			time.Sleep(time.Second)
+			Expect(checksum("second")).To(Equal(first))
+
+			firstLock, err := ioutil.ReadFile(filepath.Join(outputDir, "first.lock"))
+			Expect(err).NotTo(HaveOccurred())
+			secondLock, err := ioutil.ReadFile(filepath.Join(outputDir, "second.lock"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(secondLock)).To(Equal(string(firstLock)))
+		})
+	})
+
 	when("successfully running the packaging command", func() {
 		var (
 			bpName, bpDir, shimmedBPFile, testDir string
@@ -128,6 +172,24 @@ func testIntegration(t *testing.T, when spec.G, it spec.S) {
 			Expect(app.GetBody("/")).To(Equal("Hello World!"))
 		})
 
+		it("creates a runnable v2 shimmed buildpack from released CNBs", func() {
+			output, err := runCNB2CF(bpDir, "package", "-stack", "cflinuxfs3", "-release", "-version", "1.0.0")
+			Expect(err).NotTo(HaveOccurred(), string(output))
+
+			shimmedBPFile = filepath.Join(bpDir, "nodejs_buildpack-cflinuxfs3-v1.0.0.zip")
+
+			fileContents, err := utils.GetFileContentsFromZip(shimmedBPFile, "manifest.yml")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(fileContents)).To(ContainSubstring("org.cloudfoundry.node-engine.tgz"))
+			Expect(string(fileContents)).To(ContainSubstring("sha256: 630e85979cec22e3e4662aa996ece2e7cbe704d1cc8eddcc6cf3209efa590336"))
+
+			Expect(cutlass.CreateOrUpdateBuildpack(bpName, shimmedBPFile, "cflinuxfs3")).To(Succeed())
+
+			Expect(app.Push()).To(Succeed())
+			Eventually(func() ([]string, error) { return app.InstanceStates() }, 20*time.Second).Should(Equal([]string{"RUNNING"}))
+			Expect(app.GetBody("/")).To(Equal("Hello World!"))
+		})
+
 		// TODO: needs to wait for the buildpack.toml from the nodejs-cnb to contain the sources
 		it.Pend("creates a runnable online v2 shimmed buildpack with local sources", func() {
 			Expect(cutlass.CreateOrUpdateBuildpack(bpName, shimmedBPFile, "cflinuxfs3")).To(Succeed())
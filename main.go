@@ -11,6 +11,11 @@ import (
 
 func main() {
 	subcommands.Register(&commands.Package{}, "")
+	subcommands.Register(&commands.Inspect{}, "")
+	subcommands.Register(&commands.Diff{}, "")
+	subcommands.Register(&commands.Validate{}, "")
+	subcommands.Register(&commands.Cache{}, "")
+	subcommands.Register(&commands.Update{}, "")
 	flag.Parse()
 	os.Exit(int(subcommands.Execute(context.Background())))
 }
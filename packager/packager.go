@@ -5,8 +5,8 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
-	"log"
 	"os"
+	"os/exec"
 	"os/user"
 	"path/filepath"
 	"strings"
@@ -14,10 +14,7 @@ import (
 	"github.com/cloudfoundry/cnb2cf/cloudnative"
 	"github.com/cloudfoundry/libbuildpack"
 	"github.com/cloudfoundry/libcfbuildpack/packager/cnbpackager"
-	"github.com/paketo-buildpacks/packit/cargo"
-	"github.com/paketo-buildpacks/packit/cargo/jam/commands"
 	"github.com/paketo-buildpacks/packit/pexec"
-	"github.com/paketo-buildpacks/packit/scribe"
 	"github.com/pkg/errors"
 
 	_ "github.com/cloudfoundry/cnb2cf/statik"
@@ -41,6 +38,27 @@ func ExtractCNBSource(dep cloudnative.BuildpackMetadataDependency, src, dstDir s
 	return libbuildpack.ExtractTarGz(src, dstDir)
 }
 
+const (
+	JamBuildTool         = "jam"
+	CNBPackagerBuildTool = "cnbpackager"
+)
+
+// BuildTool returns the tool that BuildCNB packages the CNB in extractDir
+// with: jam for packit buildpacks, which have a .packit file, and
+// cnbpackager for the rest.
+func BuildTool(extractDir string) (string, error) {
+	foundSrc, err := FindCNB(extractDir)
+	if err != nil {
+		return "", fmt.Errorf("unable to find CNB: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(foundSrc, ".packit")); err == nil {
+		return JamBuildTool, nil
+	}
+
+	return CNBPackagerBuildTool, nil
+}
+
 func BuildCNB(extractDir, outputDir string, cached bool, version string) (string, string, error) {
 	foundSrc, err := FindCNB(extractDir)
 	if err != nil {
@@ -58,7 +76,7 @@ func BuildCNB(extractDir, outputDir string, cached bool, version string) (string
 		// RUN packager
 		usr, err := user.Current()
 		if err != nil {
-			log.Fatal(err)
+			return "", "", fmt.Errorf("unable to determine current user: %s", err)
 		}
 
 		globalCacheDir := filepath.Join(usr.HomeDir, cnbpackager.DefaultCacheBase)
@@ -77,19 +95,12 @@ func BuildCNB(extractDir, outputDir string, cached bool, version string) (string
 		}
 	} else {
 		// RUN jam pack
-		logger := scribe.NewLogger(os.Stdout)
-		bash := pexec.NewExecutable("bash")
-
-		transport := cargo.NewTransport()
-		directoryDuplicator := cargo.NewDirectoryDuplicator()
-		buildpackParser := cargo.NewBuildpackParser()
-		fileBundler := cargo.NewFileBundler()
-		tarBuilder := cargo.NewTarBuilder(logger)
-		prePackager := cargo.NewPrePackager(bash, logger, scribe.NewWriter(os.Stdout, scribe.WithIndent(2)))
-		dependencyCacher := cargo.NewDependencyCacher(transport, logger)
-		command := commands.NewPack(directoryDuplicator, buildpackParser, prePackager, dependencyCacher, fileBundler, tarBuilder, os.Stdout)
+		if _, err := exec.LookPath(JamBuildTool); err != nil {
+			return "", "", fmt.Errorf("unable to build packit CNB %s: jam must be installed and on the PATH: %s", foundSrc, err)
+		}
 
 		args := []string{
+			"pack",
 			"--buildpack", filepath.Join(foundSrc, "buildpack.toml"),
 			"--output", path,
 			"--version", version,
@@ -99,22 +110,27 @@ func BuildCNB(extractDir, outputDir string, cached bool, version string) (string
 			args = append(args, "--offline")
 		}
 
-		err = command.Execute(args)
+		jam := pexec.NewExecutable(JamBuildTool)
+		err = jam.Execute(pexec.Execution{
+			Args:   args,
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+		})
 		if err != nil {
-			return "", "", err
+			return "", "", fmt.Errorf("failed to run jam pack: %s", err)
 		}
 	}
 
 	file, err := os.Open(path)
 	if err != nil {
-		panic(err)
+		return "", "", fmt.Errorf("unable to open built CNB: %s", err)
 	}
 	defer file.Close()
 
 	hash := sha256.New()
 	_, err = io.Copy(hash, file)
 	if err != nil {
-		panic(err)
+		return "", "", fmt.Errorf("unable to checksum built CNB: %s", err)
 	}
 
 	return path, hex.EncodeToString(hash.Sum(nil)), nil
@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"testing"
 
@@ -98,6 +99,10 @@ func testUnitPackager(t *testing.T, when spec.G, it spec.S) {
 	})
 	when("BuildCNB", func() {
 		it("returns buildpack tgz and sha", func() {
+			if _, err := exec.LookPath("jam"); err != nil {
+				t.Skip("jam is not on the PATH")
+			}
+
 			sourcePath := filepath.Join("testdata", "cnb-source", "packagable")
 			badFileName := filepath.Join(tmpDir, "paketo-buildpacks_node-engine")
 			tarPath, sha, err := packager.BuildCNB(sourcePath, badFileName, true, "1.2.3")
@@ -119,5 +124,24 @@ func testUnitPackager(t *testing.T, when spec.G, it spec.S) {
 			_, _, err := packager.BuildCNB(sourcePath, badFileName, true, "1.2.3")
 			Expect(err).To(MatchError(ContainSubstring("invalid outputDir")))
 		})
+
+		when("jam is not on the PATH", func() {
+			var path string
+
+			it.Before(func() {
+				path = os.Getenv("PATH")
+				Expect(os.Setenv("PATH", tmpDir)).To(Succeed())
+			})
+
+			it.After(func() {
+				Expect(os.Setenv("PATH", path)).To(Succeed())
+			})
+
+			it("says that jam is needed to build packit CNBs", func() {
+				sourcePath := filepath.Join("testdata", "cnb-source", "packagable")
+				_, _, err := packager.BuildCNB(sourcePath, filepath.Join(tmpDir, "node-engine"), true, "1.2.3")
+				Expect(err).To(MatchError(ContainSubstring("jam must be installed and on the PATH")))
+			})
+		})
 	})
 }
@@ -0,0 +1,189 @@
+package shims
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Masterminds/semver"
+)
+
+// LifecycleDescriptorFile is the lifecycle.toml that is bundled with the
+// lifecycle and lists the APIs it supports.
+const LifecycleDescriptorFile = "lifecycle.toml"
+
+// PlatformAPIEnv tells the lifecycle which platform API to speak.
+const PlatformAPIEnv = "CNB_PLATFORM_API"
+
+var (
+	// SupportedPlatformAPIs are the platform APIs the shims know the
+	// lifecycle flags for. The detector is given -analyzed from 0.10 and the
+	// builder from 0.12, the newest API, which the lifecycle phases need.
+	SupportedPlatformAPIs = []string{"0.1", "0.2", "0.3", "0.4", "0.5", "0.6", "0.7", "0.8", "0.9", "0.10", "0.11", "0.12"}
+
+	// SupportedBuildpackAPIs are the buildpack APIs the shims know the layer
+	// metadata format for.
+	SupportedBuildpackAPIs = []string{"0.2", "0.3", "0.4", "0.5", "0.6", "0.7", "0.8", "0.9", "0.10", "0.11"}
+)
+
+// LifecycleDescriptor is the contents of lifecycle.toml. Lifecycles before
+// 0.9 declare a single version of each API in [api], later ones list every
+// supported version in [apis].
+type LifecycleDescriptor struct {
+	API struct {
+		Platform  string `toml:"platform"`
+		Buildpack string `toml:"buildpack"`
+	} `toml:"api"`
+	APIs struct {
+		Platform  APIVersions `toml:"platform"`
+		Buildpack APIVersions `toml:"buildpack"`
+	} `toml:"apis"`
+	Lifecycle struct {
+		Version string `toml:"version"`
+	} `toml:"lifecycle"`
+}
+
+type APIVersions struct {
+	Deprecated []string `toml:"deprecated"`
+	Supported  []string `toml:"supported"`
+}
+
+// APIs are the platform and buildpack APIs agreed with the lifecycle. The
+// zero value stands for a lifecycle that did not say, which is spoken to as
+// lifecycle 0.7 and earlier were.
+type APIs struct {
+	Platform  string
+	Buildpack string
+}
+
+// ReadLifecycleDescriptor reads the lifecycle.toml installed alongside the
+// lifecycle binaries in dir. A lifecycle without one gives the zero value.
+func ReadLifecycleDescriptor(dir string) (LifecycleDescriptor, error) {
+	var descriptor LifecycleDescriptor
+	if _, err := toml.DecodeFile(filepath.Join(dir, LifecycleDescriptorFile), &descriptor); err != nil && !os.IsNotExist(err) {
+		return LifecycleDescriptor{}, fmt.Errorf("unable to decode %s: %s", LifecycleDescriptorFile, err)
+	}
+
+	return descriptor, nil
+}
+
+// Negotiate picks the newest platform and buildpack APIs supported by both
+// the lifecycle and the shims.
+func (d LifecycleDescriptor) Negotiate() (APIs, error) {
+	platform, err := newestCommonAPI("platform", d.platformAPIs(), SupportedPlatformAPIs)
+	if err != nil {
+		return APIs{}, err
+	}
+
+	buildpack, err := newestCommonAPI("buildpack", d.buildpackAPIs(), SupportedBuildpackAPIs)
+	if err != nil {
+		return APIs{}, err
+	}
+
+	return APIs{Platform: platform, Buildpack: buildpack}, nil
+}
+
+// NegotiateAPIs reads the lifecycle.toml in dir and negotiates the APIs to
+// use with that lifecycle.
+func NegotiateAPIs(dir string) (APIs, error) {
+	descriptor, err := ReadLifecycleDescriptor(dir)
+	if err != nil {
+		return APIs{}, err
+	}
+
+	return descriptor.Negotiate()
+}
+
+// PlatformAtLeast reports whether the negotiated platform API is version or
+// newer.
+func (a APIs) PlatformAtLeast(version string) bool {
+	return apiAtLeast(a.Platform, version)
+}
+
+// Env returns the environment that tells the lifecycle which platform API
+// to speak, if one was negotiated.
+func (a APIs) Env() []string {
+	if a.Platform == "" {
+		return nil
+	}
+
+	return []string{fmt.Sprintf("%s=%s", PlatformAPIEnv, a.Platform)}
+}
+
+func (d LifecycleDescriptor) platformAPIs() []string {
+	if len(d.APIs.Platform.Supported) > 0 {
+		return d.APIs.Platform.Supported
+	}
+
+	if d.API.Platform != "" {
+		return []string{d.API.Platform}
+	}
+
+	return nil
+}
+
+func (d LifecycleDescriptor) buildpackAPIs() []string {
+	if len(d.APIs.Buildpack.Supported) > 0 {
+		return d.APIs.Buildpack.Supported
+	}
+
+	if d.API.Buildpack != "" {
+		return []string{d.API.Buildpack}
+	}
+
+	return nil
+}
+
+func newestCommonAPI(kind string, lifecycle, shims []string) (string, error) {
+	if len(lifecycle) == 0 {
+		return "", nil
+	}
+
+	var newest string
+	for _, version := range lifecycle {
+		if !containsAPI(shims, version) {
+			continue
+		}
+
+		if newest == "" || !apiAtLeast(newest, version) {
+			newest = version
+		}
+	}
+
+	if newest == "" {
+		return "", fmt.Errorf("the lifecycle supports %s APIs %v but the shims only support %v", kind, lifecycle, shims)
+	}
+
+	return newest, nil
+}
+
+func containsAPI(versions []string, version string) bool {
+	for _, v := range versions {
+		if apiAtLeast(v, version) && apiAtLeast(version, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apiAtLeast reports whether api is version or newer. An empty api is
+// older than every version.
+func apiAtLeast(api, version string) bool {
+	if api == "" {
+		return false
+	}
+
+	a, err := semver.NewVersion(api)
+	if err != nil {
+		return false
+	}
+
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+
+	return !a.LessThan(v)
+}
@@ -0,0 +1,75 @@
+package shims_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/shims"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testAPI(t *testing.T, when spec.G, it spec.S) {
+	var Expect func(interface{}, ...interface{}) Assertion
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+	})
+
+	when("NegotiateAPIs", func() {
+		for version, expected := range map[string]shims.APIs{
+			"0.4.0":  {Platform: "0.1", Buildpack: "0.2"},
+			"0.7.5":  {Platform: "0.3", Buildpack: "0.2"},
+			"0.9.3":  {Platform: "0.4", Buildpack: "0.4"},
+			"0.20.0": {Platform: "0.12", Buildpack: "0.11"},
+		} {
+			version, expected := version, expected
+
+			it("picks the newest APIs that lifecycle "+version+" and the shims share", func() {
+				apis, err := shims.NegotiateAPIs(filepath.Join("testdata", "lifecycles", version))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(apis).To(Equal(expected))
+			})
+		}
+
+		it("speaks the oldest APIs to a lifecycle without a lifecycle.toml", func() {
+			apis, err := shims.NegotiateAPIs(filepath.Join("testdata", "lifecycles"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(apis).To(Equal(shims.APIs{}))
+			Expect(apis.Env()).To(BeEmpty())
+		})
+
+		it("speaks the newest platform and buildpack APIs the shims support to newer lifecycles", func() {
+			apis, err := shims.NegotiateAPIs(filepath.Join("testdata", "lifecycles", "0.20.0"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(apis.Platform).To(Equal(shims.SupportedPlatformAPIs[len(shims.SupportedPlatformAPIs)-1]))
+			Expect(apis.Platform).To(Equal(shims.RunLifecyclePhasesAPI))
+			Expect(apis.Buildpack).To(Equal(shims.SupportedBuildpackAPIs[len(shims.SupportedBuildpackAPIs)-1]))
+		})
+
+		it("fails when the lifecycle supports no platform API the shims know", func() {
+			dir, err := ioutil.TempDir("", "lifecycle")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			Expect(ioutil.WriteFile(filepath.Join(dir, "lifecycle.toml"), []byte(`[apis.platform]
+supported = ["0.13", "1.0"]`), 0644)).To(Succeed())
+
+			_, err = shims.NegotiateAPIs(dir)
+			Expect(err).To(MatchError(ContainSubstring("the lifecycle supports platform APIs [0.13 1.0]")))
+		})
+	})
+
+	when("APIs", func() {
+		it("compares platform API versions numerically", func() {
+			apis := shims.APIs{Platform: "0.10"}
+			Expect(apis.PlatformAtLeast("0.9")).To(BeTrue())
+			Expect(apis.PlatformAtLeast("0.10")).To(BeTrue())
+			Expect(apis.PlatformAtLeast("0.12")).To(BeFalse())
+			Expect(apis.Env()).To(Equal([]string{"CNB_PLATFORM_API=0.10"}))
+		})
+	})
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/cloudfoundry/cnb2cf/cloudnative"
 	"github.com/cloudfoundry/cnb2cf/shims"
+	"github.com/cloudfoundry/cnb2cf/signature"
 	"github.com/cloudfoundry/libbuildpack"
 	"github.com/paketo-buildpacks/packit/pexec"
 	"github.com/pkg/errors"
@@ -52,25 +53,42 @@ func detect(logger *libbuildpack.Logger) error {
 		return err
 	}
 
+	publicKey, _, err := signature.PublicKeyFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	// the CNBs are installed, and may run, from what the manifest lists
+	if err := shims.VerifyBuildpackManifest(v2BuildpackDir, publicKey); err != nil {
+		return errors.Wrap(err, "failed to verify manifest.yml")
+	}
+
 	manifest, err := libbuildpack.NewManifest(v2BuildpackDir, logger, time.Now())
 	if err != nil {
 		return err
 	}
 
+	platformEnv, err := shims.ReadPlatformEnv(filepath.Join(v2BuildpackDir, "buildpack.toml"))
+	if err != nil {
+		return errors.Wrap(err, "unable to read platform env configuration")
+	}
+
 	detectExecPath := filepath.Join(tempDir, shims.V3Detector)
 	executable := pexec.NewExecutable(detectExecPath)
 
 	detector := shims.Detector{
-		V3LifecycleDir:  tempDir,
-		AppDir:          v2AppDir,
-		V3BuildpacksDir: shims.V3BuildpacksDir,
-		V3PlatformDir:   shims.V3PlatformDir,
-		OrderMetadata:   filepath.Join(v2BuildpackDir, "buildpack.toml"),
-		GroupMetadata:   filepath.Join(shims.V3MetadataDir, "group.toml"),
-		PlanMetadata:    filepath.Join(shims.V3MetadataDir, "plan.toml"),
-		Installer:       shims.NewCNBInstaller(manifest, libbuildpack.NewInstaller(manifest)),
-		Environment:     cloudnative.NewEnvironment(),
-		Executor:        executable,
+		V3LifecycleDir:   tempDir,
+		AppDir:           v2AppDir,
+		V3BuildpacksDir:  shims.V3BuildpacksDir,
+		V3PlatformDir:    shims.V3PlatformDir,
+		OrderMetadata:    filepath.Join(v2BuildpackDir, "buildpack.toml"),
+		GroupMetadata:    filepath.Join(shims.V3MetadataDir, "group.toml"),
+		PlanMetadata:     filepath.Join(shims.V3MetadataDir, "plan.toml"),
+		AnalyzedMetadata: filepath.Join(shims.V3MetadataDir, "analyzed.toml"),
+		Installer:        shims.NewCNBInstaller(manifest, libbuildpack.NewInstaller(manifest)),
+		Environment:      cloudnative.NewEnvironment(),
+		Executor:         executable,
+		PlatformEnv:      platformEnv,
 	}
 
 	return detector.Detect()
@@ -33,13 +33,20 @@ type Detector struct {
 	V3BuildpacksDir string
 	V3PlatformDir   string
 
-	OrderMetadata string
-	GroupMetadata string
-	PlanMetadata  string
+	OrderMetadata    string
+	GroupMetadata    string
+	PlanMetadata     string
+	AnalyzedMetadata string
+
+	// Analyzed is set when the analyzer has written AnalyzedMetadata before
+	// detection, as platform API 0.7 and later order the phases. Otherwise an
+	// empty file stands in for it.
+	Analyzed bool
 
 	Installer   Installer
 	Environment Environment
 	Executor    Executable
+	PlatformEnv PlatformEnv
 }
 
 func (d Detector) Detect() error {
@@ -55,19 +62,30 @@ func (d Detector) RunLifecycleDetect() error {
 		return errors.Wrap(err, "failed to install v3 lifecycle binaries")
 	}
 
-	env := os.Environ()
+	apis, err := NegotiateAPIs(d.V3LifecycleDir)
+	if err != nil {
+		return errors.Wrap(err, "failed to negotiate lifecycle APIs")
+	}
 
 	vcapServices := d.Environment.Services()
-	env = append(env, fmt.Sprintf("CNB_SERVICES=%s", vcapServices))
-
 	stack := d.Environment.Stack()
-	env = append(env, fmt.Sprintf("CNB_STACK_ID=org.cloudfoundry.stacks.%s", stack))
+	platform := []string{
+		fmt.Sprintf("CNB_SERVICES=%s", vcapServices),
+		fmt.Sprintf("CNB_STACK_ID=org.cloudfoundry.stacks.%s", stack),
+	}
 
-	err := WritePlatformDir(d.V3PlatformDir, env)
+	platformEnv, err := d.PlatformEnv.Build(os.Environ(), platform...)
 	if err != nil {
 		return err
 	}
 
+	err = WritePlatformDir(d.V3PlatformDir, platformEnv)
+	if err != nil {
+		return err
+	}
+
+	env := append(append(os.Environ(), apis.Env()...), platform...)
+
 	logLevel := os.Getenv("LOG_LEVEL")
 
 	args := []string{
@@ -78,6 +96,14 @@ func (d Detector) RunLifecycleDetect() error {
 		"-plan", d.PlanMetadata,
 		"-platform", d.V3PlatformDir,
 	}
+	if apis.PlatformAtLeast("0.10") {
+		if !d.Analyzed {
+			if err := ensureFile(d.AnalyzedMetadata); err != nil {
+				return err
+			}
+		}
+		args = append(args, "-analyzed", d.AnalyzedMetadata)
+	}
 	if logLevel != "" {
 		args = append(args, "-log-level", logLevel)
 	}
@@ -19,18 +19,19 @@ func testDetector(t *testing.T, when spec.G, it spec.S) {
 	var (
 		Expect func(interface{}, ...interface{}) Assertion
 
-		detector        shims.Detector
-		installer       *fakes.Installer
-		environment     *fakes.Environment
-		fakeExecutable  *fakes.Executable
-		v3BuildpacksDir string
-		V3PlatformDir   string
-		v3AppDir        string
-		tempDir         string
-		v3LifecycleDir  string
-		groupMetadata   string
-		orderMetadata   string
-		planMetadata    string
+		detector         shims.Detector
+		installer        *fakes.Installer
+		environment      *fakes.Environment
+		fakeExecutable   *fakes.Executable
+		v3BuildpacksDir  string
+		V3PlatformDir    string
+		v3AppDir         string
+		tempDir          string
+		v3LifecycleDir   string
+		groupMetadata    string
+		orderMetadata    string
+		planMetadata     string
+		analyzedMetadata string
 	)
 
 	it.Before(func() {
@@ -48,6 +49,7 @@ func testDetector(t *testing.T, when spec.G, it spec.S) {
 		groupMetadata = filepath.Join(tempDir, "metadata", "group.toml")
 		orderMetadata = filepath.Join(tempDir, "metadata", "order.toml")
 		planMetadata = filepath.Join(tempDir, "metadata", "plan.toml")
+		analyzedMetadata = filepath.Join(tempDir, "metadata", "analyzed.toml")
 
 		v3BuildpacksDir = filepath.Join(tempDir, "buildpacks")
 		V3PlatformDir = filepath.Join(tempDir, "platform")
@@ -65,16 +67,17 @@ func testDetector(t *testing.T, when spec.G, it spec.S) {
 		fakeExecutable = &fakes.Executable{}
 
 		detector = shims.Detector{
-			AppDir:          v3AppDir,
-			V3BuildpacksDir: v3BuildpacksDir,
-			V3PlatformDir:   V3PlatformDir,
-			V3LifecycleDir:  v3LifecycleDir,
-			OrderMetadata:   orderMetadata,
-			GroupMetadata:   groupMetadata,
-			PlanMetadata:    planMetadata,
-			Installer:       installer,
-			Environment:     environment,
-			Executor:        fakeExecutable,
+			AppDir:           v3AppDir,
+			V3BuildpacksDir:  v3BuildpacksDir,
+			V3PlatformDir:    V3PlatformDir,
+			V3LifecycleDir:   v3LifecycleDir,
+			OrderMetadata:    orderMetadata,
+			GroupMetadata:    groupMetadata,
+			PlanMetadata:     planMetadata,
+			AnalyzedMetadata: analyzedMetadata,
+			Installer:        installer,
+			Environment:      environment,
+			Executor:         fakeExecutable,
 		}
 	})
 
@@ -149,6 +152,78 @@ func testDetector(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("the staging env holds Cloud Foundry's own variables", func() {
+		it.Before(func() {
+			Expect(os.Setenv("CF_INSTANCE_KEY", "some-key")).To(Succeed())
+			Expect(os.Setenv("SOME_USER_VAR", "some-value")).To(Succeed())
+			detector.PlatformEnv = shims.PlatformEnv{Actions: map[string]string{"SOME_USER_VAR": "override"}}
+		})
+
+		it.After(func() {
+			Expect(os.Unsetenv("CF_INSTANCE_KEY")).To(Succeed())
+			Expect(os.Unsetenv("SOME_USER_VAR")).To(Succeed())
+		})
+
+		it("writes only the user-provided env to the platform dir", func() {
+			Expect(detector.RunLifecycleDetect()).To(Succeed())
+
+			Expect(filepath.Join(V3PlatformDir, "env", "SOME_USER_VAR.override")).To(BeARegularFile())
+			Expect(filepath.Join(V3PlatformDir, "env", "CF_INSTANCE_KEY")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(V3PlatformDir, "env", "HOME")).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(V3PlatformDir, "env", "CNB_SERVICES")).To(BeARegularFile())
+		})
+	})
+
+	when("the lifecycle declares the APIs it supports", func() {
+		installLifecycle := func(version string) {
+			installer.InstallLifecycleCall.Stub = func(path string) error {
+				contents, err := ioutil.ReadFile(filepath.Join("testdata", "lifecycles", version, "lifecycle.toml"))
+				if err != nil {
+					return err
+				}
+				return ioutil.WriteFile(filepath.Join(path, "lifecycle.toml"), contents, 0644)
+			}
+		}
+
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Dir(analyzedMetadata), 0777)).To(Succeed())
+		})
+
+		it("speaks the negotiated platform API to lifecycle 0.7", func() {
+			installLifecycle("0.7.5")
+			Expect(detector.RunLifecycleDetect()).To(Succeed())
+
+			Expect(fakeExecutable.ExecuteCall.Receives.Execution.Env).To(ContainElement("CNB_PLATFORM_API=0.3"))
+			Expect(fakeExecutable.ExecuteCall.Receives.Execution.Args).NotTo(ContainElement("-analyzed"))
+		})
+
+		it("passes the analyzed metadata at platform API 0.12, the newest the shims support", func() {
+			installLifecycle("0.20.0")
+			Expect(detector.RunLifecycleDetect()).To(Succeed())
+
+			Expect(fakeExecutable.ExecuteCall.Receives.Execution.Env).To(ContainElement("CNB_PLATFORM_API=0.12"))
+			Expect(fakeExecutable.ExecuteCall.Receives.Execution.Args).To(Equal([]string{
+				"-app", v3AppDir,
+				"-buildpacks", v3BuildpacksDir,
+				"-order", orderMetadata,
+				"-group", groupMetadata,
+				"-plan", planMetadata,
+				"-platform", V3PlatformDir,
+				"-analyzed", analyzedMetadata,
+			}))
+			Expect(analyzedMetadata).To(BeAnExistingFile())
+		})
+
+		it("leaves the analyzed metadata to the analyzer when it has run", func() {
+			installLifecycle("0.20.0")
+			detector.Analyzed = true
+			Expect(detector.RunLifecycleDetect()).To(Succeed())
+
+			Expect(fakeExecutable.ExecuteCall.Receives.Execution.Args).To(ContainElement("-analyzed"))
+			Expect(analyzedMetadata).NotTo(BeAnExistingFile())
+		})
+	})
+
 	when("v3-detector errors out", func() {
 		it.Before(func() {
 			fakeExecutable.ExecuteCall.Returns.Err = errors.New("failed to run v3 lifecycle detect")
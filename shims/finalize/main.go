@@ -4,12 +4,15 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/cloudfoundry/cnb2cf/cloudnative"
 	"github.com/cloudfoundry/cnb2cf/shims"
+	"github.com/cloudfoundry/cnb2cf/signature"
 	"github.com/cloudfoundry/libbuildpack"
 	"github.com/paketo-buildpacks/packit/pexec"
+	"github.com/pkg/errors"
 )
 
 func main() {
@@ -60,11 +63,26 @@ func finalize(logger *libbuildpack.Logger) error {
 		return err
 	}
 
+	publicKey, _, err := signature.PublicKeyFromEnvironment()
+	if err != nil {
+		return err
+	}
+
+	// the CNBs are installed, and may run, from what the manifest lists
+	if err := shims.VerifyBuildpackManifest(buildpackDir, publicKey); err != nil {
+		return errors.Wrap(err, "failed to verify manifest.yml")
+	}
+
 	manifest, err := libbuildpack.NewManifest(buildpackDir, logger, time.Now())
 	if err != nil {
 		return err
 	}
 
+	platformEnv, err := shims.ReadPlatformEnv(filepath.Join(buildpackDir, "buildpack.toml"))
+	if err != nil {
+		return errors.Wrap(err, "unable to read platform env configuration")
+	}
+
 	installer := shims.NewCNBInstaller(manifest, libbuildpack.NewInstaller(manifest))
 
 	detectExecPath := filepath.Join(tempDir, shims.V3Detector)
@@ -73,39 +91,52 @@ func finalize(logger *libbuildpack.Logger) error {
 	finalizeExecPath := filepath.Join(tempDir, shims.V3Builder)
 	finalizeExecutable := pexec.NewExecutable(finalizeExecPath)
 
+	lifecyclePhases, _ := strconv.ParseBool(os.Getenv(shims.LifecyclePhasesEnv))
+
 	finalizer := shims.Finalizer{
-		V2AppDir:        v2AppDir,
-		V3AppDir:        shims.V3AppDir,
-		V2DepsDir:       v2DepsDir,
-		V2CacheDir:      v2CacheDir,
-		V3LayersDir:     shims.V3LayersDir,
-		V3BuildpacksDir: shims.V3BuildpacksDir,
-		V3PlatformDir:   shims.V3PlatformDir,
-		DepsIndex:       v2DepsIndex,
-		OrderDir:        shims.V3StoredOrderDir,
-		OrderMetadata:   filepath.Join(shims.V3MetadataDir, "order.toml"),
-		GroupMetadata:   filepath.Join(shims.V3MetadataDir, "group.toml"),
-		PlanMetadata:    filepath.Join(shims.V3MetadataDir, "plan.toml"),
-		V3LifecycleDir:  tempDir,
-		V3LauncherDir:   filepath.Join(shims.V3AppDir, ".cloudfoundry"), // We need to put the launcher binary somewhere in the droplet so it can run at launch. Can we put this here? If it is in depsDir/launcher could overlap with a v3 buildpack called "launcher"
-		ProfileDir:      profileDir,
+		V2AppDir:         v2AppDir,
+		V3AppDir:         shims.V3AppDir,
+		V2DepsDir:        v2DepsDir,
+		V2CacheDir:       v2CacheDir,
+		V3LayersDir:      shims.V3LayersDir,
+		V3BuildpacksDir:  shims.V3BuildpacksDir,
+		V3PlatformDir:    shims.V3PlatformDir,
+		DepsIndex:        v2DepsIndex,
+		OrderDir:         shims.V3StoredOrderDir,
+		OrderMetadata:    filepath.Join(shims.V3MetadataDir, "order.toml"),
+		GroupMetadata:    filepath.Join(shims.V3MetadataDir, "group.toml"),
+		PlanMetadata:     filepath.Join(shims.V3MetadataDir, "plan.toml"),
+		AnalyzedMetadata: filepath.Join(shims.V3MetadataDir, "analyzed.toml"),
+		V3LifecycleDir:   tempDir,
+		V3LauncherDir:    filepath.Join(shims.V3AppDir, ".cloudfoundry"), // We need to put the launcher binary somewhere in the droplet so it can run at launch. Can we put this here? If it is in depsDir/launcher could overlap with a v3 buildpack called "launcher"
+		ProfileDir:       profileDir,
 		Detector: shims.Detector{
-			AppDir:          shims.V3AppDir,
-			V3LifecycleDir:  tempDir,
-			V3BuildpacksDir: shims.V3BuildpacksDir,
-			V3PlatformDir:   shims.V3PlatformDir,
-			OrderMetadata:   filepath.Join(shims.V3MetadataDir, "order.toml"),
-			GroupMetadata:   filepath.Join(shims.V3MetadataDir, "group.toml"),
-			PlanMetadata:    filepath.Join(shims.V3MetadataDir, "plan.toml"),
-			Installer:       installer,
-			Environment:     cloudnative.NewEnvironment(),
-			Executor:        detectExecutable,
+			AppDir:           shims.V3AppDir,
+			V3LifecycleDir:   tempDir,
+			V3BuildpacksDir:  shims.V3BuildpacksDir,
+			V3PlatformDir:    shims.V3PlatformDir,
+			OrderMetadata:    filepath.Join(shims.V3MetadataDir, "order.toml"),
+			GroupMetadata:    filepath.Join(shims.V3MetadataDir, "group.toml"),
+			PlanMetadata:     filepath.Join(shims.V3MetadataDir, "plan.toml"),
+			AnalyzedMetadata: filepath.Join(shims.V3MetadataDir, "analyzed.toml"),
+			Analyzed:         lifecyclePhases,
+			Installer:        installer,
+			Environment:      cloudnative.NewEnvironment(),
+			Executor:         detectExecutable,
+			PlatformEnv:      platformEnv,
 		},
 		Installer:   installer,
 		Manifest:    manifest,
 		Logger:      logger,
 		Executable:  finalizeExecutable,
 		Environment: cloudnative.NewEnvironment(),
+		PlatformEnv: platformEnv,
+
+		LifecyclePhases: lifecyclePhases,
+		V3LayoutDir:     filepath.Join(tempDir, "layout"),
+		Analyzer:        pexec.NewExecutable(filepath.Join(tempDir, shims.V3Analyzer)),
+		Restorer:        pexec.NewExecutable(filepath.Join(tempDir, shims.V3Restorer)),
+		Exporter:        pexec.NewExecutable(filepath.Join(tempDir, shims.V3Exporter)),
 	}
 
 	return finalizer.Finalize()
@@ -24,8 +24,12 @@ var (
 	V3Detector        = "detector"
 	V3Builder         = "builder"
 	V3Launcher        = "launcher"
+	V3Analyzer        = "analyzer"
+	V3Restorer        = "restorer"
+	V3Exporter        = "exporter"
 	V3LifecycleBinary = "lifecycle"
 	V3LaunchScript    = "0_shim.sh"
+	V3ProcessDir      = "process"
 	V3AppDir          = filepath.Join(string(filepath.Separator), "home", "vcap", "app")
 	V3LayersDir       = filepath.Join(string(filepath.Separator), "home", "vcap", "deps")
 	V3MetadataDir     = filepath.Join(string(filepath.Separator), "home", "vcap", "metadata")
@@ -34,6 +38,11 @@ var (
 	V3PlatformDir     = filepath.Join(string(filepath.Separator), "home", "vcap", "platform")
 )
 
+// ProcessLinksAPI is the platform API from which the launcher runs a single
+// argument as a command, and takes the process type to run from the name it
+// was run by instead.
+const ProcessLinksAPI = "0.4"
+
 type LifecycleDetectRunner interface {
 	RunLifecycleDetect() error
 }
@@ -44,28 +53,49 @@ type LayerMetadata struct {
 	Cache  bool `toml:"cache"`
 }
 
+// typedLayerMetadata is the layer metadata of buildpack API 0.6 and later,
+// which keeps the layer types in a table of their own.
+type typedLayerMetadata struct {
+	Types LayerMetadata `toml:"types"`
+}
+
 type Finalizer struct {
-	V2AppDir        string
-	V3AppDir        string
-	V2DepsDir       string
-	V2CacheDir      string
-	V3LayersDir     string
-	V3BuildpacksDir string
-	V3PlatformDir   string
-	DepsIndex       string
-	OrderDir        string
-	OrderMetadata   string
-	GroupMetadata   string
-	PlanMetadata    string
-	V3LifecycleDir  string
-	V3LauncherDir   string
-	ProfileDir      string
-	Detector        LifecycleDetectRunner
-	Installer       Installer
-	Manifest        *libbuildpack.Manifest
-	Logger          *libbuildpack.Logger
-	Executable      Executable
-	Environment     Environment
+	V2AppDir         string
+	V3AppDir         string
+	V2DepsDir        string
+	V2CacheDir       string
+	V3LayersDir      string
+	V3BuildpacksDir  string
+	V3PlatformDir    string
+	DepsIndex        string
+	OrderDir         string
+	OrderMetadata    string
+	GroupMetadata    string
+	PlanMetadata     string
+	AnalyzedMetadata string
+	V3LifecycleDir   string
+	V3LauncherDir    string
+	ProfileDir       string
+	Detector         LifecycleDetectRunner
+	Installer        Installer
+	Manifest         *libbuildpack.Manifest
+	Logger           *libbuildpack.Logger
+	Executable       Executable
+	Environment      Environment
+	PlatformEnv      PlatformEnv
+
+	// APIs are negotiated with the lifecycle once it is installed.
+	APIs APIs
+
+	// LifecyclePhases runs the analyzer before the detector, and the
+	// restorer and exporter around the builder, which then keep the cache in
+	// place of the shims. The app
+	// image is exported to the scratch OCI layout in V3LayoutDir.
+	LifecyclePhases bool
+	V3LayoutDir     string
+	Analyzer        Executable
+	Restorer        Executable
+	Exporter        Executable
 }
 
 func (f *Finalizer) Finalize() error {
@@ -77,30 +107,66 @@ func (f *Finalizer) Finalize() error {
 		return errors.Wrap(err, "failed to generate order metadata")
 	}
 
-	if err := f.RunV3Detect(); err != nil {
-		return errors.Wrap(err, "failed to run V3 detect")
-	}
-
-	if err := f.IncludePreviousV2Buildpacks(); err != nil {
-		return errors.Wrap(err, "failed to include previous v2 buildpacks")
+	if !f.LifecyclePhases {
+		if err := f.RunV3Detect(); err != nil {
+			return errors.Wrap(err, "failed to run V3 detect")
+		}
 	}
 
 	if err := f.Installer.InstallLifecycle(f.V3LifecycleDir); err != nil {
 		return errors.Wrap(err, "failed to install "+V3Builder)
 	}
 
-	if err := f.RestoreV3Cache(); err != nil {
-		return errors.Wrap(err, "failed to restore v3 cache")
+	apis, err := NegotiateAPIs(f.V3LifecycleDir)
+	if err != nil {
+		return errors.Wrap(err, "failed to negotiate lifecycle APIs")
+	}
+	f.APIs = apis
+
+	if f.LifecyclePhases {
+		if err := f.RunLifecycleAnalyze(); err != nil {
+			return errors.Wrap(err, "failed to run v3 lifecycle analyzer")
+		}
+
+		// the detector reads what the analyzer found, so detection runs
+		// again here even when supply has already detected a group
+		if err := f.Detector.RunLifecycleDetect(); err != nil {
+			return errors.Wrap(err, "failed to run V3 detect")
+		}
+
+		if err := f.RunLifecycleRestore(); err != nil {
+			return errors.Wrap(err, "failed to run v3 lifecycle restorer")
+		}
+	}
+
+	if err := f.IncludePreviousV2Buildpacks(); err != nil {
+		return errors.Wrap(err, "failed to include previous v2 buildpacks")
+	}
+
+	if !f.LifecyclePhases {
+		if err := f.RestoreV3Cache(); err != nil {
+			return errors.Wrap(err, "failed to restore v3 cache")
+		}
 	}
 
 	if err := f.RunLifecycleBuild(); err != nil {
 		return errors.Wrap(err, "failed to run v3 lifecycle builder")
 	}
 
+	if f.LifecyclePhases {
+		if err := f.RunLifecycleExport(); err != nil {
+			return errors.Wrap(err, "failed to run v3 lifecycle exporter")
+		}
+	}
+
 	if err := os.Rename(filepath.Join(f.V3LifecycleDir, V3Launcher), filepath.Join(f.V3LauncherDir, V3Launcher)); err != nil {
 		return errors.Wrap(err, "failed to move launcher")
 	}
 
+	if err := f.WriteProcessLinks(); err != nil {
+		return errors.Wrap(err, "failed to link process types to the launcher")
+	}
+
 	if err := os.Rename(f.V3AppDir, f.V2AppDir); err != nil {
 		return errors.Wrap(err, "failed to move app")
 	}
@@ -243,31 +309,33 @@ func (f *Finalizer) RestoreV3Cache() error {
 }
 
 func (f *Finalizer) RunLifecycleBuild() error {
-	env := os.Environ()
-
-	stack := f.Environment.Stack()
-	env = append(env, fmt.Sprintf("CNB_STACK_ID=org.cloudfoundry.stacks.%s", stack))
-
-	services := f.Environment.Services()
-	env = append(env, fmt.Sprintf("CNB_SERVICES=%s", services))
-
-	err := WritePlatformDir(f.V3PlatformDir, env)
+	env, err := f.lifecycleEnv()
 	if err != nil {
 		return err
 	}
 
+	args := []string{
+		"-app", f.V3AppDir,
+		"-buildpacks", f.V3BuildpacksDir,
+		"-group", f.GroupMetadata,
+		"-layers", f.V3LayersDir,
+		"-plan", f.PlanMetadata,
+		"-platform", f.V3PlatformDir,
+	}
+	if f.APIs.PlatformAtLeast("0.12") {
+		if !f.LifecyclePhases {
+			if err := ensureFile(f.AnalyzedMetadata); err != nil {
+				return err
+			}
+		}
+		args = append(args, "-analyzed", f.AnalyzedMetadata)
+	}
+
 	err = f.Executable.Execute(pexec.Execution{
 		Stdout: os.Stdout,
 		Stderr: os.Stderr,
 		Env:    env,
-		Args: []string{
-			"-app", f.V3AppDir,
-			"-buildpacks", f.V3BuildpacksDir,
-			"-group", f.GroupMetadata,
-			"-layers", f.V3LayersDir,
-			"-plan", f.PlanMetadata,
-			"-platform", f.V3PlatformDir,
-		},
+		Args:   args,
 	})
 	if err != nil {
 		return err
@@ -276,6 +344,28 @@ func (f *Finalizer) RunLifecycleBuild() error {
 	return nil
 }
 
+// lifecycleEnv returns the environment of a lifecycle phase, having written
+// the platform env that the CNBs see to the platform dir.
+func (f *Finalizer) lifecycleEnv() ([]string, error) {
+	stack := f.Environment.Stack()
+	services := f.Environment.Services()
+	platform := []string{
+		fmt.Sprintf("CNB_STACK_ID=org.cloudfoundry.stacks.%s", stack),
+		fmt.Sprintf("CNB_SERVICES=%s", services),
+	}
+
+	platformEnv, err := f.PlatformEnv.Build(os.Environ(), platform...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := WritePlatformDir(f.V3PlatformDir, platformEnv); err != nil {
+		return nil, err
+	}
+
+	return append(append(os.Environ(), f.APIs.Env()...), platform...), nil
+}
+
 func (f *Finalizer) MoveV2Layers(src, dst string) error {
 	if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
 		return err
@@ -284,17 +374,53 @@ func (f *Finalizer) MoveV2Layers(src, dst string) error {
 	return os.Rename(src, dst)
 }
 
+// WriteLayerMetadata writes the metadata of a layer of a v2 buildpack in the
+// format of the negotiated buildpack API, which its fake CNB declares.
 func (f *Finalizer) WriteLayerMetadata(path string) error {
 	contents := LayerMetadata{true, true, false}
+	if apiAtLeast(f.APIs.Buildpack, "0.6") {
+		return encodeTOML(path+".toml", typedLayerMetadata{Types: contents})
+	}
 	return encodeTOML(path+".toml", contents)
 }
 
+// ReadLayerMetadata reads layer metadata in the format of the API of the CNB
+// that wrote it. When that CNB is not installed the format is told apart by
+// the presence of a [types] table.
 func (f *Finalizer) ReadLayerMetadata(path string) (LayerMetadata, error) {
-	contents := LayerMetadata{}
-	if _, err := toml.DecodeFile(path, &contents); err != nil {
+	var contents struct {
+		LayerMetadata
+		typedLayerMetadata
+	}
+	md, err := toml.DecodeFile(path, &contents)
+	if err != nil {
+		return LayerMetadata{}, err
+	}
+
+	api, err := f.buildpackAPI(filepath.Base(filepath.Dir(path)))
+	if err != nil {
 		return LayerMetadata{}, err
 	}
-	return contents, nil
+
+	if apiAtLeast(api, "0.6") || (api == "" && md.IsDefined("types")) {
+		return contents.Types, nil
+	}
+	return contents.LayerMetadata, nil
+}
+
+// buildpackAPI returns the API declared by the installed CNB whose layers
+// are in the named directory, or "" when there is no such CNB.
+func (f *Finalizer) buildpackAPI(layersName string) (string, error) {
+	paths, err := filepath.Glob(filepath.Join(f.V3BuildpacksDir, layersName, "*", "buildpack.toml"))
+	if err != nil || len(paths) == 0 {
+		return "", err
+	}
+
+	buildpack, err := ParseBuildpackTOML(paths[0])
+	if err != nil {
+		return "", err
+	}
+	return buildpack.API, nil
 }
 
 func (f *Finalizer) RenameEnvDir(dst string) error {
@@ -333,9 +459,11 @@ func (f *Finalizer) AddFakeCNBBuildpack(buildpackID string) error {
 	defer buildpackMetadataFile.Close()
 
 	if err = encodeTOML(filepath.Join(buildpackPath, "buildpack.toml"), struct {
+		API       string          `toml:"api,omitempty"`
 		Buildpack buildpack2.Info `toml:"buildpack"`
 		Stacks    []stack         `toml:"stacks"`
 	}{
+		API: f.APIs.Buildpack,
 		Buildpack: buildpack2.Info{
 			ID:      buildpackID,
 			Name:    buildpackID,
@@ -355,7 +483,55 @@ func (f *Finalizer) AddFakeCNBBuildpack(buildpackID string) error {
 	return ioutil.WriteFile(filepath.Join(buildpackPath, "bin", "build"), []byte(`#!/bin/bash`), 0777)
 }
 
+// WriteProcessLinks links each process type of the launch metadata to the
+// launcher, in V3ProcessDir next to it, for the launchers of platform API
+// ProcessLinksAPI and later to run the process type they are named for.
+func (f *Finalizer) WriteProcessLinks() error {
+	if f.APIs.Platform == "" || !f.APIs.PlatformAtLeast(ProcessLinksAPI) {
+		return nil
+	}
+
+	var metadata inputMetadata
+	if _, err := toml.DecodeFile(filepath.Join(f.V3LayersDir, "config", "metadata.toml"), &metadata); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	processDir := filepath.Join(f.V3LauncherDir, V3ProcessDir)
+	if err := os.MkdirAll(processDir, 0777); err != nil {
+		return err
+	}
+
+	for _, process := range metadata.Processes {
+		if err := os.Symlink(filepath.Join("..", V3Launcher), filepath.Join(processDir, process.Type)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteProfileLaunch writes a profile script that hands the start command,
+// $2 of the Cloud Foundry launcher, to the CNB launcher. A process type is
+// run as the CNBs defined it, direct or through a shell and with its args,
+// and any other command is run through a shell, as the launcher in an image
+// built by pack would. Before platform API ProcessLinksAPI the launcher is
+// given the process type as its only argument; from then on it is run by
+// the process type's link from WriteProcessLinks. Without a start command
+// the launcher runs its default process. The launcher is told the platform
+// API that the builder wrote the launch metadata with.
 func (f *Finalizer) WriteProfileLaunch() error {
+	var platformAPI, processType string
+	if f.APIs.Platform != "" {
+		platformAPI = fmt.Sprintf("export %s=%q\n", PlatformAPIEnv, f.APIs.Platform)
+
+		if f.APIs.PlatformAtLeast(ProcessLinksAPI) {
+			processType = fmt.Sprintf(`if [ -L "$HOME/.cloudfoundry/%[1]s/$2" ]; then
+  exec "$HOME/.cloudfoundry/%[1]s/$2"
+fi
+`, V3ProcessDir)
+		}
+	}
+
 	profileContents := fmt.Sprintf(
 		`export CNB_STACK_ID="org.cloudfoundry.stacks.%s"
 export CNB_LAYERS_DIR="$DEPS_DIR"
@@ -363,9 +539,12 @@ export CNB_APP_DIR="$HOME"
 export CNB_SERVICES="$VCAP_SERVICES"
 export CNB_INSTANCE_INDEX="$CF_INSTANCE_INDEX"
 export CNB_APP_NAME="$(echo "$VCAP_APPLICATION" | jq -r .application_name)"
-exec $HOME/.cloudfoundry/%s "$2"
+%[3]sif [ -z "$2" ]; then
+  exec "$HOME/.cloudfoundry/%[2]s"
+fi
+%[4]sexec "$HOME/.cloudfoundry/%[2]s" "$2"
 `,
-		os.Getenv("CF_STACK"), V3Launcher)
+		os.Getenv("CF_STACK"), V3Launcher, platformAPI, processType)
 
 	return ioutil.WriteFile(filepath.Join(f.ProfileDir, V3LaunchScript), []byte(profileContents), 0666)
 }
@@ -408,7 +587,7 @@ func (f *Finalizer) moveV3Layer(v3LayersPath string) error {
 		layerPath := tomlFile[:len(tomlFile)-tomlSize]
 		layerName := filepath.Base(layerPath)
 
-		if decodedToml.Cache {
+		if decodedToml.Cache && !f.LifecyclePhases {
 			if err := f.cacheLayer(layerPath, layersName, layerName); err != nil {
 				return err
 			}
@@ -7,13 +7,21 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/cloudfoundry/cnb2cf/shims"
 	"github.com/cloudfoundry/cnb2cf/shims/fakes"
 	"github.com/cloudfoundry/libbuildpack"
 
 	"github.com/golang/mock/gomock"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/paketo-buildpacks/packit/pexec"
 	"github.com/sclevine/spec"
 
 	. "github.com/onsi/gomega"
@@ -169,6 +177,28 @@ func testFinalizer(t *testing.T, when spec.G, it spec.S) {
 			Expect(contents).To(ContainSubstring("org.cloudfoundry.stacks.some-stack"))
 		})
 
+		when("the lifecycle speaks platform API 0.12", func() {
+			it.Before(func() {
+				finalizer.APIs = shims.APIs{Platform: "0.12", Buildpack: "0.11"}
+				finalizer.AnalyzedMetadata = filepath.Join(tempDir, "analyzed.toml")
+			})
+
+			it("passes the platform API and analyzed metadata", func() {
+				Expect(finalizer.RunLifecycleBuild()).To(Succeed())
+
+				Expect(fakeExecutable.ExecuteCall.Receives.Execution.Args).To(Equal([]string{
+					"-app", v3AppDir,
+					"-buildpacks", v3BuildpacksDir,
+					"-group", groupMetadata,
+					"-layers", v3LayersDir,
+					"-plan", planMetadata,
+					"-platform", V3PlatformDir,
+					"-analyzed", filepath.Join(tempDir, "analyzed.toml"),
+				}))
+				Expect(fakeExecutable.ExecuteCall.Receives.Execution.Env).To(ContainElement("CNB_PLATFORM_API=0.12"))
+			})
+		})
+
 		when("the lifecycle build binary fails", func() {
 			it.Before(func() {
 				fakeExecutable.ExecuteCall.Returns.Err = errors.New("lifecycle build phase failed")
@@ -181,6 +211,224 @@ func testFinalizer(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("running the lifecycle phases", func() {
+		var (
+			analyzer, restorer, exporter       *fakes.Executable
+			analyzedMetadata, owner, layoutDir string
+		)
+
+		// readImage reads the only image of the OCI layout at path
+		readImage := func(path string) v1.Image {
+			index, err := layout.ImageIndexFromPath(path)
+			Expect(err).NotTo(HaveOccurred())
+			manifest, err := index.IndexManifest()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manifest.Manifests).To(HaveLen(1))
+
+			image, err := index.Image(manifest.Manifests[0].Digest)
+			Expect(err).NotTo(HaveOccurred())
+			return image
+		}
+
+		it.Before(func() {
+			fakeEnvironment.StackCall.Returns.String = "some-stack"
+
+			analyzer = &fakes.Executable{}
+			restorer = &fakes.Executable{}
+			exporter = &fakes.Executable{}
+			analyzedMetadata = filepath.Join(tempDir, "analyzed.toml")
+			owner = fmt.Sprintf("-uid %d -gid %d", os.Getuid(), os.Getgid())
+			layoutDir = filepath.Join(tempDir, "layout")
+
+			// the exporter writes an app image with a layer to the layout
+			exporter.ExecuteCall.Stub = func(pexec.Execution) error {
+				image, err := random.Image(1024, 1)
+				if err != nil {
+					return err
+				}
+
+				image, err = mutate.Config(image, v1.Config{Labels: map[string]string{"io.buildpacks.lifecycle.metadata": `{"buildpacks":[]}`}})
+				if err != nil {
+					return err
+				}
+
+				path, err := shims.LayoutPath(layoutDir, "cnb2cf/app:latest")
+				if err != nil {
+					return err
+				}
+
+				index, err := layout.Write(path, empty.Index)
+				if err != nil {
+					return err
+				}
+
+				return index.AppendImage(image)
+			}
+
+			finalizer.LifecyclePhases = true
+			finalizer.APIs = shims.APIs{Platform: "0.12", Buildpack: "0.9"}
+			finalizer.AnalyzedMetadata = analyzedMetadata
+			finalizer.Analyzer = analyzer
+			finalizer.Restorer = restorer
+			finalizer.Exporter = exporter
+			finalizer.V3LayoutDir = layoutDir
+		})
+
+		it("analyzes against a scratch run image in the layout", func() {
+			Expect(finalizer.RunLifecycleAnalyze()).To(Succeed())
+
+			Expect(strings.Join(analyzer.ExecuteCall.Receives.Execution.Args, " ")).To(Equal(owner +
+				" -analyzed " + analyzedMetadata +
+				" -layers " + v3LayersDir +
+				" -run-image cnb2cf/run:some-stack cnb2cf/app:latest"))
+			Expect(analyzer.ExecuteCall.Receives.Execution.Env).To(ContainElement("CNB_USE_LAYOUT=true"))
+			Expect(analyzer.ExecuteCall.Receives.Execution.Env).To(ContainElement("CNB_LAYOUT_DIR=" + layoutDir))
+			Expect(analyzer.ExecuteCall.Receives.Execution.Env).To(ContainElement("CNB_PLATFORM_API=0.12"))
+
+			config, err := readImage(filepath.Join(layoutDir, "index.docker.io", "cnb2cf", "run", "some-stack")).ConfigFile()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Config.Labels).To(HaveKeyWithValue("io.buildpacks.stack.id", "org.cloudfoundry.stacks.some-stack"))
+			Expect(filepath.Join(layoutDir, "index.docker.io", "cnb2cf", "app")).NotTo(BeAnExistingFile())
+		})
+
+		it("needs a lifecycle that speaks platform API 0.12", func() {
+			finalizer.APIs = shims.APIs{Platform: "0.3", Buildpack: "0.2"}
+
+			Expect(finalizer.RunLifecycleAnalyze()).To(MatchError(ContainSubstring("needs a lifecycle that supports platform API 0.12 or later")))
+			Expect(analyzer.ExecuteCall.CallCount).To(Equal(0))
+		})
+
+		it("restores from and exports to the directory cache", func() {
+			Expect(finalizer.RunLifecycleRestore()).To(Succeed())
+			Expect(strings.Join(restorer.ExecuteCall.Receives.Execution.Args, " ")).To(Equal(owner +
+				" -analyzed " + analyzedMetadata +
+				" -cache-dir " + filepath.Join(v2CacheDir, "cnb-cache") +
+				" -group " + groupMetadata +
+				" -layers " + v3LayersDir))
+
+			Expect(finalizer.RunLifecycleExport()).To(Succeed())
+			Expect(strings.Join(exporter.ExecuteCall.Receives.Execution.Args, " ")).To(Equal(owner +
+				" -analyzed " + analyzedMetadata +
+				" -app " + v3AppDir +
+				" -cache-dir " + filepath.Join(v2CacheDir, "cnb-cache") +
+				" -group " + groupMetadata +
+				" -launcher " + filepath.Join(binDir, "launcher") +
+				" -layers " + v3LayersDir +
+				" -report " + filepath.Join(tempDir, "report.toml") +
+				" cnb2cf/app:latest"))
+		})
+
+		it("keeps only the labels of the app image in the cache, for the next analyzer", func() {
+			Expect(finalizer.RunLifecycleExport()).To(Succeed())
+
+			previous := readImage(filepath.Join(v2CacheDir, "cnb-previous-image"))
+			config, err := previous.ConfigFile()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Config.Labels).To(HaveKeyWithValue("io.buildpacks.lifecycle.metadata", `{"buildpacks":[]}`))
+			layers, err := previous.Layers()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(layers).To(BeEmpty())
+
+			Expect(os.RemoveAll(layoutDir)).To(Succeed())
+			Expect(finalizer.RunLifecycleAnalyze()).To(Succeed())
+
+			analyzed := readImage(filepath.Join(layoutDir, "index.docker.io", "cnb2cf", "app", "latest"))
+			Expect(analyzed.ConfigFile()).To(Equal(config))
+		})
+
+		when("finalizing", func() {
+			var phases []string
+
+			it.Before(func() {
+				manifest, err := libbuildpack.NewManifest(filepath.Join("testdata", "buildpack"), finalizeLogger, time.Now())
+				Expect(err).NotTo(HaveOccurred())
+				finalizer.Manifest = manifest
+
+				installer := &fakes.Installer{}
+				installer.InstallLifecycleCall.Stub = func(path string) error {
+					contents, err := ioutil.ReadFile(filepath.Join("testdata", "lifecycles", "0.20.0", "lifecycle.toml"))
+					if err != nil {
+						return err
+					}
+
+					if err := ioutil.WriteFile(filepath.Join(path, "lifecycle.toml"), contents, 0644); err != nil {
+						return err
+					}
+
+					return ioutil.WriteFile(filepath.Join(path, "launcher"), []byte("some-launcher"), 0755)
+				}
+				finalizer.Installer = installer
+				finalizer.APIs = shims.APIs{}
+
+				// supply has already detected a group and plan, which detection after the analyzer replaces
+				Expect(ioutil.WriteFile(groupMetadata, []byte(""), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(planMetadata, []byte(""), 0644)).To(Succeed())
+				Expect(os.MkdirAll(v2CacheDir, 0777)).To(Succeed())
+
+				phases = nil
+				record := func(name string, stub func(pexec.Execution) error) func(pexec.Execution) error {
+					return func(execution pexec.Execution) error {
+						phases = append(phases, name)
+						if stub != nil {
+							return stub(execution)
+						}
+						return nil
+					}
+				}
+				analyzer.ExecuteCall.Stub = record("analyzer", func(pexec.Execution) error {
+					return ioutil.WriteFile(analyzedMetadata, []byte("[run-image]\n  reference = \"cnb2cf/run:some-stack\"\n"), 0644)
+				})
+				mockDetector.
+					EXPECT().
+					RunLifecycleDetect().
+					DoAndReturn(func() error {
+						phases = append(phases, "detector")
+						return nil
+					})
+				restorer.ExecuteCall.Stub = record("restorer", nil)
+				fakeExecutable.ExecuteCall.Stub = record("builder", func(pexec.Execution) error {
+					if err := os.MkdirAll(filepath.Join(v3LayersDir, "config"), 0777); err != nil {
+						return err
+					}
+					return ioutil.WriteFile(filepath.Join(v3LayersDir, "config", "metadata.toml"), []byte("[[processes]]\n  type = \"web\"\n  command = \"node server.js\"\n"), 0666)
+				})
+				exporter.ExecuteCall.Stub = record("exporter", exporter.ExecuteCall.Stub)
+			})
+
+			it("runs every phase and keeps only the lifecycle cache and previous image labels in the v2 cache", func() {
+				Expect(finalizer.Finalize()).To(Succeed())
+
+				Expect(phases).To(Equal([]string{"analyzer", "detector", "restorer", "builder", "exporter"}))
+				Expect(fakeExecutable.ExecuteCall.Receives.Execution.Args).To(ContainElement("-analyzed"))
+				Expect(ioutil.ReadFile(analyzedMetadata)).To(ContainSubstring("cnb2cf/run:some-stack"))
+				Expect(exporter.ExecuteCall.Receives.Execution.Env).To(ContainElement("CNB_PLATFORM_API=0.12"))
+
+				cached, err := ioutil.ReadDir(v2CacheDir)
+				Expect(err).NotTo(HaveOccurred())
+				var names []string
+				for _, file := range cached {
+					names = append(names, file.Name())
+				}
+				Expect(names).To(ConsistOf("BUILDPACK_METADATA", "cnb-previous-image"))
+
+				Expect(filepath.Join(v3LauncherDir, "launcher")).To(BeARegularFile())
+				Expect(os.Readlink(filepath.Join(v3LauncherDir, "process", "web"))).To(Equal(filepath.Join("..", "launcher")))
+				Expect(v2AppDir).To(BeADirectory())
+				Expect(filepath.Join(profileDir, "0_shim.sh")).To(BeARegularFile())
+			})
+		})
+
+		it("leaves caching layers to the lifecycle", func() {
+			Expect(os.MkdirAll(filepath.Join(v3LayersDir, "some-buildpack", "some-layer"), 0777)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(v3LayersDir, "some-buildpack", "some-layer.toml"), []byte("cache = true\nlaunch = true"), 0666)).To(Succeed())
+
+			Expect(finalizer.MoveV3Layers()).To(Succeed())
+
+			Expect(filepath.Join(v2DepsDir, "some-buildpack", "some-layer")).To(BeADirectory())
+			Expect(filepath.Join(v2CacheDir, "cnb")).NotTo(BeAnExistingFile())
+		})
+	})
+
 	when("GenerateOrderTOML", func() {
 		it("should write a order.toml file with metabuildpack id's and versions", func() {
 			orderFileA := filepath.Join(orderDir, "orderA.toml")
@@ -472,6 +720,22 @@ version = "4.5.6"
 			Expect(dep2Metadata.Cache).To(Equal(true))
 		})
 
+		for _, api := range []string{"0.2", "0.6"} {
+			api := api
+
+			it("reads the layer.toml of a buildpack API "+api+" CNB", func() {
+				fixture := filepath.Join("testdata", "layers", "buildpack_api_"+api)
+				installed := filepath.Join(v3BuildpacksDir, "org.cloudfoundry.generic.buildpack", "1.0.1")
+				Expect(os.MkdirAll(installed, 0777)).To(Succeed())
+				Expect(libbuildpack.CopyFile(filepath.Join(fixture, "buildpack.toml"), filepath.Join(installed, "buildpack.toml"))).To(Succeed())
+				Expect(libbuildpack.CopyFile(filepath.Join(fixture, "layer.toml"), Dep1LayerMetadataPath)).To(Succeed())
+
+				metadata, err := finalizer.ReadLayerMetadata(Dep1LayerMetadataPath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(metadata).To(Equal(shims.LayerMetadata{Launch: true, Cache: true}))
+			})
+		}
+
 		it("can move layer to cache if needed", func() {
 			Expect(finalizer.MoveV3Layers()).To(Succeed())
 
@@ -501,6 +765,64 @@ version = "4.5.6"
 
 			Expect(filepath.Join(v3BuildpacksDir, "buildpack.0", "0.0.1", "bin", "build")).To(BeAnExistingFile())
 		})
+
+		it("declares the negotiated buildpack API", func() {
+			finalizer.APIs = shims.APIs{Platform: "0.12", Buildpack: "0.11"}
+			Expect(finalizer.AddFakeCNBBuildpack("buildpack.0")).To(Succeed())
+
+			buildpackTOML, err := shims.ParseBuildpackTOML(filepath.Join(v3BuildpacksDir, "buildpack.0", "0.0.1", "buildpack.toml"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buildpackTOML.API).To(Equal("0.11"))
+		})
+	})
+
+	when("WriteLayerMetadata", func() {
+		it("writes top level layer types for buildpack APIs before 0.6", func() {
+			finalizer.APIs = shims.APIs{Platform: "0.3", Buildpack: "0.2"}
+			Expect(finalizer.WriteLayerMetadata(filepath.Join(v3LayersDir, "layer"))).To(Succeed())
+
+			contents, err := ioutil.ReadFile(filepath.Join(v3LayersDir, "layer.toml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("build = true\nlaunch = true\ncache = false\n"))
+		})
+
+		it("writes a types table for buildpack API 0.6 and later", func() {
+			finalizer.APIs = shims.APIs{Platform: "0.12", Buildpack: "0.11"}
+			Expect(finalizer.WriteLayerMetadata(filepath.Join(v3LayersDir, "layer"))).To(Succeed())
+
+			contents, err := ioutil.ReadFile(filepath.Join(v3LayersDir, "layer.toml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("[types]\n  build = true\n  launch = true\n  cache = false\n"))
+		})
+	})
+
+	when("WriteProcessLinks", func() {
+		it.Before(func() {
+			Expect(os.MkdirAll(filepath.Join(v3LayersDir, "config"), 0777)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(v3LayersDir, "config", "metadata.toml"), []byte(`[[processes]]
+  type = "web"
+  command = "node server.js"
+
+[[processes]]
+  type = "worker"
+  command = "node worker.js"
+`), 0666)).To(Succeed())
+		})
+
+		it("links each process type to the launcher for platform API 0.4 and later", func() {
+			finalizer.APIs = shims.APIs{Platform: "0.12", Buildpack: "0.11"}
+			Expect(finalizer.WriteProcessLinks()).To(Succeed())
+
+			for _, processType := range []string{"web", "worker"} {
+				Expect(os.Readlink(filepath.Join(v3LauncherDir, "process", processType))).To(Equal(filepath.Join("..", shims.V3Launcher)))
+			}
+		})
+
+		it("links nothing for a 0.7 era lifecycle, whose launcher takes the process type as an argument", func() {
+			finalizer.APIs = shims.APIs{Platform: "0.3", Buildpack: "0.2"}
+			Expect(finalizer.WriteProcessLinks()).To(Succeed())
+			Expect(filepath.Join(v3LauncherDir, "process")).NotTo(BeAnExistingFile())
+		})
 	})
 
 	when("WriteProfileLaunch", func() {
@@ -514,9 +836,52 @@ export CNB_APP_DIR="$HOME"
 export CNB_SERVICES="$VCAP_SERVICES"
 export CNB_INSTANCE_INDEX="$CF_INSTANCE_INDEX"
 export CNB_APP_NAME="$(echo "$VCAP_APPLICATION" | jq -r .application_name)"
-exec $HOME/.cloudfoundry/%s "$2"
+if [ -z "$2" ]; then
+  exec "$HOME/.cloudfoundry/%[2]s"
+fi
+exec "$HOME/.cloudfoundry/%[2]s" "$2"
 `, os.Getenv("CF_STACK"), shims.V3Launcher)))
 		})
+
+		it("runs a process type by its link for platform API 0.4 and later", func() {
+			finalizer.APIs = shims.APIs{Platform: "0.12", Buildpack: "0.11"}
+			Expect(finalizer.WriteProfileLaunch()).To(Succeed())
+			contents, err := ioutil.ReadFile(filepath.Join(profileDir, shims.V3LaunchScript))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(HaveSuffix(`if [ -z "$2" ]; then
+  exec "$HOME/.cloudfoundry/launcher"
+fi
+if [ -L "$HOME/.cloudfoundry/process/$2" ]; then
+  exec "$HOME/.cloudfoundry/process/$2"
+fi
+exec "$HOME/.cloudfoundry/launcher" "$2"
+`))
+		})
+
+		it("passes a process type as the only argument for a 0.7 era lifecycle", func() {
+			finalizer.APIs = shims.APIs{Platform: "0.3", Buildpack: "0.2"}
+			Expect(finalizer.WriteProfileLaunch()).To(Succeed())
+			contents, err := ioutil.ReadFile(filepath.Join(profileDir, shims.V3LaunchScript))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).NotTo(ContainSubstring("process"))
+			Expect(string(contents)).To(HaveSuffix(`export CNB_PLATFORM_API="0.3"
+if [ -z "$2" ]; then
+  exec "$HOME/.cloudfoundry/launcher"
+fi
+exec "$HOME/.cloudfoundry/launcher" "$2"
+`))
+		})
+
+		it("exports the platform API negotiated with the lifecycle", func() {
+			finalizer.APIs = shims.APIs{Platform: "0.12", Buildpack: "0.11"}
+			Expect(finalizer.WriteProfileLaunch()).To(Succeed())
+			contents, err := ioutil.ReadFile(filepath.Join(profileDir, shims.V3LaunchScript))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring(`export CNB_APP_NAME="$(echo "$VCAP_APPLICATION" | jq -r .application_name)"
+export CNB_PLATFORM_API="0.12"
+if [ -z "$2" ]; then
+`))
+		})
 	})
 }
 
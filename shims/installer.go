@@ -156,11 +156,11 @@ func (c *CNBInstaller) InstallLifecycle(dst string) error {
 		return errors.Errorf("issue unpacking lifecycle : incorrect dir format : %s", firstDir)
 	}
 
-	for _, binary := range []string{V3Detector, V3Builder, V3Launcher, V3LifecycleBinary} {
+	for _, binary := range []string{V3Detector, V3Builder, V3Launcher, V3LifecycleBinary, V3Analyzer, V3Restorer, V3Exporter} {
 		srcBinary := filepath.Join(firstDir[0], binary)
 		_, err := os.Stat(srcBinary)
 		if os.IsNotExist(err) {
-			if binary == V3LifecycleBinary {
+			if binary == V3LifecycleBinary || binary == V3Analyzer || binary == V3Restorer || binary == V3Exporter {
 				continue
 			}
 			return errors.Wrapf(err, "issue locating %s", srcBinary)
@@ -171,5 +171,14 @@ func (c *CNBInstaller) InstallLifecycle(dst string) error {
 		}
 	}
 
+	descriptor := filepath.Join(tempDir, LifecycleDescriptorFile)
+	if _, err := os.Stat(descriptor); err == nil {
+		if err := os.Rename(descriptor, filepath.Join(dst, LifecycleDescriptorFile)); err != nil {
+			return errors.Wrapf(err, "issue copying %s", LifecycleDescriptorFile)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
 	return nil
 }
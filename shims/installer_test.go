@@ -215,6 +215,7 @@ func testInstaller(t *testing.T, when spec.G, it spec.S) {
 				for _, binary := range keepBinaries {
 					Expect(filepath.Join(tmpDir, binary)).To(BeAnExistingFile())
 				}
+				Expect(filepath.Join(tmpDir, "lifecycle.toml")).To(BeAnExistingFile())
 			})
 		})
 	})
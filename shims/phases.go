@@ -0,0 +1,237 @@
+package shims
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/cloudfoundry/libbuildpack"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/paketo-buildpacks/packit/pexec"
+)
+
+// LifecyclePhasesEnv, when "true", makes finalize run the analyzer,
+// detector, restorer, builder and exporter, in that order, against
+// directories in the cache in place of the detector and builder alone.
+const LifecyclePhasesEnv = "CNB2CF_LIFECYCLE_PHASES"
+
+const (
+	// V3CacheDir is the lifecycle's directory cache inside the v2 cache.
+	V3CacheDir = "cnb-cache"
+
+	// V3PreviousImageDir holds an OCI layout of the labels of the last app
+	// image inside the v2 cache. They are all the analyzer reads of the
+	// previous image, so its layers are not kept.
+	V3PreviousImageDir = "cnb-previous-image"
+
+	V3AppImage = "cnb2cf/app:latest"
+	V3RunImage = "cnb2cf/run"
+)
+
+// RunLifecyclePhasesAPI is the platform API the lifecycle must speak for the
+// phases to run without a registry or a Docker daemon.
+const RunLifecyclePhasesAPI = "0.12"
+
+// RunLifecycleAnalyze writes a scratch run image for the stack and the
+// previous app image kept in the cache to the layout, and runs the analyzer,
+// which records the previous image in the analyzed metadata.
+func (f *Finalizer) RunLifecycleAnalyze() error {
+	if !f.APIs.PlatformAtLeast(RunLifecyclePhasesAPI) {
+		return fmt.Errorf("running the lifecycle phases needs a lifecycle that supports platform API %s or later, this one speaks %q", RunLifecyclePhasesAPI, f.APIs.Platform)
+	}
+
+	runImage := fmt.Sprintf("%s:%s", V3RunImage, f.Environment.Stack())
+	if err := WriteRunImage(f.V3LayoutDir, runImage, "org.cloudfoundry.stacks."+f.Environment.Stack()); err != nil {
+		return err
+	}
+
+	if err := f.restorePreviousImage(); err != nil {
+		return err
+	}
+
+	return f.runPhase(f.Analyzer, append(f.ownerArgs(),
+		"-analyzed", f.AnalyzedMetadata,
+		"-layers", f.V3LayersDir,
+		"-run-image", runImage,
+		V3AppImage,
+	))
+}
+
+// RunLifecycleRestore runs the restorer, which restores the layer metadata
+// of the previous image and the cached layers.
+func (f *Finalizer) RunLifecycleRestore() error {
+	return f.runPhase(f.Restorer, append(f.ownerArgs(),
+		"-analyzed", f.AnalyzedMetadata,
+		"-cache-dir", f.cacheDir(),
+		"-group", f.GroupMetadata,
+		"-layers", f.V3LayersDir,
+	))
+}
+
+// RunLifecycleExport runs the exporter, which writes the app image to the
+// layout and the cached layers to the cache, and then keeps the labels of
+// the app image in the cache for the next staging to analyze.
+func (f *Finalizer) RunLifecycleExport() error {
+	err := f.runPhase(f.Exporter, append(f.ownerArgs(),
+		"-analyzed", f.AnalyzedMetadata,
+		"-app", f.V3AppDir,
+		"-cache-dir", f.cacheDir(),
+		"-group", f.GroupMetadata,
+		"-launcher", filepath.Join(f.V3LifecycleDir, V3Launcher),
+		"-layers", f.V3LayersDir,
+		"-report", filepath.Join(filepath.Dir(f.AnalyzedMetadata), "report.toml"),
+		V3AppImage,
+	))
+	if err != nil {
+		return err
+	}
+
+	return f.savePreviousImage()
+}
+
+// WriteRunImage writes an image with no layers, labelled with the stack, to
+// the path in layoutDir that the lifecycle reads ref from.
+func WriteRunImage(layoutDir, ref, stackID string) error {
+	path, err := LayoutPath(layoutDir, ref)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Join(path, "index.json")); err == nil {
+		return nil
+	}
+
+	if err := writeLabelsImage(path, map[string]string{"io.buildpacks.stack.id": stackID}); err != nil {
+		return fmt.Errorf("unable to write run image %s: %s", ref, err)
+	}
+
+	return nil
+}
+
+// LayoutPath is where the lifecycle keeps the image ref in layoutDir.
+func LayoutPath(layoutDir, ref string) (string, error) {
+	reference, err := name.ParseReference(ref)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(layoutDir, reference.Context().RegistryStr(), reference.Context().RepositoryStr(), reference.Identifier()), nil
+}
+
+func (f *Finalizer) runPhase(phase Executable, args []string) error {
+	env, err := f.lifecycleEnv()
+	if err != nil {
+		return err
+	}
+
+	env = append(env,
+		"CNB_EXPERIMENTAL_MODE=warn",
+		"CNB_USE_LAYOUT=true",
+		"CNB_LAYOUT_DIR="+f.V3LayoutDir,
+	)
+
+	return phase.Execute(pexec.Execution{
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		Env:    env,
+		Args:   args,
+	})
+}
+
+func (f *Finalizer) ownerArgs() []string {
+	return []string{"-uid", strconv.Itoa(os.Getuid()), "-gid", strconv.Itoa(os.Getgid())}
+}
+
+func (f *Finalizer) cacheDir() string {
+	return filepath.Join(f.V2CacheDir, V3CacheDir)
+}
+
+func (f *Finalizer) previousImageDir() string {
+	return filepath.Join(f.V2CacheDir, V3PreviousImageDir)
+}
+
+// restorePreviousImage copies the previous app image kept in the cache to
+// where the analyzer looks for it in the layout.
+func (f *Finalizer) restorePreviousImage() error {
+	if _, err := os.Stat(filepath.Join(f.previousImageDir(), "index.json")); os.IsNotExist(err) {
+		return nil
+	}
+
+	path, err := LayoutPath(f.V3LayoutDir, V3AppImage)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+
+	return libbuildpack.CopyDirectory(f.previousImageDir(), path)
+}
+
+// savePreviousImage replaces the previous app image in the cache with the
+// labels of the app image that was just exported.
+func (f *Finalizer) savePreviousImage() error {
+	path, err := LayoutPath(f.V3LayoutDir, V3AppImage)
+	if err != nil {
+		return err
+	}
+
+	index, err := layout.ImageIndexFromPath(path)
+	if err != nil {
+		return fmt.Errorf("unable to read app image: %s", err)
+	}
+
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return err
+	}
+
+	if len(manifest.Manifests) != 1 {
+		return fmt.Errorf("expected one app image in %s, found %d", path, len(manifest.Manifests))
+	}
+
+	image, err := index.Image(manifest.Manifests[0].Digest)
+	if err != nil {
+		return err
+	}
+
+	config, err := image.ConfigFile()
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(f.previousImageDir()); err != nil {
+		return err
+	}
+
+	return writeLabelsImage(f.previousImageDir(), config.Config.Labels)
+}
+
+// writeLabelsImage writes an image with no layers, carrying labels, as the
+// only image of a new OCI layout at path.
+func writeLabelsImage(path string, labels map[string]string) error {
+	image, err := mutate.ConfigFile(empty.Image, &v1.ConfigFile{
+		OS:           "linux",
+		Architecture: runtime.GOARCH,
+		Config: v1.Config{
+			Labels: labels,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	index, err := layout.Write(path, empty.Index)
+	if err != nil {
+		return err
+	}
+
+	return index.AppendImage(image)
+}
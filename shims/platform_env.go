@@ -0,0 +1,107 @@
+package shims
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	PlatformEnvOverride = "override"
+	PlatformEnvAppend   = "append"
+)
+
+// SystemEnv matches the variables that Cloud Foundry and the shell set while
+// staging, along with those that configure the shims themselves. They are
+// never passed to the CNBs as platform env, leaving only those the app was
+// given with `cf set-env` or its manifest.
+var SystemEnv = []string{
+	"CF_*", "VCAP_*", "CNB_*", "CNB2CF_*", "INSTANCE_*",
+	"DATABASE_URL", "DEPS_DIR", "HOME", "HOSTNAME", "LANG", "LD_LIBRARY_PATH",
+	"LOG_LEVEL", "MEMORY_LIMIT", "OLDPWD", "PATH", "PORT", "PWD", "SHLVL", "TERM",
+	"TMPDIR", "USER", "_",
+}
+
+// PlatformEnv chooses which of the app's env is given to the CNBs, as
+// configured by [metadata.platform_env] in the shimmed buildpack.toml. Allow
+// and Deny hold glob patterns; when Allow is empty every user-provided
+// variable is allowed. Actions names the variables that are written with an
+// .override or .append suffix, so that they replace or extend the value a
+// CNB sets rather than being its default.
+type PlatformEnv struct {
+	Allow   []string          `toml:"allow"`
+	Deny    []string          `toml:"deny"`
+	Actions map[string]string `toml:"actions"`
+}
+
+// ReadPlatformEnv reads the platform env configuration of the shimmed
+// buildpack.toml at path.
+func ReadPlatformEnv(path string) (PlatformEnv, error) {
+	var buildpack struct {
+		Metadata struct {
+			PlatformEnv PlatformEnv `toml:"platform_env"`
+		} `toml:"metadata"`
+	}
+	if _, err := toml.DecodeFile(path, &buildpack); err != nil {
+		return PlatformEnv{}, err
+	}
+
+	env := buildpack.Metadata.PlatformEnv
+	for name, action := range env.Actions {
+		if action != PlatformEnvOverride && action != PlatformEnvAppend {
+			return PlatformEnv{}, fmt.Errorf("invalid platform env action %q for %s: must be %q or %q", action, name, PlatformEnvOverride, PlatformEnvAppend)
+		}
+	}
+
+	for _, pattern := range append(append([]string{}, env.Allow...), env.Deny...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return PlatformEnv{}, fmt.Errorf("invalid platform env pattern %q: %s", pattern, err)
+		}
+	}
+
+	return env, nil
+}
+
+// Build returns the key=value pairs to write to the platform env dir: the
+// allowed variables of environ, named for their action, followed by the
+// variables the platform provides.
+func (p PlatformEnv) Build(environ []string, platform ...string) ([]string, error) {
+	var result []string
+	for _, en := range environ {
+		pair := strings.SplitN(en, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("var fails to contain required key=value structure")
+		}
+
+		name := pair[0]
+		if matchesAny(SystemEnv, name) || matchesAny(p.Deny, name) {
+			continue
+		}
+
+		if len(p.Allow) > 0 && !matchesAny(p.Allow, name) {
+			continue
+		}
+
+		if action, ok := p.Actions[name]; ok {
+			name = name + "." + action
+		}
+
+		result = append(result, name+"="+pair[1])
+	}
+	sort.Strings(result)
+
+	return append(result, platform...), nil
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,122 @@
+package shims_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/shims"
+	"github.com/sclevine/spec"
+
+	. "github.com/onsi/gomega"
+)
+
+func testPlatformEnv(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		tmpDir  string
+		environ []string
+	)
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "platform-env")
+		Expect(err).NotTo(HaveOccurred())
+
+		environ = []string{
+			"CF_INSTANCE_KEY=some-key",
+			"VCAP_SERVICES={}",
+			"HOME=/home/vcap",
+			"PATH=/usr/bin",
+			"CNB2CF_LIFECYCLE_PHASES=true",
+			"LOG_LEVEL=debug",
+			"BP_NODE_VERSION=14.*",
+			"NODE_ENV=production",
+			"API_TOKEN=secret",
+		}
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	when("Build", func() {
+		it("passes only the user-provided env, followed by the platform's", func() {
+			env, err := shims.PlatformEnv{}.Build(environ, "CNB_SERVICES={}")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env).To(Equal([]string{"API_TOKEN=secret", "BP_NODE_VERSION=14.*", "NODE_ENV=production", "CNB_SERVICES={}"}))
+		})
+
+		it("applies the allow and deny lists and names files for their action", func() {
+			env, err := shims.PlatformEnv{
+				Allow:   []string{"BP_*", "NODE_ENV", "API_*"},
+				Deny:    []string{"*_TOKEN"},
+				Actions: map[string]string{"NODE_ENV": "override", "BP_NODE_VERSION": "append"},
+			}.Build(environ)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env).To(Equal([]string{"BP_NODE_VERSION.append=14.*", "NODE_ENV.override=production"}))
+		})
+
+		it("rejects env without a value", func() {
+			_, err := shims.PlatformEnv{}.Build([]string{"no-key-val"})
+			Expect(err).To(MatchError(ContainSubstring("var fails to contain required key=value structure")))
+		})
+	})
+
+	when("ReadPlatformEnv", func() {
+		var path string
+
+		it.Before(func() {
+			path = filepath.Join(tmpDir, "buildpack.toml")
+		})
+
+		it("reads [metadata.platform_env]", func() {
+			Expect(ioutil.WriteFile(path, []byte(`api = "0.2"
+
+[buildpack]
+  id = "org.cloudfoundry.nodejs"
+
+[metadata]
+  include_files = ["buildpack.toml"]
+
+  [metadata.platform_env]
+    allow = ["BP_*"]
+    deny = ["*_TOKEN"]
+
+    [metadata.platform_env.actions]
+      BP_NODE_VERSION = "override"
+`), 0644)).To(Succeed())
+
+			env, err := shims.ReadPlatformEnv(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env).To(Equal(shims.PlatformEnv{
+				Allow:   []string{"BP_*"},
+				Deny:    []string{"*_TOKEN"},
+				Actions: map[string]string{"BP_NODE_VERSION": "override"},
+			}))
+		})
+
+		it("allows every user-provided variable when there is no configuration", func() {
+			Expect(ioutil.WriteFile(path, []byte(`[buildpack]
+  id = "org.cloudfoundry.nodejs"
+`), 0644)).To(Succeed())
+
+			env, err := shims.ReadPlatformEnv(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env).To(Equal(shims.PlatformEnv{}))
+		})
+
+		it("rejects an unknown action", func() {
+			Expect(ioutil.WriteFile(path, []byte(`[metadata.platform_env.actions]
+  PATH = "prepend"
+`), 0644)).To(Succeed())
+
+			_, err := shims.ReadPlatformEnv(path)
+			Expect(err).To(MatchError(ContainSubstring(`invalid platform env action "prepend" for PATH`)))
+		})
+	})
+}
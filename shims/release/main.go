@@ -19,6 +19,8 @@ func main() {
 	releaser := shims.Releaser{
 		MetadataPath: filepath.Join(os.Args[1], ".cloudfoundry", "metadata.toml"),
 		Writer:       os.Stdout,
+
+		DefaultProcessType: os.Getenv(shims.DefaultProcessTypeEnv),
 	}
 
 	if err := releaser.Release(); err != nil {
@@ -9,45 +9,90 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+// DefaultProcessTypeEnv names the environment variable that chooses which
+// process type Cloud Foundry runs as web.
+const DefaultProcessTypeEnv = "CNB2CF_DEFAULT_PROCESS_TYPE"
+
 type inputMetadata struct {
-	Processes []struct {
-		Type    string `toml:"type"`
-		Command string `toml:"command"`
-	}
+	Processes                   []inputProcess `toml:"processes"`
+	BuildpackDefaultProcessType string         `toml:"buildpack-default-process-type"`
 }
 
-type defaultProcessTypes struct {
-	Web string `yaml:"web"`
+type inputProcess struct {
+	Type    string `toml:"type"`
+	Default bool   `toml:"default"`
 }
 
 type outputMetadata struct {
-	DefaultProcessTypes defaultProcessTypes `yaml:"default_process_types"`
+	DefaultProcessTypes map[string]string `yaml:"default_process_types"`
 }
 
 type Releaser struct {
 	MetadataPath string
 	Writer       io.Writer
+
+	// DefaultProcessType, when set, is the process type run as web in place
+	// of the one the CNBs chose.
+	DefaultProcessType string
 }
 
+// Release writes every launch process as a Cloud Foundry process type. The
+// command of each is the CNB process type, which the profile script from
+// WriteProfileLaunch hands to the launcher to look up in the launch
+// metadata, so that its args and direct flag are honoured just as they are
+// in an image built by pack.
+//
+// The web process is the configured default, else the CNBs' own web
+// process, else the process they marked as the default, else their only
+// process. When there is none of those, no web process is written and the
+// app must be given a start command.
 func (r *Releaser) Release() error {
 	metadataFile, input := r.MetadataPath, inputMetadata{}
-	_, err := toml.DecodeFile(metadataFile, &input)
 	defer os.Remove(metadataFile)
 
-	webCommand, err := input.findCommand("web")
-	if err != nil {
-		return err
+	if _, err := toml.DecodeFile(metadataFile, &input); err != nil {
+		return fmt.Errorf("unable to decode launch metadata %s: %s", metadataFile, err)
+	}
+
+	output := outputMetadata{DefaultProcessTypes: map[string]string{}}
+	for _, p := range input.Processes {
+		output.DefaultProcessTypes[p.Type] = p.Type
+	}
+
+	if processType := input.defaultProcessType(r.DefaultProcessType); processType != "" {
+		if _, ok := output.DefaultProcessTypes[processType]; !ok {
+			return fmt.Errorf("unable to find process with type %s in launch metadata %v", processType, input.Processes)
+		}
+		output.DefaultProcessTypes["web"] = processType
 	}
 
-	output := outputMetadata{DefaultProcessTypes: defaultProcessTypes{Web: webCommand}}
 	return yaml.NewEncoder(r.Writer).Encode(output)
 }
 
-func (i *inputMetadata) findCommand(processType string) (string, error) {
+func (i *inputMetadata) defaultProcessType(configured string) string {
+	if configured != "" {
+		return configured
+	}
+
 	for _, p := range i.Processes {
-		if p.Type == processType {
-			return p.Command, nil
+		if p.Type == "web" {
+			return p.Type
 		}
 	}
-	return "", fmt.Errorf("unable to find process with type %s in launch metadata %v", processType, i.Processes)
+
+	for _, p := range i.Processes {
+		if p.Default {
+			return p.Type
+		}
+	}
+
+	if i.BuildpackDefaultProcessType != "" {
+		return i.BuildpackDefaultProcessType
+	}
+
+	if len(i.Processes) == 1 {
+		return i.Processes[0].Type
+	}
+
+	return ""
 }
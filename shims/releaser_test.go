@@ -52,7 +52,128 @@ func testReleaser(t *testing.T, when spec.G, it spec.S) {
 
 	it("runs with the correct arguments and moves things to the correct place", func() {
 		Expect(releaser.Release()).To(Succeed())
-		Expect(buf.Bytes()).To(Equal([]byte("default_process_types:\n  web: npm start\n")))
+		Expect(buf.Bytes()).To(Equal([]byte("default_process_types:\n  web: web\n")))
 		Expect(filepath.Join(v2AppDir, ".cloudfoundry", "metadata.toml")).NotTo(BeAnExistingFile())
 	})
+
+	when("the CNBs declare several processes", func() {
+		write := func(contents string) {
+			Expect(ioutil.WriteFile(releaser.MetadataPath, []byte(contents), 0666)).To(Succeed())
+		}
+
+		it("runs each process through the launcher by its type", func() {
+			write(`
+				[[processes]]
+				type = "web"
+				command = "npm start"
+				[[processes]]
+				type = "worker"
+				command = "npm run worker"
+				[[processes]]
+				type = "migrate"
+				command = "npm run migrate"
+				`)
+
+			Expect(releaser.Release()).To(Succeed())
+			Expect(buf.String()).To(Equal("default_process_types:\n  migrate: migrate\n  web: web\n  worker: worker\n"))
+		})
+
+		it("leaves the args and direct flag of each process to the launcher", func() {
+			write(`
+				[[processes]]
+				type = "web"
+				command = "node"
+				args = ["server.js", "--title", "my app"]
+				direct = true
+				`)
+
+			Expect(releaser.Release()).To(Succeed())
+			Expect(buf.String()).To(Equal("default_process_types:\n  web: web\n"))
+		})
+
+		it("runs the process marked as the default as web when there is no web process", func() {
+			write(`
+				[[processes]]
+				type = "task"
+				command = "npm run task"
+				[[processes]]
+				type = "worker"
+				command = "npm run worker"
+				default = true
+				`)
+
+			Expect(releaser.Release()).To(Succeed())
+			Expect(buf.String()).To(Equal("default_process_types:\n  task: task\n  web: worker\n  worker: worker\n"))
+		})
+
+		it("honours the buildpack default process type recorded by the lifecycle", func() {
+			write(`
+				buildpack-default-process-type = "task"
+				[[processes]]
+				type = "task"
+				command = "npm run task"
+				[[processes]]
+				type = "worker"
+				command = "npm run worker"
+				`)
+
+			Expect(releaser.Release()).To(Succeed())
+			Expect(buf.String()).To(ContainSubstring("  web: task\n"))
+		})
+
+		it("runs the only process as web", func() {
+			write(`
+				[[processes]]
+				type = "worker"
+				command = "npm run worker"
+				`)
+
+			Expect(releaser.Release()).To(Succeed())
+			Expect(buf.String()).To(Equal("default_process_types:\n  web: worker\n  worker: worker\n"))
+		})
+
+		it("leaves out web when no process can be chosen", func() {
+			write(`
+				[[processes]]
+				type = "task"
+				command = "npm run task"
+				[[processes]]
+				type = "worker"
+				command = "npm run worker"
+				`)
+
+			Expect(releaser.Release()).To(Succeed())
+			Expect(buf.String()).To(Equal("default_process_types:\n  task: task\n  worker: worker\n"))
+		})
+
+		it("writes no process types when there are no processes", func() {
+			write(`buildpacks = ["some.buildpack"]`)
+
+			Expect(releaser.Release()).To(Succeed())
+			Expect(buf.String()).To(Equal("default_process_types: {}\n"))
+		})
+
+		when("a default process type is configured", func() {
+			it("runs it as web", func() {
+				write(`
+					[[processes]]
+					type = "web"
+					command = "npm start"
+					[[processes]]
+					type = "worker"
+					command = "npm run worker"
+					`)
+				releaser.DefaultProcessType = "worker"
+
+				Expect(releaser.Release()).To(Succeed())
+				Expect(buf.String()).To(Equal("default_process_types:\n  web: worker\n  worker: worker\n"))
+			})
+
+			it("fails when there is no such process", func() {
+				releaser.DefaultProcessType = "missing"
+
+				Expect(releaser.Release()).To(MatchError(ContainSubstring("unable to find process with type missing")))
+			})
+		})
+	})
 }
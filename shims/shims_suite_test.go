@@ -11,9 +11,11 @@ import (
 func TestUnitShims(t *testing.T) {
 	suite := spec.New("shims", spec.Report(report.Terminal{}))
 
+	suite("API", testAPI)
 	suite("Detector", testDetector)
 	suite("Finalizer", testFinalizer)
 	suite("Installer", testInstaller)
+	suite("PlatformEnv", testPlatformEnv)
 	suite("Releaser", testReleaser)
 	suite("Supplier", testSupplier)
 
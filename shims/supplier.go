@@ -1,6 +1,7 @@
 package shims
 
 import (
+	"crypto/ed25519"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/cloudfoundry/cnb2cf/signature"
 	"github.com/cloudfoundry/libbuildpack"
 )
 
@@ -23,6 +25,7 @@ type Supplier struct {
 	Installer       Installer
 	Manifest        *libbuildpack.Manifest
 	Logger          *libbuildpack.Logger
+	PublicKey       ed25519.PublicKey
 }
 
 const (
@@ -30,6 +33,10 @@ const (
 )
 
 func (s *Supplier) Supply() error {
+	if err := s.VerifyManifest(); err != nil {
+		return errors.Wrap(err, "failed to verify manifest.yml")
+	}
+
 	if err := s.CheckBuildpackValid(); err != nil {
 		return errors.Wrap(err, "failed to check that buildpack is correct")
 	}
@@ -50,6 +57,34 @@ func (s *Supplier) Supply() error {
 	return s.Installer.InstallCNBs(orderFile, s.V3BuildpacksDir)
 }
 
+// VerifyManifest checks the signature packaged with manifest.yml against
+// PublicKey, so that no CNB is installed from a manifest that was altered.
+// It does nothing when there is no PublicKey.
+func (s *Supplier) VerifyManifest() error {
+	if len(s.PublicKey) == 0 {
+		return nil
+	}
+
+	if err := VerifyBuildpackManifest(s.V2BuildpackDir, s.PublicKey); err != nil {
+		return err
+	}
+
+	s.Logger.Info("Verified the signature of manifest.yml")
+	return nil
+}
+
+// VerifyBuildpackManifest checks the manifest.yml of the shimmed buildpack
+// in buildpackDir against the signature packaged with it. Every step that
+// installs CNBs calls it first. It does nothing when publicKey is empty.
+func VerifyBuildpackManifest(buildpackDir string, publicKey ed25519.PublicKey) error {
+	if len(publicKey) == 0 {
+		return nil
+	}
+
+	manifest := filepath.Join(buildpackDir, "manifest.yml")
+	return signature.VerifyFile(manifest, filepath.Join(buildpackDir, signature.ManifestFile), publicKey)
+}
+
 func (s *Supplier) SetUpFirstV3Buildpack() error {
 	exists, err := v3symlinkExists(s.V2AppDir)
 	if err != nil {
@@ -2,6 +2,8 @@ package shims_test
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -9,6 +11,7 @@ import (
 	"time"
 
 	"github.com/cloudfoundry/cnb2cf/shims"
+	"github.com/cloudfoundry/cnb2cf/signature"
 	"github.com/cloudfoundry/libbuildpack"
 	"github.com/sclevine/spec"
 
@@ -148,4 +151,67 @@ func testSupplier(t *testing.T, when spec.G, it spec.S) {
 			})
 		})
 	})
+
+	when("VerifyManifest", func() {
+		var (
+			manifestPath string
+			publicKey    ed25519.PublicKey
+		)
+
+		it.Before(func() {
+			var privateKey ed25519.PrivateKey
+			var err error
+			publicKey, privateKey, err = ed25519.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+
+			manifestPath = filepath.Join(v2BuildpacksDir, depsIndex, "manifest.yml")
+			Expect(ioutil.WriteFile(manifestPath, []byte("language: nodejs\n"), 0644)).To(Succeed())
+			Expect(signature.SignFile(manifestPath, filepath.Join(v2BuildpacksDir, depsIndex, signature.ManifestFile), privateKey)).To(Succeed())
+		})
+
+		it("does nothing without a public key", func() {
+			Expect(ioutil.WriteFile(manifestPath, []byte("language: other\n"), 0644)).To(Succeed())
+			Expect(supplier.VerifyManifest()).To(Succeed())
+		})
+
+		it("accepts a manifest signed with the key", func() {
+			supplier.PublicKey = publicKey
+			Expect(supplier.VerifyManifest()).To(Succeed())
+			Expect(buffer.String()).To(ContainSubstring("Verified the signature of manifest.yml"))
+		})
+
+		it("rejects a manifest that was changed", func() {
+			Expect(ioutil.WriteFile(manifestPath, []byte("language: other\n"), 0644)).To(Succeed())
+
+			supplier.PublicKey = publicKey
+			Expect(supplier.VerifyManifest()).To(MatchError(ContainSubstring("does not match")))
+		})
+
+		it("rejects a manifest without a signature", func() {
+			Expect(os.Remove(filepath.Join(v2BuildpacksDir, depsIndex, signature.ManifestFile))).To(Succeed())
+
+			supplier.PublicKey = publicKey
+			Expect(supplier.VerifyManifest()).To(MatchError(ContainSubstring("failed to read signature")))
+		})
+
+		when("VerifyBuildpackManifest", func() {
+			var buildpackDir string
+
+			it.Before(func() {
+				buildpackDir = filepath.Join(v2BuildpacksDir, depsIndex)
+			})
+
+			it("checks the manifest of the buildpack dir without a supplier", func() {
+				Expect(shims.VerifyBuildpackManifest(buildpackDir, publicKey)).To(Succeed())
+
+				Expect(ioutil.WriteFile(manifestPath, []byte("language: other\n"), 0644)).To(Succeed())
+				Expect(shims.VerifyBuildpackManifest(buildpackDir, publicKey)).To(MatchError(ContainSubstring("does not match")))
+			})
+
+			it("does nothing without a public key", func() {
+				Expect(os.Remove(filepath.Join(buildpackDir, signature.ManifestFile))).To(Succeed())
+				Expect(shims.VerifyBuildpackManifest(buildpackDir, nil)).To(Succeed())
+			})
+		})
+	})
 }
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/cloudfoundry/cnb2cf/shims"
+	"github.com/cloudfoundry/cnb2cf/signature"
 	"github.com/cloudfoundry/libbuildpack"
 )
 
@@ -45,6 +46,11 @@ func supply(logger *libbuildpack.Logger) error {
 		return err
 	}
 
+	publicKey, _, err := signature.PublicKeyFromEnvironment()
+	if err != nil {
+		return err
+	}
+
 	manifest, err := libbuildpack.NewManifest(buildpackDir, logger, time.Now())
 	if err != nil {
 		return err
@@ -62,6 +68,7 @@ func supply(logger *libbuildpack.Logger) error {
 		Installer:       shims.NewCNBInstaller(manifest, libbuildpack.NewInstaller(manifest)),
 		Manifest:        manifest,
 		Logger:          logger,
+		PublicKey:       publicKey,
 	}
 
 	return supplier.Supply()
@@ -20,6 +20,7 @@ type Order struct {
 }
 
 type BuildpackTOML struct {
+	API string `toml:"api"`
 	buildpack.Buildpack
 	Order []Order `toml:"order"`
 }
@@ -61,6 +62,17 @@ func encodeTOML(dest string, data interface{}) error {
 	return toml.NewEncoder(destFile).Encode(data)
 }
 
+// ensureFile creates an empty file at path unless there is one already, for
+// lifecycle flags that name a file that must exist.
+func ensureFile(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
 func WritePlatformDir(platformDir string, envs []string) error {
 	envDir := filepath.Join(platformDir, "env")
 	err := os.MkdirAll(envDir, os.ModePerm)
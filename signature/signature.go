@@ -0,0 +1,105 @@
+// Package signature signs and verifies files with ed25519 keys. It only
+// depends on the standard library, so that the shims can verify a shimmed
+// buildpack without linking the packager.
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	// ManifestFile is the signature over manifest.yml that is packaged inside
+	// a signed shimmed buildpack.
+	ManifestFile = "manifest.yml.sig"
+
+	// Extension is appended to the name of a file to name its detached
+	// signature.
+	Extension = ".sig"
+
+	// PublicKeyEnv holds the PEM encoded ed25519 public key that supply
+	// checks the signature over manifest.yml against. Verification is
+	// skipped when it is not set.
+	PublicKeyEnv = "CNB2CF_PUBLIC_KEY"
+)
+
+// ParsePublicKey parses a PEM encoded PKIX ed25519 public key.
+func ParsePublicKey(contents []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, errors.New("failed to parse public key: no PEM block found")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse public key: %T is not an ed25519 key", key)
+	}
+
+	return publicKey, nil
+}
+
+// PublicKeyFromEnvironment returns the key in PublicKeyEnv, reporting false
+// if it is not set.
+func PublicKeyFromEnvironment() (ed25519.PublicKey, bool, error) {
+	contents, ok := os.LookupEnv(PublicKeyEnv)
+	if !ok || contents == "" {
+		return nil, false, nil
+	}
+
+	key, err := ParsePublicKey([]byte(contents))
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid %s: %w", PublicKeyEnv, err)
+	}
+
+	return key, true, nil
+}
+
+// SignFile writes the base64 encoded ed25519 signature over the contents of
+// path to signaturePath.
+func SignFile(path, signaturePath string, key ed25519.PrivateKey) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, contents))
+
+	return ioutil.WriteFile(signaturePath, []byte(signature+"\n"), 0644)
+}
+
+// VerifyFile checks the signature at signaturePath over the contents of
+// path, as written by SignFile.
+func VerifyFile(path, signaturePath string, key ed25519.PublicKey) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := ioutil.ReadFile(signaturePath)
+	if err != nil {
+		return fmt.Errorf("failed to read signature: %w", err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(encoded)))
+	if err != nil {
+		return fmt.Errorf("failed to decode signature %s: %w", signaturePath, err)
+	}
+
+	if !ed25519.Verify(key, contents, signature) {
+		return fmt.Errorf("signature %s does not match %s", signaturePath, path)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package signature_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudfoundry/cnb2cf/signature"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestUnitSignature(t *testing.T) {
+	spec.Run(t, "Signature", testSignature, spec.Report(report.Terminal{}))
+}
+
+func testSignature(t *testing.T, when spec.G, it spec.S) {
+	var (
+		Expect func(interface{}, ...interface{}) Assertion
+
+		tmpDir     string
+		publicKey  ed25519.PublicKey
+		privateKey ed25519.PrivateKey
+	)
+
+	it.Before(func() {
+		Expect = NewWithT(t).Expect
+
+		var err error
+		tmpDir, err = ioutil.TempDir("", "signature")
+		Expect(err).NotTo(HaveOccurred())
+
+		publicKey, privateKey, err = ed25519.GenerateKey(rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	it.After(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	when("SignFile and VerifyFile", func() {
+		it("verifies a signed file and rejects a changed one", func() {
+			path := filepath.Join(tmpDir, "buildpack.zip")
+			Expect(ioutil.WriteFile(path, []byte("some-contents"), 0644)).To(Succeed())
+
+			Expect(signature.SignFile(path, path+signature.Extension, privateKey)).To(Succeed())
+			Expect(signature.VerifyFile(path, path+".sig", publicKey)).To(Succeed())
+
+			Expect(ioutil.WriteFile(path, []byte("other-contents"), 0644)).To(Succeed())
+			Expect(signature.VerifyFile(path, path+".sig", publicKey)).To(MatchError(ContainSubstring("does not match")))
+		})
+	})
+
+	when("PublicKeyFromEnvironment", func() {
+		it.After(func() {
+			Expect(os.Unsetenv(signature.PublicKeyEnv)).To(Succeed())
+		})
+
+		it("parses the PEM encoded key", func() {
+			der, err := x509.MarshalPKIXPublicKey(publicKey)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.Setenv(signature.PublicKeyEnv, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))).To(Succeed())
+
+			key, ok, err := signature.PublicKeyFromEnvironment()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(key).To(Equal(publicKey))
+		})
+
+		it("reports when no key is set", func() {
+			_, ok, err := signature.PublicKeyFromEnvironment()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		it("rejects a key that cannot be parsed", func() {
+			Expect(os.Setenv(signature.PublicKeyEnv, "not a key")).To(Succeed())
+
+			_, _, err := signature.PublicKeyFromEnvironment()
+			Expect(err).To(MatchError(ContainSubstring("invalid CNB2CF_PUBLIC_KEY")))
+		})
+	})
+}